@@ -0,0 +1,209 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// DefaultDetachKeys is the sequence used by Attach when no detach
+// keys are provided: CTRL-P followed by CTRL-Q
+var DefaultDetachKeys = []byte{0x10, 0x11}
+
+const (
+	// attachReplayLines is the number of lines per stream
+	// written by Attach before the live output
+	attachReplayLines = 100
+	// attachBufferSize is the amount of output kept while
+	// the attached writers are busy
+	attachBufferSize = 1 << 20
+)
+
+// chanWriter sends a copy of every chunk written to
+// a channel, until done is closed
+type chanWriter struct {
+	ch   chan<- []byte
+	done <-chan struct{}
+}
+
+func (cw chanWriter) Write(b []byte) (int, error) {
+	select {
+	case cw.ch <- append([]byte(nil), b...):
+		return len(b), nil
+	case <-cw.done:
+		return 0, io.ErrClosedPipe
+	}
+}
+
+// detachScanner looks for the detach sequence in the
+// input, holding back the bytes of a partial match
+type detachScanner struct {
+	keys    []byte
+	matched int
+}
+
+// scan returns the bytes to forward and whether the
+// detach sequence was completed
+func (ds *detachScanner) scan(b []byte) ([]byte, bool) {
+	out := make([]byte, 0, len(b)+ds.matched)
+	for _, c := range b {
+		if c == ds.keys[ds.matched] {
+			ds.matched++
+			if ds.matched == len(ds.keys) {
+				return out, true
+			}
+			continue
+		}
+
+		out = append(out, ds.keys[:ds.matched]...)
+		ds.matched = 0
+		if c == ds.keys[0] {
+			ds.matched = 1
+			continue
+		}
+		out = append(out, c)
+	}
+	return out, false
+}
+
+// Attach connects a terminal (or any reader and writers) to the running
+// Process: it writes the last lines already captured, then streams the
+// live output to out and errOut and forwards everything read from in to
+// the standard input pipe. Attach returns nil as soon as detachKeys
+// (DefaultDetachKeys if nil) are read from in, leaving the child running,
+// or the error of the ExitStatus once the child exits.
+//
+// The output is buffered, so a slow terminal never stalls the child. If
+// in is nil or the Process has no input pipe, the input is discarded but
+// still scanned for the detach sequence. Since a read can't be interrupted,
+// the goroutine reading from in might outlive Attach until its next read
+func (p *Process) Attach(in io.Reader, out, errOut io.Writer, detachKeys []byte) error {
+	if len(detachKeys) == 0 {
+		detachKeys = DefaultDetachKeys
+	}
+
+	changed := p.stateChanged()
+	if !p.IsRunning() {
+		return fmt.Errorf("program \"%s\" is not running", p.ExecName)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	outCh := make(chan []byte, 64)
+	errCh := make(chan []byte, 64)
+	var sinks []*sink
+	if out != nil {
+		lines, partial, s, remove := p.stdoutStream().attach(chanWriter{ch: outCh, done: done}, BufferSink(attachBufferSize))
+		defer remove()
+		sinks = append(sinks, s)
+		replayLines(out, lines, partial)
+	}
+	if errOut != nil {
+		lines, partial, s, remove := p.stderrStream().attach(chanWriter{ch: errCh, done: done}, BufferSink(attachBufferSize))
+		defer remove()
+		sinks = append(sinks, s)
+		replayLines(errOut, lines, partial)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	detached := make(chan struct{})
+	if in != nil {
+		go p.forwardInput(ctx, in, detachKeys, detached)
+	}
+
+	for {
+		select {
+		case b := <-outCh:
+			out.Write(b)
+		case b := <-errCh:
+			errOut.Write(b)
+		case <-detached:
+			return nil
+		case <-changed:
+			changed = p.stateChanged()
+			if p.IsRunning() {
+				continue
+			}
+
+			// the output goroutines are done once the Process is not
+			// running: only the chunks still queued in the sinks are missing
+			flushed := make(chan struct{})
+			go func() {
+				for _, s := range sinks {
+					s.flush()
+				}
+				close(flushed)
+			}()
+
+			for flushing := true; flushing; {
+				select {
+				case b := <-outCh:
+					out.Write(b)
+				case b := <-errCh:
+					errOut.Write(b)
+				case <-flushed:
+					flushing = false
+				}
+			}
+
+			drainChunks(outCh, out)
+			drainChunks(errCh, errOut)
+			return p.Wait().Error()
+		}
+	}
+}
+
+func replayLines(w io.Writer, lines [][]byte, partial []byte) {
+	if len(lines) > attachReplayLines {
+		lines = lines[len(lines)-attachReplayLines:]
+	}
+	if b := append(joinLines(lines), partial...); len(b) > 0 {
+		w.Write(b)
+	}
+}
+
+func drainChunks(ch <-chan []byte, w io.Writer) {
+	for {
+		select {
+		case b := <-ch:
+			w.Write(b)
+		default:
+			return
+		}
+	}
+}
+
+func (p *Process) forwardInput(ctx context.Context, in io.Reader, detachKeys []byte, detached chan<- struct{}) {
+	ds := &detachScanner{keys: detachKeys}
+	buf := make([]byte, 1024)
+
+	for {
+		n, err := in.Read(buf)
+		if n > 0 {
+			if ctx.Err() != nil {
+				return
+			}
+
+			data, detach := ds.scan(buf[:n])
+			if len(data) > 0 {
+				sendErr := p.SendInputContext(ctx, data)
+				if errors.Is(sendErr, context.Canceled) {
+					return
+				}
+			}
+
+			if detach {
+				close(detached)
+				return
+			}
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
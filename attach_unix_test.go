@@ -0,0 +1,99 @@
+//go:build !windows
+
+package process
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDetachScanner(t *testing.T) {
+	tests := []struct {
+		chunks []string
+		want   string
+		detach bool
+	}{
+		{chunks: []string{"abc"}, want: "abc"},
+		{chunks: []string{"ab\x10\x11cd"}, want: "ab", detach: true},
+		{chunks: []string{"ab\x10", "\x11"}, want: "ab", detach: true},
+		{chunks: []string{"a\x10b\x10\x10\x11"}, want: "a\x10b\x10", detach: true},
+		{chunks: []string{"a\x10", "b"}, want: "a\x10b"},
+	}
+
+	for _, tt := range tests {
+		ds := &detachScanner{keys: DefaultDetachKeys}
+		var got []byte
+		var detach bool
+		for _, chunk := range tt.chunks {
+			var out []byte
+			out, detach = ds.scan([]byte(chunk))
+			got = append(got, out...)
+			if detach {
+				break
+			}
+		}
+
+		if string(got) != tt.want || detach != tt.detach {
+			t.Errorf("scan(%q) = %q, %v, want %q, %v", tt.chunks, got, detach, tt.want, tt.detach)
+		}
+	}
+}
+
+func TestAttachOutput(t *testing.T) {
+	// enough output after the input to fill the buffers of Attach
+	p := startShell(t, `printf 'a\nb'; read -r _; echo c; echo err >&2
+		i=0; while [ $i -lt 2000 ]; do echo line$i; i=$((i+1)); done`)
+
+	waitFor(t, "the output before Attach", func() bool {
+		p.outSinks.feedMu.Lock()
+		defer p.outSinks.feedMu.Unlock()
+		return string(p.outSinks.partial) == "b"
+	})
+
+	var out, errOut bytes.Buffer
+	if err := p.Attach(strings.NewReader("go\n"), &out, &errOut, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	want := new(strings.Builder)
+	want.WriteString("a\nbc\n")
+	for i := 0; i < 2000; i++ {
+		fmt.Fprintf(want, "line%d\n", i)
+	}
+	if out.String() != want.String() {
+		t.Errorf("stdout has %d bytes, want %d: the output is repeated or missing", out.Len(), want.Len())
+	}
+	if errOut.String() != "err\n" {
+		t.Errorf("stderr = %q, want %q", errOut.String(), "err\n")
+	}
+}
+
+func TestAttachDetach(t *testing.T) {
+	p := startShell(t, "exec sleep 10")
+
+	done := make(chan error, 1)
+	go func() { done <- p.Attach(strings.NewReader("\x10\x11"), io.Discard, io.Discard, nil) }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Attach didn't return on the detach keys")
+	}
+	if !p.IsRunning() {
+		t.Error("the process stopped on detach")
+	}
+}
+
+func TestAttachNotRunning(t *testing.T) {
+	p := newShell(t, "true")
+	if err := p.Attach(nil, io.Discard, io.Discard, nil); err == nil {
+		t.Error("Attach succeeded on a process that is not running")
+	}
+}
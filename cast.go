@@ -0,0 +1,217 @@
+package process
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// CastHeader is the header of an asciicast v2 recording,
+// see https://docs.asciinema.org/manual/asciicast/v2/
+type CastHeader struct {
+	Version   int               `json:"version"`
+	Width     int               `json:"width"`
+	Height    int               `json:"height"`
+	Timestamp int64             `json:"timestamp,omitempty"`
+	Title     string            `json:"title,omitempty"`
+	Env       map[string]string `json:"env,omitempty"`
+}
+
+// Recorder writes everything a Process prints on its standard output and
+// error, and everything sent to it via SendInput, as an asciicast v2
+// recording, which can be played by asciinema or by PlayCast
+type Recorder struct {
+	w       io.Writer
+	start   time.Time
+	mu      sync.Mutex
+	err     error
+	writers []castWriter
+	removes []func()
+	tails   map[string][]byte
+}
+
+// NewRecorder writes the header of the recording to w and starts recording
+// the Process, even while running, until the Recorder is closed. Empty
+// width and height default to 80x24. Events are written synchronously so
+// that nothing is lost: w should be fast, like a file, not to slow the child
+func NewRecorder(p *Process, w io.Writer, header CastHeader) (*Recorder, error) {
+	r := &Recorder{
+		w:     w,
+		start: time.Now(),
+		tails: make(map[string][]byte),
+	}
+
+	header.Version = 2
+	if header.Width <= 0 {
+		header.Width = 80
+	}
+	if header.Height <= 0 {
+		header.Height = 24
+	}
+	if header.Timestamp == 0 {
+		header.Timestamp = r.start.Unix()
+	}
+
+	b, err := json.Marshal(header)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = w.Write(append(b, '\n')); err != nil {
+		return nil, err
+	}
+
+	r.writers = []castWriter{{r, "stdout", "o"}, {r, "stderr", "o"}, {r, "stdin", "i"}}
+	r.removes = []func(){
+		p.AddStdoutWriter(r.writers[0], BlockSink),
+		p.AddStderrWriter(r.writers[1], BlockSink),
+		p.AddStdinWriter(r.writers[2], BlockSink),
+	}
+
+	return r, nil
+}
+
+type castWriter struct {
+	r      *Recorder
+	stream string
+	code   string
+}
+
+func (cw castWriter) Write(b []byte) (int, error) {
+	cw.r.event(cw.stream, cw.code, b)
+	return len(b), nil
+}
+
+// event writes an event with the data, keeping aside an incomplete UTF-8
+// sequence at its end, since chunks can split a character in two
+func (r *Recorder) event(stream string, code string, b []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.err != nil {
+		return
+	}
+
+	data := append(r.tails[stream], b...)
+	cut := incompleteUTF8(data)
+	r.tails[stream] = append([]byte(nil), data[cut:]...)
+	r.writeEvent(code, data[:cut])
+}
+
+// writeEvent writes the data, if any, with the time elapsed since the
+// start of the recording; the lock is held so that the times never go back
+func (r *Recorder) writeEvent(code string, data []byte) {
+	if len(data) == 0 {
+		return
+	}
+
+	elapsed := time.Since(r.start).Seconds()
+	line, err := json.Marshal([]any{elapsed, code, string(data)})
+	if err != nil {
+		r.err = err
+		return
+	}
+	_, r.err = r.w.Write(append(line, '\n'))
+}
+
+// incompleteUTF8 returns the index where an incomplete
+// UTF-8 sequence at the end of b starts, or len(b)
+func incompleteUTF8(b []byte) int {
+	for i := len(b) - 1; i >= 0 && i >= len(b)-utf8.UTFMax; i-- {
+		if !utf8.RuneStart(b[i]) {
+			continue
+		}
+		if !utf8.FullRune(b[i:]) {
+			return i
+		}
+		break
+	}
+	return len(b)
+}
+
+// Close stops recording, writing what is left of a character split by
+// the last chunk of a stream, and returns the first error encountered
+// while writing the recording
+func (r *Recorder) Close() error {
+	for _, remove := range r.removes {
+		remove()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, cw := range r.writers {
+		if r.err != nil {
+			break
+		}
+		r.writeEvent(cw.code, r.tails[cw.stream])
+		delete(r.tails, cw.stream)
+	}
+
+	return r.err
+}
+
+// PlayCast reads an asciicast v2 recording from r and writes its output
+// events to w, waiting between them as long as in the recording divided by
+// speed: 1 is real time, 2 is twice as fast, and 0 or less writes
+// everything without waiting. Input events are skipped
+func PlayCast(r io.Reader, w io.Writer, speed float64) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	if !sc.Scan() {
+		if err := sc.Err(); err != nil {
+			return err
+		}
+		return errors.New("empty recording")
+	}
+
+	var header CastHeader
+	if err := json.Unmarshal(sc.Bytes(), &header); err != nil {
+		return fmt.Errorf("invalid recording header: %w", err)
+	}
+	if header.Version != 2 {
+		return fmt.Errorf("unsupported recording version %d", header.Version)
+	}
+
+	start := time.Now()
+	for n := 2; sc.Scan(); n++ {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+
+		var event []any
+		if err := json.Unmarshal(sc.Bytes(), &event); err != nil {
+			return fmt.Errorf("invalid event at line %d: %w", n, err)
+		}
+		if len(event) != 3 {
+			return fmt.Errorf("invalid event at line %d", n)
+		}
+
+		elapsed, ok1 := event[0].(float64)
+		code, ok2 := event[1].(string)
+		data, ok3 := event[2].(string)
+		if !ok1 || !ok2 || !ok3 {
+			return fmt.Errorf("invalid event at line %d", n)
+		}
+
+		if code != "o" {
+			continue
+		}
+
+		if speed > 0 {
+			at := start.Add(time.Duration(elapsed / speed * float64(time.Second)))
+			time.Sleep(time.Until(at))
+		}
+
+		if _, err := io.WriteString(w, data); err != nil {
+			return err
+		}
+	}
+
+	return sc.Err()
+}
@@ -0,0 +1,123 @@
+//go:build !windows
+
+package process
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCastRoundTrip(t *testing.T) {
+	p := newShell(t, `printf 'hello\n'; printf 'err\n' >&2; read -r line; printf '%s\n' "$line"`)
+
+	var rec bytes.Buffer
+	r, err := NewRecorder(p, &rec, CastHeader{Title: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := p.Start(nil, DevNull(), DevNull()); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SendInput([]byte("world\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Wait().Error(); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	sc := bufio.NewScanner(bytes.NewReader(rec.Bytes()))
+	sc.Scan()
+	var header CastHeader
+	if err := json.Unmarshal(sc.Bytes(), &header); err != nil {
+		t.Fatal(err)
+	}
+	if header.Version != 2 || header.Width != 80 || header.Height != 24 || header.Title != "test" {
+		t.Errorf("header = %+v", header)
+	}
+
+	var last float64
+	var input string
+	for sc.Scan() {
+		var event []any
+		if err := json.Unmarshal(sc.Bytes(), &event); err != nil {
+			t.Fatal(err)
+		}
+		elapsed := event[0].(float64)
+		if elapsed < last {
+			t.Errorf("event at %v after one at %v", elapsed, last)
+		}
+		last = elapsed
+		if event[1] == "i" {
+			input += event[2].(string)
+		}
+	}
+	if input != "world\n" {
+		t.Errorf("input = %q, want %q", input, "world\n")
+	}
+
+	var out strings.Builder
+	if err := PlayCast(bytes.NewReader(rec.Bytes()), &out, 0); err != nil {
+		t.Fatal(err)
+	}
+	// the order of stdout and stderr is not guaranteed
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	slices.Sort(lines)
+	if !slices.Equal(lines, []string{"err", "hello", "world"}) {
+		t.Errorf("played output = %q", out.String())
+	}
+}
+
+func TestCastSplitCharacter(t *testing.T) {
+	p := newShell(t, "true")
+
+	var rec bytes.Buffer
+	r, err := NewRecorder(p, &rec, CastHeader{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a character split in two chunks is written once complete,
+	// and an incomplete one at the end is written on Close,
+	// with a replacement character for each byte
+	euro := []byte("€")
+	stdout := r.writers[0]
+	stdout.Write([]byte{'a', euro[0]})
+	stdout.Write(euro[1:])
+	stdout.Write(euro[:2])
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var out strings.Builder
+	if err := PlayCast(bytes.NewReader(rec.Bytes()), &out, 0); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := out.String(), "a€\ufffd\ufffd"; got != want {
+		t.Errorf("played output = %q, want %q", got, want)
+	}
+}
+
+func TestPlayCastErrors(t *testing.T) {
+	tests := map[string]string{
+		"":                                "empty",
+		"{}\n":                            "version",
+		"not json\n":                      "header",
+		`{"version":2}` + "\n[1,\"o\"]\n": "line 2",
+		`{"version":2}` + "\n{}\n":        "line 2",
+	}
+
+	for rec, want := range tests {
+		err := PlayCast(strings.NewReader(rec), new(strings.Builder), 0)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("PlayCast(%q) = %v, want an error about %s", rec, err, want)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package process
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// DefaultCgroupParent is the parent directory of a Cgroup
+// without one, the root of the cgroup v2 hierarchy
+const DefaultCgroupParent = "/sys/fs/cgroup"
+
+// ErrCgroupUnsupported is returned by Start when a Process
+// has a Cgroup on a platform other than Linux
+var ErrCgroupUnsupported = errors.New("cgroups are not supported")
+
+// Cgroup is the cgroup v2 a Process is started in, supported only on
+// Linux. The directory is created, if it doesn't exist, and every run
+// gets its own leaf cgroup inside it, with the limits that are set, so
+// that the clones of the Process sharing the Cgroup are accounted and
+// limited separately; the child is then created directly inside its
+// leaf. When the Process has a Cgroup, Kill kills every process in the
+// leaf, including the stray descendants of the child. The leaf is
+// removed once the Process exits, and so is a directory created by
+// Start after the last run inside it; what still holds a stray process
+// is removed after a later run exits
+type Cgroup struct {
+	// Parent is the directory of the parent cgroup, DefaultCgroupParent
+	// if empty. The controllers of the limits set must be available
+	// to it, see cgroup.subtree_control
+	Parent string
+	// Name is the name of the cgroup directory, which is joined if
+	// it already exists
+	Name string
+	// MemoryMax is the memory.max limit, in bytes
+	MemoryMax *uint64
+	// CPUQuota is the CPU time the cgroup can use every CPUPeriod,
+	// written to cpu.max; for example 50ms every 100ms is half a core.
+	// It must be at least 1ms
+	CPUQuota time.Duration
+	// CPUPeriod is the period of CPUQuota, 100ms if zero, at least 1ms
+	CPUPeriod time.Duration
+	// PidsMax is the pids.max limit
+	PidsMax *uint64
+	// IOMax are the io.max limits of each device
+	IOMax []IOLimit
+}
+
+// IOLimit is the io.max limit of a block device, zero values mean
+// no limit
+type IOLimit struct {
+	// Device is the "major:minor" number of the device
+	Device    string
+	ReadBPS   uint64
+	WriteBPS  uint64
+	ReadIOPS  uint64
+	WriteIOPS uint64
+}
+
+// String returns the line written to io.max
+func (l IOLimit) String() string {
+	value := func(n uint64) string {
+		if n == 0 {
+			return "max"
+		}
+		return strconv.FormatUint(n, 10)
+	}
+	return fmt.Sprintf("%s rbps=%s wbps=%s riops=%s wiops=%s", l.Device,
+		value(l.ReadBPS), value(l.WriteBPS), value(l.ReadIOPS), value(l.WriteIOPS),
+	)
+}
+
+// CgroupStats are the counters of the Cgroup of a Process,
+// read from memory.events and cpu.stat after it has exited
+type CgroupStats struct {
+	// MemoryMaxEvents is the number of times memory.max was reached
+	MemoryMaxEvents uint64
+	// OOMEvents is the number of times the OOM killer was invoked
+	OOMEvents uint64
+	// OOMKills is the number of processes killed by the OOM killer
+	OOMKills uint64
+	// CPUUsage is the CPU time used by the cgroup
+	CPUUsage time.Duration
+	// Throttled is the number of periods the cgroup was throttled
+	// for exhausting its CPUQuota
+	Throttled uint64
+	// ThrottledTime is the total time the cgroup was throttled
+	ThrottledTime time.Duration
+}
@@ -0,0 +1,312 @@
+package process
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// cgroupRun is the leaf cgroup of a run of a Process, created inside
+// the directory of its Cgroup, which is shared by the clones
+type cgroupRun struct {
+	dir  string
+	path string
+	fd   *os.File
+}
+
+// cgroupDirs counts the runs inside each Cgroup directory, so that a
+// directory created by Start is removed only after the last one exits
+var cgroupDirs = struct {
+	sync.Mutex
+	m map[string]*cgroupDir
+}{m: make(map[string]*cgroupDir)}
+
+type cgroupDir struct {
+	runs    int
+	created bool
+	// stale are the leaves that could not be removed because
+	// a stray process was still inside them
+	stale []string
+}
+
+// acquireCgroupDir creates the directory, if it doesn't exist,
+// and counts a new run inside it
+func acquireCgroupDir(path string) error {
+	cgroupDirs.Lock()
+	defer cgroupDirs.Unlock()
+
+	d := cgroupDirs.m[path]
+	if d == nil {
+		d = new(cgroupDir)
+	}
+
+	err := os.Mkdir(path, 0755)
+	switch {
+	case err == nil:
+		d.created = true
+	case !errors.Is(err, fs.ErrExist):
+		return err
+	}
+
+	d.runs++
+	cgroupDirs.m[path] = d
+	return nil
+}
+
+// releaseCgroupDir removes the leaf of a run and, after the last run,
+// the directory if it was created by Start. What can't be removed
+// yet is retried the next time a run inside the directory exits
+func releaseCgroupDir(path, leaf string) {
+	cgroupDirs.Lock()
+	defer cgroupDirs.Unlock()
+
+	d := cgroupDirs.m[path]
+	d.runs--
+	if leaf != "" {
+		d.stale = append(d.stale, leaf)
+	}
+	d.stale = slices.DeleteFunc(d.stale, func(leaf string) bool {
+		err := os.Remove(leaf)
+		return err == nil || errors.Is(err, fs.ErrNotExist)
+	})
+
+	if d.runs > 0 || len(d.stale) > 0 {
+		return
+	}
+	if d.created {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return
+		}
+	}
+	delete(cgroupDirs.m, path)
+}
+
+// prepareCgroup creates or joins the directory of the Cgroup of the
+// Process, creates the leaf of the run inside it with the limits and
+// sets the command to start the child inside the leaf
+func (p *Process) prepareCgroup() (*cgroupRun, error) {
+	cg := p.Cgroup
+	if cg == nil {
+		return nil, nil
+	}
+	if cg.Name == "" {
+		return nil, errors.New("missing cgroup name")
+	}
+
+	files, controllers, err := cg.limits()
+	if err != nil {
+		return nil, err
+	}
+
+	parent := cg.Parent
+	if parent == "" {
+		parent = DefaultCgroupParent
+	}
+	run := &cgroupRun{dir: filepath.Join(parent, cg.Name)}
+
+	if err := acquireCgroupDir(run.dir); err != nil {
+		return nil, err
+	}
+
+	run.path, err = os.MkdirTemp(run.dir, "run-")
+	if err != nil {
+		run.abort()
+		return nil, err
+	}
+
+	if err := applyCgroup(parent, run.dir, run.path, files, controllers, cg.IOMax); err != nil {
+		run.abort()
+		return nil, err
+	}
+
+	run.fd, err = os.Open(run.path)
+	if err != nil {
+		run.abort()
+		return nil, err
+	}
+
+	// the SysProcAttr of the Process is shared with its clones
+	attr := new(syscall.SysProcAttr)
+	if p.Exec.SysProcAttr != nil {
+		*attr = *p.Exec.SysProcAttr
+	}
+	attr.UseCgroupFD = true
+	attr.CgroupFD = int(run.fd.Fd())
+	p.Exec.SysProcAttr = attr
+
+	return run, nil
+}
+
+// minCPUPeriod is the minimum quota and period accepted by cpu.max
+const minCPUPeriod = time.Millisecond
+
+// limits returns the files to write for the limits of the
+// Cgroup, except io.max, and the controllers they need
+func (cg *Cgroup) limits() (map[string]string, []string, error) {
+	files := make(map[string]string)
+	var controllers []string
+
+	if cg.MemoryMax != nil {
+		files["memory.max"] = strconv.FormatUint(*cg.MemoryMax, 10)
+		controllers = append(controllers, "memory")
+	}
+	if cg.CPUQuota > 0 {
+		period := cg.CPUPeriod
+		if period <= 0 {
+			period = 100 * time.Millisecond
+		}
+		if cg.CPUQuota < minCPUPeriod || period < minCPUPeriod {
+			return nil, nil, fmt.Errorf("cpu quota and period must be at least %v", minCPUPeriod)
+		}
+		files["cpu.max"] = fmt.Sprintf("%d %d", cg.CPUQuota.Microseconds(), period.Microseconds())
+		controllers = append(controllers, "cpu")
+	}
+	if cg.PidsMax != nil {
+		files["pids.max"] = strconv.FormatUint(*cg.PidsMax, 10)
+		controllers = append(controllers, "pids")
+	}
+	if len(cg.IOMax) > 0 {
+		controllers = append(controllers, "io")
+	}
+	return files, controllers, nil
+}
+
+// applyCgroup enables the controllers from the parent down to the leaf
+// and writes the limits to the leaf
+func applyCgroup(parent, dir, leaf string, files map[string]string, controllers []string, ioMax []IOLimit) error {
+	if err := enableControllers(parent, dir, controllers); err != nil {
+		return err
+	}
+	if err := enableControllers(dir, leaf, controllers); err != nil {
+		return err
+	}
+
+	for _, file := range sortedKeys(files) {
+		if err := writeCgroupFile(leaf, file, files[file]); err != nil {
+			return err
+		}
+	}
+	for _, l := range ioMax {
+		if err := writeCgroupFile(leaf, "io.max", l.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// enableControllers enables in the parent the controllers that
+// are not yet available to the cgroup
+func enableControllers(parent, path string, controllers []string) error {
+	if len(controllers) == 0 {
+		return nil
+	}
+
+	data, err := os.ReadFile(filepath.Join(path, "cgroup.controllers"))
+	if err != nil {
+		return err
+	}
+	available := strings.Fields(string(data))
+
+	var missing []string
+	for _, c := range controllers {
+		if !slices.Contains(available, c) {
+			missing = append(missing, "+"+c)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	return writeCgroupFile(parent, "cgroup.subtree_control", strings.Join(missing, " "))
+}
+
+func writeCgroupFile(dir, file, value string) error {
+	return os.WriteFile(filepath.Join(dir, file), []byte(value), 0)
+}
+
+// readCgroupFile reads the "key value" lines of a cgroup file
+func readCgroupFile(dir, file string) (map[string]uint64, error) {
+	f, err := os.Open(filepath.Join(dir, file))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	values := make(map[string]uint64)
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		key, value, ok := strings.Cut(sc.Text(), " ")
+		if !ok {
+			continue
+		}
+		if n, err := strconv.ParseUint(value, 10, 64); err == nil {
+			values[key] = n
+		}
+	}
+	return values, sc.Err()
+}
+
+// started releases the leaf once the child is inside it
+func (run *cgroupRun) started() {
+	if run != nil {
+		run.fd.Close()
+	}
+}
+
+// abort releases the cgroup when the child could not start
+func (run *cgroupRun) abort() {
+	if run == nil {
+		return
+	}
+	if run.fd != nil {
+		run.fd.Close()
+	}
+	releaseCgroupDir(run.dir, run.path)
+}
+
+// exited reads the counters of the leaf and removes it, along
+// with the directory if it was created by Start and it's empty
+func (run *cgroupRun) exited() *CgroupStats {
+	if run == nil {
+		return nil
+	}
+
+	stats := new(CgroupStats)
+	if events, err := readCgroupFile(run.path, "memory.events"); err == nil {
+		stats.MemoryMaxEvents = events["max"]
+		stats.OOMEvents = events["oom"]
+		stats.OOMKills = events["oom_kill"]
+	}
+	if cpu, err := readCgroupFile(run.path, "cpu.stat"); err == nil {
+		stats.CPUUsage = time.Duration(cpu["usage_usec"]) * time.Microsecond
+		stats.Throttled = cpu["nr_throttled"]
+		stats.ThrottledTime = time.Duration(cpu["throttled_usec"]) * time.Microsecond
+	}
+
+	releaseCgroupDir(run.dir, run.path)
+	return stats
+}
+
+// kill kills every process in the leaf, which holds only the child and
+// its descendants as it's created by the run. It reports false if
+// cgroup.kill is not supported by the kernel
+func (run *cgroupRun) kill() (bool, error) {
+	if run == nil {
+		return false, nil
+	}
+
+	err := writeCgroupFile(run.path, "cgroup.kill", "1")
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	return true, err
+}
@@ -0,0 +1,215 @@
+package process
+
+import (
+	"bufio"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCgroupParent returns a new cgroup inside the one of the test,
+// skipping the test if the cgroup v2 hierarchy is not delegated to it
+func testCgroupParent(t *testing.T) string {
+	t.Helper()
+
+	var mount string
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		t.Skip(err)
+	}
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		for i, field := range fields {
+			if field == "-" && i+1 < len(fields) && fields[i+1] == "cgroup2" {
+				mount = fields[4]
+			}
+		}
+	}
+	f.Close()
+	if mount == "" {
+		t.Skip("cgroup v2 is not mounted")
+	}
+
+	data, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		t.Skip(err)
+	}
+	var self string
+	for _, line := range strings.Split(string(data), "\n") {
+		if path, ok := strings.CutPrefix(line, "0::"); ok {
+			self = path
+		}
+	}
+
+	parent, err := os.MkdirTemp(filepath.Join(mount, self), "process-test-")
+	if err != nil {
+		t.Skipf("cgroup v2 is not delegated: %v", err)
+	}
+	t.Cleanup(func() { os.Remove(parent) })
+
+	if _, err := os.Stat(filepath.Join(parent, "cgroup.kill")); err != nil {
+		t.Skip("cgroup.kill is not supported")
+	}
+	return parent
+}
+
+func cgroupLeaves(t *testing.T, dir string) []string {
+	t.Helper()
+
+	leaves, err := filepath.Glob(filepath.Join(dir, "run-*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaves
+}
+
+func cgroupExists(dir string) bool {
+	_, err := os.Stat(dir)
+	return !errors.Is(err, fs.ErrNotExist)
+}
+
+func TestCgroupLeafPerRun(t *testing.T) {
+	parent := testCgroupParent(t)
+	dir := filepath.Join(parent, "leaf")
+
+	a := newShell(t, "exec sleep 10")
+	a.Cgroup = &Cgroup{Parent: parent, Name: "leaf"}
+	b := a.Clone()
+	t.Cleanup(func() { b.Close() })
+
+	for _, p := range []*Process{a, b} {
+		if err := p.Start(DevNull(), nil, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if leaves := cgroupLeaves(t, dir); len(leaves) != 2 {
+		t.Fatalf("leaves = %v, want one for each run", leaves)
+	}
+
+	// killing a clone leaves the other one running
+	a.Kill()
+	a.Wait()
+	if !b.IsRunning() {
+		t.Fatal("the kill of a clone stopped the other one")
+	}
+	if leaves := cgroupLeaves(t, dir); len(leaves) != 1 {
+		t.Errorf("leaves after the first exit = %v, want one", leaves)
+	}
+
+	b.Kill()
+	b.Wait()
+	waitFor(t, "the cgroup removal", func() bool { return !cgroupExists(dir) })
+}
+
+func TestCgroupKillStray(t *testing.T) {
+	parent := testCgroupParent(t)
+	dir := filepath.Join(parent, "stray")
+
+	p := newShell(t, "sleep 10 >/dev/null 2>&1 & echo $!; exec sleep 10")
+	p.Cgroup = &Cgroup{Parent: parent, Name: "stray"}
+
+	lines := make(chan string, 1)
+	if err := p.Start(DevNull(), &lineWriter{lines: lines}, nil); err != nil {
+		t.Fatal(err)
+	}
+	var pid string
+	select {
+	case pid = <-lines:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no pid from the child")
+	}
+
+	if err := p.Kill(); err != nil {
+		t.Fatal(err)
+	}
+	p.Wait()
+	waitFor(t, "the stray process to be killed", func() bool {
+		data, err := os.ReadFile("/proc/" + pid + "/stat")
+		// a zombie is dead but not yet reaped
+		_, stat, _ := strings.Cut(string(data), ") ")
+		return err != nil || strings.HasPrefix(stat, "Z")
+	})
+
+	// the leaf can be left behind by the stray process until it's reaped
+	for _, leaf := range cgroupLeaves(t, dir) {
+		waitFor(t, "the stray process to be reaped", func() bool {
+			data, err := os.ReadFile(filepath.Join(leaf, "cgroup.events"))
+			return err != nil || strings.Contains(string(data), "populated 0")
+		})
+	}
+	next := newShell(t, "true")
+	next.Cgroup = p.Cgroup
+	if _, err := next.Run(DevNull(), nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if cgroupExists(dir) {
+		t.Errorf("the cgroup %s was not removed", dir)
+	}
+}
+
+func TestCgroupStrayLeafRemovedLater(t *testing.T) {
+	parent := testCgroupParent(t)
+	dir := filepath.Join(parent, "later")
+
+	p := newShell(t, "sleep 0.3 >/dev/null 2>&1 &")
+	p.Cgroup = &Cgroup{Parent: parent, Name: "later"}
+	if _, err := p.Run(DevNull(), nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	leaves := cgroupLeaves(t, dir)
+	if len(leaves) != 1 {
+		t.Fatalf("leaves = %v, want the one of the stray process", leaves)
+	}
+	// the exited process is counted until it's reaped
+	waitFor(t, "the stray process to exit", func() bool {
+		data, err := os.ReadFile(filepath.Join(leaves[0], "cgroup.events"))
+		return err == nil && strings.Contains(string(data), "populated 0")
+	})
+
+	// the leaf is removed when the next run inside the cgroup exits
+	next := newShell(t, "true")
+	next.Cgroup = p.Cgroup
+	if _, err := next.Run(DevNull(), nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if cgroupExists(dir) {
+		t.Errorf("the cgroup %s was not removed", dir)
+	}
+}
+
+func TestCgroupExistingKept(t *testing.T) {
+	parent := testCgroupParent(t)
+	dir := filepath.Join(parent, "existing")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Remove(dir) })
+
+	p := newShell(t, "true")
+	p.Cgroup = &Cgroup{Parent: parent, Name: "existing"}
+	if _, err := p.Run(DevNull(), nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if !cgroupExists(dir) {
+		t.Fatal("the existing cgroup was removed")
+	}
+	if leaves := cgroupLeaves(t, dir); len(leaves) != 0 {
+		t.Errorf("leaves = %v, want none", leaves)
+	}
+}
+
+func TestCgroupCPUQuotaMinimum(t *testing.T) {
+	p := newShell(t, "true")
+	p.Cgroup = &Cgroup{Parent: t.TempDir(), Name: "quota", CPUQuota: 500 * time.Nanosecond}
+
+	if err := p.Start(DevNull(), nil, nil); err == nil || !strings.Contains(err.Error(), "at least") {
+		t.Errorf("Start = %v, want the minimum quota error", err)
+	}
+}
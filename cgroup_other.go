@@ -0,0 +1,26 @@
+//go:build !linux
+
+package process
+
+type cgroupRun struct{}
+
+// prepareCgroup fails if the Process has a Cgroup, which
+// is supported only on Linux
+func (p *Process) prepareCgroup() (*cgroupRun, error) {
+	if p.Cgroup == nil {
+		return nil, nil
+	}
+	return nil, ErrCgroupUnsupported
+}
+
+func (run *cgroupRun) started() {}
+
+func (run *cgroupRun) abort() {}
+
+func (run *cgroupRun) exited() *CgroupStats {
+	return nil
+}
+
+func (run *cgroupRun) kill() (bool, error) {
+	return false, nil
+}
@@ -0,0 +1,488 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nixpare/process/daemon"
+)
+
+type client struct {
+	http    *http.Client
+	socket  string
+	jsonOut bool
+}
+
+type command struct {
+	usage string
+	run   func(c *client, args []string) error
+}
+
+var commands = map[string]command{
+	"ls":      {"ls", listCmd},
+	"status":  {"status NAME", statusCmd},
+	"start":   {"start NAME...", startCmd},
+	"stop":    {"stop [--timeout 10s] NAME...", stopCmd},
+	"restart": {"restart [--timeout 10s] NAME...", restartCmd},
+	"kill":    {"kill [-s SIGNAL] NAME...", killCmd},
+	"logs":    {"logs [-f] [--since 10m] [--tail N] [--stream stdout|stderr] NAME", logsCmd},
+	"send":    {"send NAME TEXT...", sendCmd},
+	"attach":  {"attach NAME", attachCmd},
+}
+
+var commandOrder = []string{"ls", "status", "start", "stop", "restart", "kill", "logs", "send", "attach"}
+
+func defaultSocket() string {
+	if path := os.Getenv("PROCCTL_SOCKET"); path != "" {
+		return path
+	}
+	return daemon.DefaultSocket()
+}
+
+func main() {
+	socket := flag.String("socket", defaultSocket(), "path of the daemon socket, also set with PROCCTL_SOCKET")
+	jsonOut := flag.Bool("json", false, "print the responses of the daemon as JSON")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), help())
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command \"%s\"\n", flag.Arg(0))
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	c := &client{
+		http: &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", *socket)
+			},
+		}},
+		socket:  *socket,
+		jsonOut: *jsonOut,
+	}
+
+	if err := cmd.run(c, flag.Args()[1:]); err != nil {
+		fmt.Fprintf(os.Stderr, "procctl: %v\n", err)
+		if errors.Is(err, errUsage) {
+			fmt.Fprintf(os.Stderr, "Usage: procctl %s\n", cmd.usage)
+			os.Exit(2)
+		}
+		os.Exit(1)
+	}
+}
+
+func help() string {
+	var b strings.Builder
+	b.WriteString("Usage: procctl [ --socket path ] [ --json ] COMMAND [ ARGS ]\n\nCommands:\n")
+	for _, name := range commandOrder {
+		fmt.Fprintf(&b, "  %s\n", commands[name].usage)
+	}
+	return b.String()
+}
+
+var errUsage = errors.New("invalid arguments")
+
+// do sends a request to the daemon and returns the response, converting
+// the error responses in errors
+func (c *client) do(ctx context.Context, method string, path string, query url.Values, body io.Reader) (*http.Response, error) {
+	u := "http://procd" + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		var opErr *net.OpError
+		if errors.As(err, &opErr) && opErr.Op == "dial" {
+			return nil, fmt.Errorf("no daemon listening on %s, see --socket: %w", c.socket, opErr.Err)
+		}
+		return nil, err
+	}
+
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&apiErr) != nil || apiErr.Error == "" {
+			apiErr.Error = resp.Status
+		}
+		return nil, errors.New(apiErr.Error)
+	}
+
+	return resp, nil
+}
+
+// call sends a request to the daemon and decodes the JSON response
+// into v, printing it instead if the JSON output is enabled
+func (c *client) call(method string, path string, query url.Values, body io.Reader, v any) (printed bool, err error) {
+	resp, err := c.do(context.Background(), method, path, query, body)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return false, err
+	}
+
+	if c.jsonOut {
+		os.Stdout.Write(data)
+		return true, nil
+	}
+	if v == nil || len(data) == 0 {
+		return false, nil
+	}
+	return false, json.Unmarshal(data, v)
+}
+
+func processPath(name string, action string) string {
+	path := "/processes/" + url.PathEscape(name)
+	if action != "" {
+		path += "/" + action
+	}
+	return path
+}
+
+func listCmd(c *client, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+
+	var infos []daemon.ProcessInfo
+	printed, err := c.call(http.MethodGet, "/processes", nil, nil, &infos)
+	if err != nil || printed {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tSTATE\tPID\tREADY\tRESTARTS\tSINCE\tEXIT")
+	for _, info := range infos {
+		pid, exit := "-", "-"
+		if info.PID != 0 {
+			pid = strconv.Itoa(info.PID)
+		}
+		if info.ExitCode != nil {
+			exit = strconv.Itoa(*info.ExitCode)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%t\t%d\t%s\t%s\n", info.Name, info.State, pid, info.Ready, info.Restarts, since(info), exit)
+	}
+	return tw.Flush()
+}
+
+// since returns how long the process has been in its state
+func since(info daemon.ProcessInfo) string {
+	t := info.StartedAt
+	if info.State != daemon.StateRunning && info.ExitedAt != nil {
+		t = info.ExitedAt
+	}
+	if t == nil {
+		return "-"
+	}
+	return time.Since(*t).Round(time.Second).String()
+}
+
+func statusCmd(c *client, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+
+	var info daemon.ProcessInfo
+	printed, err := c.call(http.MethodGet, processPath(args[0], ""), nil, nil, &info)
+	if err != nil || printed {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "Name:\t%s\n", info.Name)
+	fmt.Fprintf(tw, "State:\t%s\n", info.State)
+	if info.PID != 0 {
+		fmt.Fprintf(tw, "PID:\t%d\n", info.PID)
+	}
+	fmt.Fprintf(tw, "Ready:\t%t\n", info.Ready)
+	fmt.Fprintf(tw, "Restarts:\t%d\n", info.Restarts)
+	if info.StartedAt != nil {
+		fmt.Fprintf(tw, "Started:\t%s\n", info.StartedAt.Local().Format(time.DateTime))
+	}
+	if info.ExitedAt != nil {
+		fmt.Fprintf(tw, "Exited:\t%s\n", info.ExitedAt.Local().Format(time.DateTime))
+	}
+	if info.ExitCode != nil {
+		fmt.Fprintf(tw, "Exit code:\t%d\n", *info.ExitCode)
+	}
+	if info.Error != "" {
+		fmt.Fprintf(tw, "Error:\t%s\n", info.Error)
+	}
+	if spec := info.Spec; spec != nil {
+		fmt.Fprintf(tw, "Command:\t%s\n", strings.Join(append([]string{spec.Exec}, spec.Args...), " "))
+		if spec.Dir != "" {
+			fmt.Fprintf(tw, "Directory:\t%s\n", spec.Dir)
+		}
+		if spec.Restart != nil {
+			fmt.Fprintf(tw, "Restart:\t%s\n", spec.Restart.Mode)
+		}
+	}
+	return tw.Flush()
+}
+
+// action sends the same action to every process,
+// printing the resulting state of each one
+func (c *client) action(names []string, action string, query url.Values) error {
+	if len(names) == 0 {
+		return errUsage
+	}
+
+	var errs []error
+	for _, name := range names {
+		var info daemon.ProcessInfo
+		printed, err := c.call(http.MethodPost, processPath(name, action), query, nil, &info)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+			continue
+		}
+
+		if !printed {
+			if info.PID != 0 {
+				fmt.Printf("%s: %s (pid %d)\n", info.Name, info.State, info.PID)
+			} else {
+				fmt.Printf("%s: %s\n", info.Name, info.State)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func startCmd(c *client, args []string) error {
+	return c.action(args, "start", nil)
+}
+
+func timeoutFlags(name string, args []string) (url.Values, []string, error) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	timeout := fs.Duration("timeout", 0, "time given to the process to exit before being killed")
+	names, err := parseArgs(fs, args)
+	if err != nil {
+		return nil, nil, errUsage
+	}
+
+	query := url.Values{}
+	if *timeout > 0 {
+		query.Set("timeout", timeout.String())
+	}
+	return query, names, nil
+}
+
+// parseArgs parses the flags of a command, even when they come after the
+// positional arguments, which are returned. Everything after "--" is
+// a positional argument
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+
+		rest := fs.Args()
+		if len(rest) == 0 {
+			return positional, nil
+		}
+		if n := len(args) - len(rest); n > 0 && args[n-1] == "--" {
+			return append(positional, rest...), nil
+		}
+
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+}
+
+func stopCmd(c *client, args []string) error {
+	query, names, err := timeoutFlags("stop", args)
+	if err != nil {
+		return err
+	}
+	return c.action(names, "stop", query)
+}
+
+func restartCmd(c *client, args []string) error {
+	query, names, err := timeoutFlags("restart", args)
+	if err != nil {
+		return err
+	}
+	return c.action(names, "restart", query)
+}
+
+func killCmd(c *client, args []string) error {
+	fs := flag.NewFlagSet("kill", flag.ContinueOnError)
+	signal := fs.String("s", "TERM", "signal sent to the process")
+	names, err := parseArgs(fs, args)
+	if err != nil {
+		return errUsage
+	}
+
+	return c.action(names, "signal", url.Values{"signal": {*signal}})
+}
+
+func logsCmd(c *client, args []string) error {
+	fs := flag.NewFlagSet("logs", flag.ContinueOnError)
+	follow := fs.Bool("f", false, "keep following the output")
+	sinceFlag := fs.String("since", "", "show the lines written after a time (RFC 3339) or in the last duration")
+	tail := fs.Int("tail", -1, "show only the last N lines")
+	stream := fs.String("stream", "", "show only the stdout or stderr lines")
+	names, err := parseArgs(fs, args)
+	if err != nil || len(names) != 1 {
+		return errUsage
+	}
+
+	query := url.Values{}
+	if *follow {
+		query.Set("follow", "true")
+	}
+	if *sinceFlag != "" {
+		query.Set("since", *sinceFlag)
+	}
+	if *tail >= 0 {
+		query.Set("tail", strconv.Itoa(*tail))
+	}
+	if *stream != "" {
+		query.Set("stream", *stream)
+	}
+
+	return c.streamLogs(context.Background(), names[0], query)
+}
+
+// streamLogs prints the log lines of the process,
+// the stderr ones on the standard error
+func (c *client) streamLogs(ctx context.Context, name string, query url.Values) error {
+	resp, err := c.do(ctx, http.MethodGet, processPath(name, "logs"), query, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	sc := bufio.NewScanner(resp.Body)
+	sc.Buffer(nil, 1024*1024)
+	for sc.Scan() {
+		if c.jsonOut {
+			fmt.Println(sc.Text())
+			continue
+		}
+
+		var entry daemon.LogEntry
+		if err := json.Unmarshal(sc.Bytes(), &entry); err != nil {
+			return err
+		}
+
+		if entry.Stream == "stderr" {
+			fmt.Fprintln(os.Stderr, entry.Line)
+		} else {
+			fmt.Fprintln(os.Stdout, entry.Line)
+		}
+	}
+
+	if err := sc.Err(); err != nil && ctx.Err() == nil {
+		return err
+	}
+	return nil
+}
+
+func (c *client) send(name string, data []byte) error {
+	resp, err := c.do(context.Background(), http.MethodPost, processPath(name, "stdin"), nil, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func sendCmd(c *client, args []string) error {
+	if len(args) < 2 {
+		return errUsage
+	}
+
+	return c.send(args[0], []byte(strings.Join(args[1:], " ")+"\n"))
+}
+
+// attachCmd follows the output of the process and sends every line
+// read from the standard input, until the standard input is closed
+// (CTRL-D) which detaches from the process without stopping it
+func attachCmd(c *client, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	name := args[0]
+
+	var info daemon.ProcessInfo
+	if _, err := (&client{http: c.http}).call(http.MethodGet, processPath(name, ""), nil, nil, &info); err != nil {
+		return err
+	}
+	if info.State != daemon.StateRunning {
+		return fmt.Errorf("%s is not running", name)
+	}
+	fmt.Fprintf(os.Stderr, "Attached to %s (pid %d), press CTRL-D to detach\n", name, info.PID)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	logsErr := make(chan error, 1)
+	go func() {
+		logsErr <- c.streamLogs(ctx, name, url.Values{"follow": {"true"}, "tail": {"100"}})
+	}()
+
+	inputErr := make(chan error, 1)
+	go func() {
+		r := bufio.NewReader(os.Stdin)
+		for {
+			line, err := r.ReadBytes('\n')
+			if len(line) > 0 {
+				if err := c.send(name, line); err != nil {
+					inputErr <- err
+					return
+				}
+			}
+			if err != nil {
+				if err == io.EOF {
+					err = nil
+				}
+				inputErr <- err
+				return
+			}
+		}
+	}()
+
+	select {
+	case err := <-inputErr:
+		fmt.Fprintf(os.Stderr, "Detached from %s\n", name)
+		return err
+	case err := <-logsErr:
+		return err
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"flag"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		args    []string
+		names   []string
+		timeout time.Duration
+	}{
+		{[]string{"web", "-timeout", "5s"}, []string{"web"}, 5 * time.Second},
+		{[]string{"-timeout=5s", "web", "db"}, []string{"web", "db"}, 5 * time.Second},
+		{[]string{"web", "--timeout", "5s", "db"}, []string{"web", "db"}, 5 * time.Second},
+		{[]string{"web", "--", "-timeout"}, []string{"web", "-timeout"}, 0},
+	}
+
+	for _, tt := range tests {
+		fs := flag.NewFlagSet("stop", flag.ContinueOnError)
+		timeout := fs.Duration("timeout", 0, "")
+
+		names, err := parseArgs(fs, tt.args)
+		if err != nil {
+			t.Errorf("parseArgs(%q): %v", tt.args, err)
+			continue
+		}
+		if !slices.Equal(names, tt.names) || *timeout != tt.timeout {
+			t.Errorf("parseArgs(%q) = %q, %v, want %q, %v", tt.args, names, *timeout, tt.names, tt.timeout)
+		}
+	}
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/nixpare/process"
+)
+
+var colors = []string{"\x1b[36m", "\x1b[33m", "\x1b[32m", "\x1b[35m", "\x1b[34m", "\x1b[31m"}
+
+const colorReset = "\x1b[0m"
+
+type procEntry struct {
+	name    string
+	command string
+}
+
+type concurrencyFlag map[string]int
+
+func (c concurrencyFlag) String() string {
+	return fmt.Sprint(map[string]int(c))
+}
+
+func (c concurrencyFlag) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		name, n, ok := strings.Cut(item, "=")
+		if !ok {
+			return fmt.Errorf("invalid concurrency \"%s\", expected name=N", item)
+		}
+
+		count, err := strconv.Atoi(n)
+		if err != nil || count < 0 {
+			return fmt.Errorf("invalid concurrency \"%s\", expected name=N", item)
+		}
+		c[strings.TrimSpace(name)] = count
+	}
+	return nil
+}
+
+func main() {
+	procfile := flag.String("f", "Procfile", "path of the Procfile")
+	envFile := flag.String("e", ".env", "path of the env file, ignored if missing")
+	basePort := flag.Int("p", 5000, "base port assigned to the processes")
+	timeout := flag.Duration("t", 5*time.Second, "time given to the processes to exit after CTRL-C")
+	concurrency := concurrencyFlag{}
+	flag.Var(concurrency, "c", "number of instances of each process, as name=N[,name=N...]")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), help())
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	entries, err := readProcfile(*procfile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read Procfile: %v\n", err)
+		os.Exit(1)
+	}
+
+	env, err := readEnvFile(*envFile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read env file: %v\n", err)
+		os.Exit(1)
+	}
+
+	for name := range concurrency {
+		if !hasEntry(entries, name) {
+			fmt.Fprintf(os.Stderr, "Unknown process \"%s\" in concurrency\n", name)
+			os.Exit(1)
+		}
+	}
+
+	wd := filepath.Dir(*procfile)
+	os.Exit(run(wd, entries, env, concurrency, *basePort, *timeout))
+}
+
+func help() string {
+	return `Usage: procrun [ -f Procfile ] [ -e .env ] [ -c name=N,... ] [ -p port ] [ -t timeout ]`
+}
+
+func hasEntry(entries []procEntry, name string) bool {
+	for _, e := range entries {
+		if e.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+type instance struct {
+	name string
+	p    *process.Process
+	out  *prefixWriter
+	err  *prefixWriter
+}
+
+func run(wd string, entries []procEntry, env []string, concurrency concurrencyFlag, basePort int, timeout time.Duration) int {
+	var instances []instance
+	for i, e := range entries {
+		n, ok := concurrency[e.name]
+		if !ok {
+			n = 1
+		}
+
+		for j := 0; j < n; j++ {
+			port := basePort + i*100 + j
+			instEnv := append(append(os.Environ(), env...), fmt.Sprintf("PORT=%d", port))
+
+			args := commandArgs(e.command, instEnv)
+			if len(args) == 0 {
+				fmt.Fprintf(os.Stderr, "Invalid command for \"%s\": empty command\n", e.name)
+				return 1
+			}
+
+			p, err := process.NewProcess(wd, args[0], args[1:]...)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Invalid command for \"%s\": %v\n", e.name, err)
+				return 1
+			}
+			p.Env = instEnv
+
+			instances = append(instances, instance{name: fmt.Sprintf("%s.%d", e.name, j+1), p: p})
+		}
+	}
+
+	if len(instances) == 0 {
+		fmt.Fprintln(os.Stderr, "No process to run")
+		return 1
+	}
+
+	width := 0
+	for _, inst := range instances {
+		width = max(width, len(inst.name))
+	}
+
+	out := &sharedOutput{}
+	g := process.NewGroup()
+	exited := make(chan process.ExitStatus, len(instances))
+
+	for i := range instances {
+		inst := &instances[i]
+		prefix := fmt.Sprintf("%s%-*s |%s ", colors[i%len(colors)], width, inst.name, colorReset)
+		inst.out = &prefixWriter{out: out, prefix: prefix}
+		inst.err = &prefixWriter{out: out, prefix: prefix}
+		g.Add(inst.p, nil, inst.out, inst.err)
+	}
+
+	ctrlC := process.ListenForCTRLC()
+	defer process.StopListenForCTRLC(ctrlC)
+	signal.Notify(ctrlC, syscall.SIGTERM)
+
+	if err := g.StartAll(); err != nil {
+		fmt.Fprintf(os.Stderr, "Startup error: %v\n", err)
+		return 1
+	}
+
+	for _, inst := range instances {
+		out.printf("%-*s | started with pid %d\n", width, inst.name, inst.p.PID())
+		go func(inst instance) {
+			status := inst.p.Wait()
+			inst.out.Flush()
+			inst.err.Flush()
+			exited <- status
+		}(inst)
+	}
+
+	remaining := len(instances)
+	code := 0
+	select {
+	case first := <-exited:
+		remaining--
+		code = statusCode(first, false)
+	case sig := <-ctrlC:
+		out.printf("%-*s | %v received, stopping all processes\n", width, "procrun", sig)
+	}
+
+	g.StopAll(timeout)
+
+	// collect the statuses of the processes stopped above
+	for i := 0; i < remaining; i++ {
+		if c := statusCode(<-exited, true); code == 0 {
+			code = c
+		}
+	}
+	return code
+}
+
+// statusCode returns the exit code of procrun for a process that exited,
+// zero if it didn't fail. A process killed by a signal gives 128 plus the
+// signal number, like in a shell, unless stopped is true and the signal is
+// the interrupt or the kill sent by StopAll
+func statusCode(status process.ExitStatus, stopped bool) int {
+	if sig, ok := status.Signal(); ok {
+		if stopped && (sig == syscall.SIGINT || sig == syscall.SIGKILL) {
+			return 0
+		}
+		return 128 + int(sig)
+	}
+
+	if status.Error() != nil {
+		return status.ExitCode
+	}
+	return 0
+}
+
+// commandArgs splits a Procfile command with ParseCommandArgs and expands
+// the variables of env, like $PORT, in each of the words. The variables
+// not in env are left as they are, for a shell run by the command
+func commandArgs(command string, env []string) []string {
+	args := process.ParseCommandArgs(command)
+	for i, arg := range args {
+		args[i] = os.Expand(arg, func(name string) string {
+			for j := len(env) - 1; j >= 0; j-- {
+				if key, value, ok := strings.Cut(env[j], "="); ok && key == name {
+					return value
+				}
+			}
+			return "$" + name
+		})
+	}
+	return args
+}
+
+func readProcfile(path string) ([]procEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []procEntry
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name, command, ok := strings.Cut(line, ":")
+		name, command = strings.TrimSpace(name), strings.TrimSpace(command)
+		if !ok || name == "" || command == "" {
+			return nil, fmt.Errorf("line %d: expected \"name: command\"", n)
+		}
+		if hasEntry(entries, name) {
+			return nil, fmt.Errorf("line %d: duplicated process \"%s\"", n, name)
+		}
+
+		entries = append(entries, procEntry{name: name, command: command})
+	}
+
+	return entries, sc.Err()
+}
+
+func readEnvFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var env []string
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected KEY=value", n)
+		}
+
+		value, err := envValue(value)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+
+		env = append(env, strings.TrimSpace(key)+"="+value)
+	}
+
+	return env, sc.Err()
+}
+
+// envValue returns the value of a line of the env file: a quoted value
+// follows the quoting rules of SplitCommand and must be a single word,
+// any other value is taken as it is
+func envValue(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" || (value[0] != '"' && value[0] != '\'') {
+		return value, nil
+	}
+
+	words, err := process.SplitCommand(value, nil)
+	if err != nil {
+		return "", err
+	}
+	if len(words) != 1 {
+		return "", errors.New("unexpected text after the quoted value")
+	}
+	return words[0], nil
+}
+
+// sharedOutput serializes the lines of all the processes on the standard output
+type sharedOutput struct {
+	mu sync.Mutex
+}
+
+func (out *sharedOutput) write(b []byte) {
+	out.mu.Lock()
+	defer out.mu.Unlock()
+
+	os.Stdout.Write(b)
+}
+
+func (out *sharedOutput) printf(format string, a ...any) {
+	out.write([]byte(fmt.Sprintf(format, a...)))
+}
+
+// prefixWriter writes every complete line with the process prefix,
+// the last incomplete one is written by Flush
+type prefixWriter struct {
+	out     *sharedOutput
+	prefix  string
+	mu      sync.Mutex
+	pending []byte
+}
+
+func (w *prefixWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.pending = append(w.pending, b...)
+	for {
+		i := bytes.IndexByte(w.pending, '\n')
+		if i < 0 {
+			break
+		}
+
+		line := make([]byte, 0, len(w.prefix)+i+1)
+		line = append(line, w.prefix...)
+		line = append(line, w.pending[:i+1]...)
+		w.out.write(line)
+
+		w.pending = w.pending[i+1:]
+	}
+
+	return len(b), nil
+}
+
+// Flush writes the incomplete line left, if any, terminating it
+func (w *prefixWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if len(w.pending) == 0 {
+		return
+	}
+
+	line := make([]byte, 0, len(w.prefix)+len(w.pending)+1)
+	line = append(line, w.prefix...)
+	line = append(line, w.pending...)
+	line = append(line, '\n')
+	w.out.write(line)
+
+	w.pending = nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestCommandArgs(t *testing.T) {
+	env := []string{"PORT=5000", "NAME=a b", "PORT=5100"}
+
+	tests := []struct {
+		command string
+		want    []string
+	}{
+		{"server --port $PORT", []string{"server", "--port", "5100"}},
+		{`server --name "$NAME"`, []string{"server", "--name", "a b"}},
+		{`echo "a  b" c\ d`, []string{"echo", "a  b", "c d"}},
+		{`server "C:\Program Files\app"`, []string{"server", `C:\Program Files\app`}},
+		{"echo $MISSING.", []string{"echo", "$MISSING."}},
+		{`sh -c 'kill $$'`, []string{"sh", "-c", "kill $$"}},
+		{"   ", []string{}},
+	}
+
+	for _, tt := range tests {
+		if got := commandArgs(tt.command, env); !slices.Equal(got, tt.want) {
+			t.Errorf("commandArgs(%q) = %q, want %q", tt.command, got, tt.want)
+		}
+	}
+}
+
+func TestReadProcfile(t *testing.T) {
+	path := writeFile(t, "Procfile", "# comment\n\nweb: server --port $PORT\nworker:  queue  work\n")
+
+	entries, err := readProcfile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []procEntry{{"web", "server --port $PORT"}, {"worker", "queue  work"}}
+	if !slices.Equal(entries, want) {
+		t.Errorf("entries = %v, want %v", entries, want)
+	}
+
+	for _, data := range []string{"web server\n", "web:\n", "web: a\nweb: b\n"} {
+		if _, err := readProcfile(writeFile(t, "Procfile", data)); err == nil {
+			t.Errorf("readProcfile(%q) succeeded", data)
+		}
+	}
+}
+
+func TestReadEnvFile(t *testing.T) {
+	path := writeFile(t, ".env", strings.Join([]string{
+		"# comment",
+		"PLAIN=a  b",
+		`DOUBLE="  two  spaces  "`,
+		`SINGLE='$HOME  \n'`,
+		`ESCAPED="say \"hi\""`,
+		"export EXPORTED=yes",
+		"EMPTY=",
+	}, "\n"))
+
+	env, err := readEnvFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"PLAIN=a  b",
+		"DOUBLE=  two  spaces  ",
+		`SINGLE=$HOME  \n`,
+		`ESCAPED=say "hi"`,
+		"EXPORTED=yes",
+		"EMPTY=",
+	}
+	if !slices.Equal(env, want) {
+		t.Errorf("env = %q, want %q", env, want)
+	}
+
+	for _, data := range []string{"NOVALUE\n", `KEY="open` + "\n", `KEY="a" "b"` + "\n"} {
+		if _, err := readEnvFile(writeFile(t, ".env", data)); err == nil {
+			t.Errorf("readEnvFile(%q) succeeded", data)
+		}
+	}
+
+	if env, err := readEnvFile(filepath.Join(t.TempDir(), "missing")); env != nil || err != nil {
+		t.Errorf("readEnvFile of a missing file = %q, %v, want nothing", env, err)
+	}
+}
+
+func TestConcurrencyFlag(t *testing.T) {
+	c := concurrencyFlag{}
+	if err := c.Set("web=2, worker=0"); err != nil {
+		t.Fatal(err)
+	}
+	if c["web"] != 2 || c["worker"] != 0 || len(c) != 2 {
+		t.Errorf("concurrency = %v", c)
+	}
+
+	for _, value := range []string{"web", "web=-1", "web=x"} {
+		if err := (concurrencyFlag{}).Set(value); err == nil {
+			t.Errorf("Set(%q) succeeded", value)
+		}
+	}
+}
+
+func writeFile(t *testing.T, name string, data string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
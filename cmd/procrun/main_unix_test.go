@@ -0,0 +1,25 @@
+//go:build !windows
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRunExitCode(t *testing.T) {
+	tests := []struct {
+		entries []procEntry
+		want    int
+	}{
+		{[]procEntry{{"ok", "true"}}, 0},
+		{[]procEntry{{"fail", "sh -c 'exit 3'"}, {"long", "sleep 10"}}, 3},
+		{[]procEntry{{"crash", `sh -c 'kill -SEGV $$'`}, {"long", "sleep 10"}}, 128 + 11},
+	}
+
+	for _, tt := range tests {
+		if got := run(t.TempDir(), tt.entries, nil, concurrencyFlag{}, 5000, time.Second); got != tt.want {
+			t.Errorf("run(%v) = %d, want %d", tt.entries, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,235 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"github.com/nixpare/broadcaster"
+)
+
+// Stream identifies one of the output streams of a Process
+type Stream int
+
+const (
+	StreamStdout Stream = iota
+	StreamStderr
+)
+
+func (p *Process) streamBroadcaster(stream Stream) *broadcaster.BufBroadcaster[[]byte] {
+	if stream == StreamStderr {
+		return p.errBc
+	}
+	return p.outBc
+}
+
+// ConnectOptions configures a Connection
+type ConnectOptions struct {
+	// Replay sends to the destination the lines that the source has
+	// already written in its current run when the Connection is created.
+	// Every line of the following runs is forwarded, including the ones
+	// written before the Connection subscribes again to the source
+	Replay bool
+	// QueueSize is the maximum number of lines kept while the destination
+	// is not running; when full, the oldest lines are discarded. Zero means
+	// DefaultConnectQueueSize
+	QueueSize int
+}
+
+// DefaultConnectQueueSize is the default ConnectOptions.QueueSize
+const DefaultConnectQueueSize = 1024
+
+// Connection forwards the lines of a Process to the standard input of
+// another one, see Connect
+type Connection struct {
+	src     *Process
+	dst     *Process
+	stream  Stream
+	opts    ConnectOptions
+	mu      sync.Mutex
+	queue   [][]byte
+	wake    chan struct{}
+	stop    chan struct{}
+	wg      sync.WaitGroup
+	once    sync.Once
+	dropped atomic.Uint64
+}
+
+// Connect forwards every line written by src on the given stream to the
+// standard input of dst, which must be started with a stdin pipe (see the
+// package documentation). Either Process can be restarted at any time:
+// the Connection subscribes again to src when it restarts, and keeps the
+// lines in a queue while dst is not running. The Connection ends when
+// it's closed or when src is closed
+func Connect(src *Process, dst *Process, stream Stream, opts ConnectOptions) *Connection {
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = DefaultConnectQueueSize
+	}
+
+	c := &Connection{
+		src:    src,
+		dst:    dst,
+		stream: stream,
+		opts:   opts,
+		wake:   make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+	}
+
+	// the first subscription is made before returning, so that no line
+	// is lost if src is started right after
+	old, l := src.streamBroadcaster(stream).Connect(0)
+	if !opts.Replay || !src.IsRunning() {
+		old = nil
+	}
+
+	c.wg.Add(2)
+	go c.readLoop(old, l)
+	go c.writeLoop()
+
+	return c
+}
+
+// Dropped returns the number of lines that were discarded because
+// the queue was full or dst can't receive input
+func (c *Connection) Dropped() uint64 {
+	return c.dropped.Load()
+}
+
+// Close stops forwarding the lines and waits for the Connection to end.
+// Lines still in the queue are discarded
+func (c *Connection) Close() {
+	c.once.Do(func() { close(c.stop) })
+	c.wg.Wait()
+}
+
+func (c *Connection) push(line []byte) {
+	c.mu.Lock()
+	if len(c.queue) >= c.opts.QueueSize {
+		c.queue = c.queue[1:]
+		c.dropped.Add(1)
+	}
+	c.queue = append(c.queue, line)
+	c.mu.Unlock()
+
+	select {
+	case c.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (c *Connection) pop() ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.queue) == 0 {
+		return nil, false
+	}
+
+	line := c.queue[0]
+	c.queue = c.queue[1:]
+	return line, true
+}
+
+// readLoop receives the lines of the source, subscribing again for each
+// of its runs, starting from the first subscription and its replayed lines
+func (c *Connection) readLoop(old [][]byte, l *broadcaster.Channel[[]byte]) {
+	defer c.wg.Done()
+	defer c.once.Do(func() { close(c.stop) })
+
+	bc := c.src.streamBroadcaster(c.stream)
+	for {
+		for _, line := range old {
+			c.push(line)
+		}
+
+	lines:
+		for {
+			select {
+			case line, ok := <-l.Ch():
+				if !ok {
+					break lines
+				}
+				c.push(line)
+			case <-c.stop:
+				l.Unregister()
+				return
+			}
+		}
+
+		if c.src.isClosed() {
+			return
+		}
+		// the listener is closed when the buffer is reset for a new
+		// run, so the lines already in the new one were never received
+		old, l = bc.Connect(0)
+	}
+}
+
+// waitRunning waits for a run of dst other than the failed one and
+// returns it, reporting false if the Connection is closed in the meantime
+func (c *Connection) waitRunning(failed uint64) (uint64, bool) {
+	for {
+		changed := c.dst.stateChanged()
+		if run, running := c.dst.currentRun(); running && run != failed {
+			return run, true
+		}
+
+		select {
+		case <-changed:
+		case <-c.stop:
+			return 0, false
+		}
+	}
+}
+
+func (c *Connection) writeLoop() {
+	defer c.wg.Done()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-c.stop
+		cancel()
+	}()
+
+	for {
+		select {
+		case <-c.wake:
+		case <-c.stop:
+			return
+		}
+
+		for {
+			line, ok := c.pop()
+			if !ok {
+				break
+			}
+
+			var failed uint64
+			for {
+				run, ok := c.waitRunning(failed)
+				if !ok {
+					return
+				}
+
+				data := append(append(make([]byte, 0, len(line)+1), line...), '\n')
+				err := c.dst.SendInputContext(ctx, data)
+				if err == nil {
+					break
+				}
+				if ctx.Err() != nil {
+					return
+				}
+				if errors.Is(err, ErrStdinNotPipe) {
+					c.dropped.Add(1)
+					break
+				}
+
+				// dst has exited while writing: wait for its restart,
+				// which may have already happened
+				failed = run
+			}
+		}
+	}
+}
@@ -0,0 +1,160 @@
+//go:build !windows
+
+package process
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// pipeLines returns a writer for the output of a Process and
+// the channel of the lines written to it
+func pipeLines(t *testing.T) (*os.File, <-chan string) {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		w.Close()
+		r.Close()
+	})
+
+	lines := make(chan string, 100)
+	go func() {
+		sc := bufio.NewScanner(r)
+		for sc.Scan() {
+			lines <- sc.Text()
+		}
+	}()
+	return w, lines
+}
+
+// lineWriter sends the first line written to it
+type lineWriter struct {
+	lines chan string
+	buf   strings.Builder
+}
+
+func (w *lineWriter) Write(b []byte) (int, error) {
+	w.buf.Write(b)
+	if line, _, ok := strings.Cut(w.buf.String(), "\n"); ok && w.lines != nil {
+		w.lines <- line
+		w.lines = nil
+	}
+	return len(b), nil
+}
+
+func expectLines(t *testing.T, lines <-chan string, want ...string) {
+	t.Helper()
+
+	for _, w := range want {
+		select {
+		case line := <-lines:
+			if line != w {
+				t.Fatalf("line = %q, want %q", line, w)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for %q", w)
+		}
+	}
+}
+
+func TestConnectSourceRestart(t *testing.T) {
+	out, lines := pipeLines(t)
+	dst := newShell(t, `while read -r l; do echo "got $l"; done`)
+	if err := dst.Start(nil, out, nil); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		dst.Kill()
+		dst.Wait()
+	})
+
+	// the source writes as soon as it starts, racing with the
+	// Connection subscribing again to it
+	src := newShell(t, "echo a; echo b")
+	c := Connect(src, dst, StreamStdout, ConnectOptions{})
+	defer c.Close()
+
+	for range 3 {
+		if _, err := src.Run(DevNull(), nil, nil); err != nil {
+			t.Fatal(err)
+		}
+		expectLines(t, lines, "got a", "got b")
+	}
+}
+
+func TestConnectReplay(t *testing.T) {
+	out, lines := pipeLines(t)
+	dst := newShell(t, `while read -r l; do echo "got $l"; done`)
+	if err := dst.Start(nil, out, nil); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		dst.Kill()
+		dst.Wait()
+	})
+
+	src := newShell(t, "echo early; read -r _; echo late")
+	early := make(chan string, 1)
+	if err := src.Start(nil, &lineWriter{lines: early}, nil); err != nil {
+		t.Fatal(err)
+	}
+	<-early
+
+	c := Connect(src, dst, StreamStdout, ConnectOptions{Replay: true})
+	defer c.Close()
+	src.SendText("")
+	src.Wait()
+
+	expectLines(t, lines, "got early", "got late")
+}
+
+func TestConnectDestinationRestart(t *testing.T) {
+	out, lines := pipeLines(t)
+	dst := newShell(t, `while read -r l; do echo "got $l"; done`)
+
+	src := newShell(t, "while read -r l; do echo $l; done")
+	if err := src.Start(nil, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		src.Kill()
+		src.Wait()
+	})
+
+	c := Connect(src, dst, StreamStdout, ConnectOptions{})
+	defer c.Close()
+
+	// the lines written while the destination is not running are queued
+	send := func(text ...string) {
+		for _, line := range text {
+			if err := src.SendText(line); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	send("one")
+	for _, batch := range [][]string{{"two", "three"}, {"four"}} {
+		if err := dst.Start(nil, out, nil); err != nil {
+			t.Fatal(err)
+		}
+		expectLines(t, lines, "got one")
+		send(batch...)
+		for _, line := range batch {
+			expectLines(t, lines, "got "+line)
+		}
+
+		dst.Kill()
+		dst.Wait()
+		send("one")
+	}
+	if n := c.Dropped(); n != 0 {
+		t.Errorf("Dropped = %d, want 0", n)
+	}
+}
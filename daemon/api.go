@@ -0,0 +1,304 @@
+package daemon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// routes builds the HTTP API of the Daemon:
+//
+//	GET  /processes                 list the processes
+//	GET  /processes/{name}          describe a process, with its spec
+//	POST /processes/{name}/start    start a process
+//	POST /processes/{name}/stop     stop a process, ?timeout=10s
+//	POST /processes/{name}/restart  restart a process, ?timeout=10s
+//	POST /processes/{name}/signal   send a signal, ?signal=TERM
+//	POST /processes/{name}/stdin    send the body to the standard input, ?close=true closes it
+//	GET  /processes/{name}/logs     stream the output, ?follow=true&since=5m&tail=100&stream=stderr
+//	GET  /events                    stream the lifecycle events, ?name=web&since=5m
+//
+// Every response is a JSON value, except for the streams which are
+// a sequence of JSON values, one per line. Errors are returned as
+// {"error": "message"} with the matching status code
+func (d *Daemon) routes() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /processes", d.read(d.handleList))
+	mux.HandleFunc("GET /processes/{name}", d.read(d.handleDescribe))
+	mux.HandleFunc("POST /processes/{name}/start", d.write(d.handleStart))
+	mux.HandleFunc("POST /processes/{name}/stop", d.write(d.handleStop))
+	mux.HandleFunc("POST /processes/{name}/restart", d.write(d.handleRestart))
+	mux.HandleFunc("POST /processes/{name}/signal", d.write(d.handleSignal))
+	mux.HandleFunc("POST /processes/{name}/stdin", d.write(d.handleStdin))
+	mux.HandleFunc("GET /processes/{name}/logs", d.read(d.handleLogs))
+	mux.HandleFunc("GET /events", d.read(d.handleEvents))
+	return mux
+}
+
+// ServeHTTP serves the API of the Daemon
+func (d *Daemon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.mux.ServeHTTP(w, r)
+}
+
+func (d *Daemon) read(h http.HandlerFunc) http.HandlerFunc {
+	return requireAccess(accessRead, h)
+}
+
+func (d *Daemon) write(h http.HandlerFunc) http.HandlerFunc {
+	return requireAccess(accessWrite, h)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, ErrRunning), errors.Is(err, ErrNotRunning):
+		status = http.StatusConflict
+	case errors.Is(err, ErrClosed):
+		status = http.StatusServiceUnavailable
+	case errors.Is(err, errBadRequest):
+		status = http.StatusBadRequest
+	}
+
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+var errBadRequest = errors.New("bad request")
+
+func badRequest(format string, a ...any) error {
+	return fmt.Errorf("%w: %s", errBadRequest, fmt.Sprintf(format, a...))
+}
+
+func (d *Daemon) handleList(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, d.List())
+}
+
+func (d *Daemon) handleDescribe(w http.ResponseWriter, r *http.Request) {
+	info, err := d.Info(r.PathValue("name"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+func (d *Daemon) handleStart(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if err := d.Start(name); err != nil {
+		writeError(w, err)
+		return
+	}
+	d.handleDescribe(w, r)
+}
+
+func (d *Daemon) timeout(r *http.Request) (time.Duration, error) {
+	s := r.URL.Query().Get("timeout")
+	if s == "" {
+		return d.StopTimeout, nil
+	}
+
+	timeout, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, badRequest("invalid timeout \"%s\"", s)
+	}
+	return timeout, nil
+}
+
+func (d *Daemon) handleStop(w http.ResponseWriter, r *http.Request) {
+	timeout, err := d.timeout(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if _, err := d.Stop(r.PathValue("name"), timeout); err != nil {
+		writeError(w, err)
+		return
+	}
+	d.handleDescribe(w, r)
+}
+
+func (d *Daemon) handleRestart(w http.ResponseWriter, r *http.Request) {
+	timeout, err := d.timeout(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if err := d.Restart(r.PathValue("name"), timeout); err != nil {
+		writeError(w, err)
+		return
+	}
+	d.handleDescribe(w, r)
+}
+
+func (d *Daemon) handleSignal(w http.ResponseWriter, r *http.Request) {
+	signal := r.URL.Query().Get("signal")
+	if signal == "" {
+		writeError(w, badRequest("signal required"))
+		return
+	}
+
+	if err := d.Signal(r.PathValue("name"), signal); err != nil {
+		writeError(w, err)
+		return
+	}
+	d.handleDescribe(w, r)
+}
+
+func (d *Daemon) handleStdin(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, badRequest("%v", err))
+		return
+	}
+
+	if err := d.SendInput(r.Context(), r.PathValue("name"), data, r.URL.Query().Get("close") == "true"); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// parseSince parses a time either in RFC 3339 format or
+// as a duration before now
+func parseSince(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+
+	ago, err := time.ParseDuration(s)
+	if err != nil {
+		return time.Time{}, badRequest("invalid since \"%s\"", s)
+	}
+	return time.Now().Add(-ago), nil
+}
+
+func (d *Daemon) handleLogs(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	m, err := d.get(r.PathValue("name"))
+	d.mu.Unlock()
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	query := r.URL.Query()
+	since, err := parseSince(query.Get("since"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	tail := -1
+	if s := query.Get("tail"); s != "" {
+		tail, err = strconv.Atoi(s)
+		if err != nil || tail < 0 {
+			writeError(w, badRequest("invalid tail \"%s\"", s))
+			return
+		}
+	}
+
+	stream := query.Get("stream")
+	match := func(e LogEntry) bool {
+		return (stream == "" || e.Stream == stream) && !e.Time.Before(since)
+	}
+
+	entries, next, _, _ := m.logs.read(0)
+	var backlog []LogEntry
+	for _, e := range entries {
+		if match(e) {
+			backlog = append(backlog, e)
+		}
+	}
+	if tail >= 0 && len(backlog) > tail {
+		backlog = backlog[len(backlog)-tail:]
+	}
+
+	follow(w, r, m.logs, backlog, next, match, query.Get("follow") == "true")
+}
+
+func (d *Daemon) handleEvents(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	since, err := parseSince(query.Get("since"))
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	name := query.Get("name")
+	match := func(e Event) bool {
+		return (name == "" || e.Name == name) && !e.Time.Before(since)
+	}
+
+	var backlog []Event
+	next := d.events.end()
+	if !since.IsZero() {
+		var events []Event
+		events, next, _, _ = d.events.read(0)
+		for _, e := range events {
+			if match(e) {
+				backlog = append(backlog, e)
+			}
+		}
+	}
+
+	follow(w, r, d.events, backlog, next, match, true)
+}
+
+// follow streams the backlog and then, if live is true, every new
+// item of the journal starting from next, until the client disconnects
+// or the journal is closed
+func follow[T any](w http.ResponseWriter, r *http.Request, j *journal[T], backlog []T, next uint64, match func(T) bool, live bool) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+
+	for _, item := range backlog {
+		if enc.Encode(item) != nil {
+			return
+		}
+	}
+	if flusher != nil {
+		flusher.Flush()
+	}
+
+	for live {
+		items, n, changed, closed := j.read(next)
+		next = n
+
+		for _, item := range items {
+			if match(item) && enc.Encode(item) != nil {
+				return
+			}
+		}
+		if flusher != nil && len(items) > 0 {
+			flusher.Flush()
+		}
+		if closed {
+			return
+		}
+
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,295 @@
+//go:build !windows
+
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nixpare/process"
+)
+
+// serveShells serves a Daemon hosting a shell for each script, without
+// starting them, and returns a client with every access
+func serveShells(t *testing.T, scripts map[string]string) *http.Client {
+	t.Helper()
+
+	d := New()
+	for name, script := range scripts {
+		if err := d.Add(&process.Spec{Name: name, Exec: "sh", Args: []string{"-c", script}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return serve(t, d, 0600, 0600)
+}
+
+// call sends a request to the API and returns the status and the body
+func call(t *testing.T, client *http.Client, method string, path string, body string) (int, []byte) {
+	t.Helper()
+
+	req, err := http.NewRequest(method, "http://daemon"+path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, data
+}
+
+// callInfo sends a request that must return the ProcessInfo
+func callInfo(t *testing.T, client *http.Client, method string, path string) ProcessInfo {
+	t.Helper()
+
+	status, data := call(t, client, method, path, "")
+	if status != http.StatusOK {
+		t.Fatalf("%s %s: status %d: %s", method, path, status, data)
+	}
+
+	var info ProcessInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		t.Fatal(err)
+	}
+	return info
+}
+
+func waitState(t *testing.T, client *http.Client, name string, state State) ProcessInfo {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		info := callInfo(t, client, "GET", "/processes/"+name)
+		if info.State == state {
+			return info
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("state of %s = %s, want %s", name, info.State, state)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// stream returns the values streamed by a request, until the
+// end of the test or of the stream
+func stream[T any](t *testing.T, client *http.Client, path string) <-chan T {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(ctx, "GET", "http://daemon"+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s: status %d", path, resp.StatusCode)
+	}
+	t.Cleanup(func() {
+		cancel()
+		resp.Body.Close()
+	})
+
+	ch := make(chan T)
+	go func() {
+		defer close(ch)
+		dec := json.NewDecoder(resp.Body)
+		for {
+			var v T
+			if dec.Decode(&v) != nil {
+				return
+			}
+			select {
+			case ch <- v:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+func next[T any](t *testing.T, ch <-chan T) T {
+	t.Helper()
+
+	select {
+	case v, ok := <-ch:
+		if !ok {
+			t.Fatal("the stream ended")
+		}
+		return v
+	case <-time.After(5 * time.Second):
+		t.Fatal("nothing streamed")
+	}
+	panic("unreachable")
+}
+
+func TestAPIStartStop(t *testing.T) {
+	client := serveShells(t, map[string]string{"web": "exec sleep 10"})
+
+	if info := callInfo(t, client, "GET", "/processes/web"); info.State != StateCreated || info.Spec == nil {
+		t.Errorf("info before start = %+v", info)
+	}
+
+	info := callInfo(t, client, "POST", "/processes/web/start")
+	if info.State != StateRunning || info.PID == 0 {
+		t.Errorf("info after start = %+v", info)
+	}
+	if status, _ := call(t, client, "POST", "/processes/web/start", ""); status != http.StatusConflict {
+		t.Errorf("second start: status %d, want %d", status, http.StatusConflict)
+	}
+
+	if status, _ := call(t, client, "POST", "/processes/web/stop?timeout=soon", ""); status != http.StatusBadRequest {
+		t.Errorf("stop with an invalid timeout: status %d, want %d", status, http.StatusBadRequest)
+	}
+	info = callInfo(t, client, "POST", "/processes/web/stop?timeout=1s")
+	if info.State != StateStopped || info.ExitedAt == nil {
+		t.Errorf("info after stop = %+v", info)
+	}
+	if status, _ := call(t, client, "POST", "/processes/web/stop", ""); status != http.StatusConflict {
+		t.Errorf("second stop: status %d, want %d", status, http.StatusConflict)
+	}
+	if status, _ := call(t, client, "POST", "/processes/missing/start", ""); status != http.StatusNotFound {
+		t.Errorf("start of an unknown process: status %d, want %d", status, http.StatusNotFound)
+	}
+
+	var list []ProcessInfo
+	_, data := call(t, client, "GET", "/processes", "")
+	if err := json.Unmarshal(data, &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].Name != "web" || list[0].Spec != nil {
+		t.Errorf("list = %+v", list)
+	}
+}
+
+func TestAPIRestart(t *testing.T) {
+	client := serveShells(t, map[string]string{"web": "exec sleep 10"})
+
+	first := callInfo(t, client, "POST", "/processes/web/start")
+	second := callInfo(t, client, "POST", "/processes/web/restart?timeout=1s")
+	if second.State != StateRunning || second.PID == first.PID {
+		t.Errorf("info after restart = %+v, first pid %d", second, first.PID)
+	}
+}
+
+func TestAPISignal(t *testing.T) {
+	client := serveShells(t, map[string]string{"web": "trap 'exit 3' USR1; echo trapped; while :; do sleep 0.05; done"})
+
+	callInfo(t, client, "POST", "/processes/web/start")
+	logs := stream[LogEntry](t, client, "/processes/web/logs?follow=true")
+	next(t, logs)
+	for _, signal := range []string{"", "NOPE"} {
+		if status, _ := call(t, client, "POST", "/processes/web/signal?signal="+signal, ""); status != http.StatusBadRequest {
+			t.Errorf("signal %q: status %d, want %d", signal, status, http.StatusBadRequest)
+		}
+	}
+
+	callInfo(t, client, "POST", "/processes/web/signal?signal=usr1")
+	info := waitState(t, client, "web", StateExited)
+	if info.ExitCode == nil || *info.ExitCode != 3 {
+		t.Errorf("info after the signal = %+v, want exit code 3", info)
+	}
+
+	if status, _ := call(t, client, "POST", "/processes/web/signal?signal=TERM", ""); status != http.StatusConflict {
+		t.Errorf("signal to an exited process: status %d, want %d", status, http.StatusConflict)
+	}
+}
+
+func TestAPIStdinAndLogs(t *testing.T) {
+	client := serveShells(t, map[string]string{"cat": "echo started; echo warning >&2; cat"})
+
+	callInfo(t, client, "POST", "/processes/cat/start")
+	logs := stream[LogEntry](t, client, "/processes/cat/logs?follow=true&stream=stdout")
+	if e := next(t, logs); e.Line != "started" || e.Stream != "stdout" {
+		t.Errorf("first line = %+v", e)
+	}
+
+	if status, data := call(t, client, "POST", "/processes/cat/stdin", "hello\n"); status != http.StatusNoContent {
+		t.Fatalf("stdin: status %d: %s", status, data)
+	}
+	if e := next(t, logs); e.Line != "hello" {
+		t.Errorf("echoed line = %+v", e)
+	}
+
+	// cat exits once its input is closed
+	if status, data := call(t, client, "POST", "/processes/cat/stdin?close=true", "bye\n"); status != http.StatusNoContent {
+		t.Fatalf("stdin with close: status %d: %s", status, data)
+	}
+	if e := next(t, logs); e.Line != "bye" {
+		t.Errorf("last line = %+v", e)
+	}
+	waitState(t, client, "cat", StateExited)
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"started", "warning", "hello", "bye"}},
+		{"?stream=stderr", []string{"warning"}},
+		{"?tail=2", []string{"hello", "bye"}},
+		{"?since=1h", []string{"started", "warning", "hello", "bye"}},
+		{"?since=" + time.Now().Add(time.Hour).Format(time.RFC3339), nil},
+	}
+	for _, tt := range tests {
+		var lines []string
+		for e := range stream[LogEntry](t, client, "/processes/cat/logs"+tt.query) {
+			lines = append(lines, e.Line)
+		}
+		// the order of the two streams is not guaranteed
+		if strings.Join(sorted(lines), ",") != strings.Join(sorted(tt.want), ",") {
+			t.Errorf("logs%s = %q, want %q", tt.query, lines, tt.want)
+		}
+	}
+
+	for _, query := range []string{"?since=yesterday", "?tail=-1"} {
+		if status, _ := call(t, client, "GET", "/processes/cat/logs"+query, ""); status != http.StatusBadRequest {
+			t.Errorf("logs%s: status %d, want %d", query, status, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestAPIEvents(t *testing.T) {
+	client := serveShells(t, map[string]string{"web": "exec sleep 10", "db": "exec sleep 10"})
+
+	// the events since a time include the ones already published
+	events := stream[Event](t, client, "/events?name=web&since=1m")
+	if e := next(t, events); e.Type != EventAdded || e.Name != "web" {
+		t.Errorf("first event = %+v, want the web process added", e)
+	}
+
+	callInfo(t, client, "POST", "/processes/db/start")
+	started := callInfo(t, client, "POST", "/processes/web/start")
+	if e := next(t, events); e.Type != EventStarted || e.PID != started.PID {
+		t.Errorf("event after start = %+v, want started with pid %d", e, started.PID)
+	}
+
+	callInfo(t, client, "POST", "/processes/web/stop?timeout=1s")
+	if e := next(t, events); e.Type != EventExited || e.PID != started.PID || e.ExitCode == nil {
+		t.Errorf("event after stop = %+v, want exited", e)
+	}
+
+	if status, _ := call(t, client, "GET", "/events?since=yesterday", ""); status != http.StatusBadRequest {
+		t.Errorf("events with an invalid since: status %d, want %d", status, http.StatusBadRequest)
+	}
+}
+
+func sorted(lines []string) []string {
+	lines = append([]string(nil), lines...)
+	slices.Sort(lines)
+	return lines
+}
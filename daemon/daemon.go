@@ -0,0 +1,510 @@
+// Package daemon hosts named processes in a long-running program, like
+// a process manager, and exposes them through a JSON HTTP API usually
+// served on a unix domain socket.
+//
+// Processes are described by a process.Spec: the Daemon restarts them
+// following their restart policy and keeps their recent output lines
+// and lifecycle events, which clients can read and follow. Processes
+// are not tied to the clients, which can disconnect at any time
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/nixpare/process"
+)
+
+var (
+	ErrNotFound   = errors.New("process not found")
+	ErrExists     = errors.New("process already exists")
+	ErrRunning    = errors.New("process already running")
+	ErrNotRunning = errors.New("process not running")
+	ErrClosed     = errors.New("daemon closed")
+)
+
+const (
+	// DefaultLogSize is the number of output lines kept for each process
+	DefaultLogSize = 1000
+	// DefaultEventSize is the number of lifecycle events kept
+	DefaultEventSize = 1000
+)
+
+// Daemon hosts a set of named processes. It implements http.Handler,
+// see Serve for the API
+type Daemon struct {
+	// StopTimeout is the time given to a process to exit after the
+	// CTRL-C event when the client doesn't specify one
+	StopTimeout time.Duration
+
+	mu      sync.Mutex
+	procs   map[string]*managed
+	names   []string
+	logSize int
+	events  *journal[Event]
+	mux     *http.ServeMux
+	servers []*http.Server
+	closed  bool
+}
+
+// managed is a process hosted by the Daemon
+type managed struct {
+	name      string
+	spec      *process.Spec
+	p         *process.Process
+	logs      *journal[LogEntry]
+	outLines  *lineWriter
+	errLines  *lineWriter
+	gen       uint64
+	restarts  int
+	stopping  bool
+	restartT  *time.Timer
+	startedAt time.Time
+	exitedAt  time.Time
+	exit      *process.ExitStatus
+	// exited is closed once the exit of the current run is recorded
+	exited chan struct{}
+}
+
+// ProcessInfo describes the state of a process hosted by the Daemon
+type ProcessInfo struct {
+	Name      string        `json:"name"`
+	State     State         `json:"state"`
+	PID       int           `json:"pid,omitempty"`
+	Ready     bool          `json:"ready"`
+	Restarts  int           `json:"restarts"`
+	StartedAt *time.Time    `json:"started_at,omitempty"`
+	ExitedAt  *time.Time    `json:"exited_at,omitempty"`
+	ExitCode  *int          `json:"exit_code,omitempty"`
+	Error     string        `json:"error,omitempty"`
+	Spec      *process.Spec `json:"spec,omitempty"`
+}
+
+// State is the state of a process hosted by the Daemon
+type State string
+
+const (
+	StateCreated    State = "created"
+	StateRunning    State = "running"
+	StateRestarting State = "restarting"
+	StateStopped    State = "stopped"
+	StateExited     State = "exited"
+)
+
+// New creates a Daemon without processes
+func New() *Daemon {
+	d := &Daemon{
+		StopTimeout: 10 * time.Second,
+		procs:       make(map[string]*managed),
+		logSize:     DefaultLogSize,
+		events:      newJournal[Event](DefaultEventSize),
+	}
+	d.mux = d.routes()
+	return d
+}
+
+// Add creates the process described by spec, without starting it
+func (d *Daemon) Add(spec *process.Spec) error {
+	if spec.Name == "" {
+		return errors.New("process name required")
+	}
+
+	p, err := spec.NewProcess()
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		p.Close()
+		return ErrClosed
+	}
+	if _, ok := d.procs[spec.Name]; ok {
+		p.Close()
+		return fmt.Errorf("%w: \"%s\"", ErrExists, spec.Name)
+	}
+
+	m := &managed{
+		name: spec.Name,
+		spec: spec,
+		p:    p,
+		logs: newJournal[LogEntry](d.logSize),
+	}
+	m.outLines = &lineWriter{stream: "stdout", logs: m.logs}
+	m.errLines = &lineWriter{stream: "stderr", logs: m.logs}
+	p.AddStdoutWriter(m.outLines, process.BlockSink)
+	p.AddStderrWriter(m.errLines, process.BlockSink)
+
+	d.procs[spec.Name] = m
+	d.names = append(d.names, spec.Name)
+	d.publish(Event{Name: spec.Name, Type: EventAdded})
+	return nil
+}
+
+// Remove stops the process, if running, and removes it from the Daemon
+func (d *Daemon) Remove(name string, timeout time.Duration) error {
+	if _, err := d.Stop(name, timeout); err != nil && !errors.Is(err, ErrNotRunning) {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	m, err := d.get(name)
+	if err != nil {
+		return err
+	}
+
+	delete(d.procs, name)
+	for i, n := range d.names {
+		if n == name {
+			d.names = append(d.names[:i], d.names[i+1:]...)
+			break
+		}
+	}
+
+	m.logs.close()
+	m.p.Close()
+	d.publish(Event{Name: name, Type: EventRemoved})
+	return nil
+}
+
+func (d *Daemon) get(name string) (*managed, error) {
+	m, ok := d.procs[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: \"%s\"", ErrNotFound, name)
+	}
+	return m, nil
+}
+
+func (d *Daemon) publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	d.events.append(e)
+}
+
+// Start starts the process, resetting its restart count
+func (d *Daemon) Start(name string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		return ErrClosed
+	}
+
+	m, err := d.get(name)
+	if err != nil {
+		return err
+	}
+	if m.p.IsRunning() {
+		return fmt.Errorf("%w: \"%s\"", ErrRunning, name)
+	}
+
+	m.restarts = 0
+	return d.startLocked(m)
+}
+
+func (d *Daemon) startLocked(m *managed) error {
+	if m.restartT != nil {
+		m.restartT.Stop()
+		m.restartT = nil
+	}
+
+	stdin, stdout, stderr := m.spec.Stdio()
+	if err := m.p.Start(stdin, stdout, stderr); err != nil {
+		return err
+	}
+
+	m.gen++
+	m.exited = make(chan struct{})
+	m.stopping = false
+	m.startedAt = time.Now()
+	m.exitedAt = time.Time{}
+	m.exit = nil
+	d.publish(Event{Name: m.name, Type: EventStarted, PID: m.p.PID()})
+
+	go d.supervise(m, m.gen, m.exited)
+	go d.watchReady(m, m.gen)
+	return nil
+}
+
+// supervise waits for a run of the process to exit and
+// restarts it if its restart policy says so
+func (d *Daemon) supervise(m *managed, gen uint64, exited chan struct{}) {
+	exitStatus := m.p.Wait()
+	m.outLines.flush()
+	m.errLines.flush()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	defer close(exited)
+
+	if m.gen != gen {
+		return
+	}
+
+	m.exitedAt = time.Now()
+	m.exit = &exitStatus
+	d.publish(exitEvent(m.name, EventExited, exitStatus))
+
+	if d.closed || m.stopping || !m.spec.Restart.ShouldRestart(exitStatus, m.restarts) {
+		return
+	}
+
+	m.restarts++
+	d.publish(Event{Name: m.name, Type: EventRestarting})
+	m.restartT = time.AfterFunc(time.Duration(m.spec.Restart.Delay), func() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+
+		if d.closed || m.gen != gen || m.restartT == nil || m.p.IsRunning() {
+			return
+		}
+		m.restartT = nil
+
+		if err := d.startLocked(m); err != nil {
+			d.publish(Event{Name: m.name, Type: EventFailed, Error: err.Error()})
+		}
+	})
+}
+
+func (d *Daemon) watchReady(m *managed, gen uint64) {
+	if m.spec.Readiness == nil {
+		return
+	}
+	if err := m.p.WaitReady(context.Background()); err != nil {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if m.gen == gen {
+		d.publish(Event{Name: m.name, Type: EventReady, PID: m.p.PID()})
+	}
+}
+
+// Stop stops the process, killing it if it's still running after the
+// timeout, and disables its automatic restart until the next Start
+func (d *Daemon) Stop(name string, timeout time.Duration) (process.ExitStatus, error) {
+	d.mu.Lock()
+	m, err := d.get(name)
+	if err != nil {
+		d.mu.Unlock()
+		return process.ExitStatus{}, err
+	}
+
+	m.stopping = true
+	pending := m.restartT != nil
+	if pending {
+		m.restartT.Stop()
+		m.restartT = nil
+	}
+	exited := m.exited
+	d.mu.Unlock()
+
+	if !m.p.IsRunning() {
+		if pending {
+			return m.p.Wait(), nil
+		}
+		return process.ExitStatus{}, fmt.Errorf("%w: \"%s\"", ErrNotRunning, name)
+	}
+
+	exitStatus, err := m.p.StopTimeout(timeout)
+	if !m.p.IsRunning() {
+		// the state reported after the stop includes the exit
+		<-exited
+	}
+	return exitStatus, err
+}
+
+// Restart stops the process, if running, and starts it again
+func (d *Daemon) Restart(name string, timeout time.Duration) error {
+	if _, err := d.Stop(name, timeout); err != nil && !errors.Is(err, ErrNotRunning) {
+		return err
+	}
+	return d.Start(name)
+}
+
+// Signal sends a signal to the process. The signal is a name, with or
+// without the SIG prefix, or a number. INT and KILL are always
+// supported, as they are translated to Process.Stop and Process.Kill
+func (d *Daemon) Signal(name string, signal string) error {
+	d.mu.Lock()
+	m, err := d.get(name)
+	d.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if !m.p.IsRunning() {
+		return fmt.Errorf("%w: \"%s\"", ErrNotRunning, name)
+	}
+
+	sig, err := parseSignal(signal)
+	if err != nil {
+		return err
+	}
+
+	switch sig {
+	case sigInt:
+		return m.p.Stop()
+	case sigKill:
+		return m.p.Kill()
+	default:
+		return m.p.Exec.Process.Signal(sig)
+	}
+}
+
+// SendInput writes data to the standard input of the process and,
+// if close is true, closes it afterwards. Before closing, it waits
+// for data to be written or for ctx to be done
+func (d *Daemon) SendInput(ctx context.Context, name string, data []byte, close bool) error {
+	d.mu.Lock()
+	m, err := d.get(name)
+	d.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if len(data) > 0 {
+		send := m.p.SendInput
+		if close {
+			send = func(data []byte) error { return m.p.SendInputContext(ctx, data) }
+		}
+		if err := send(data); err != nil {
+			return err
+		}
+	}
+	if close {
+		return m.p.CloseInput()
+	}
+	return nil
+}
+
+// List returns the state of every process, in the order they were added
+func (d *Daemon) List() []ProcessInfo {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	infos := make([]ProcessInfo, 0, len(d.names))
+	for _, name := range d.names {
+		infos = append(infos, d.procs[name].info())
+	}
+	return infos
+}
+
+// Info returns the state of the process, together with its Spec
+func (d *Daemon) Info(name string) (ProcessInfo, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	m, err := d.get(name)
+	if err != nil {
+		return ProcessInfo{}, err
+	}
+
+	info := m.info()
+	info.Spec = m.spec
+	return info, nil
+}
+
+func (m *managed) info() ProcessInfo {
+	info := ProcessInfo{Name: m.name, Restarts: m.restarts}
+
+	if !m.startedAt.IsZero() {
+		startedAt := m.startedAt
+		info.StartedAt = &startedAt
+	}
+
+	switch {
+	case m.p.IsRunning():
+		info.State = StateRunning
+		info.PID = m.p.PID()
+		info.Ready = m.p.IsReady()
+		return info
+	case m.restartT != nil:
+		info.State = StateRestarting
+	case m.exit == nil:
+		info.State = StateCreated
+		return info
+	case m.stopping:
+		info.State = StateStopped
+	default:
+		info.State = StateExited
+	}
+
+	if m.exit != nil {
+		exitedAt, code := m.exitedAt, m.exit.ExitCode
+		info.ExitedAt = &exitedAt
+		info.ExitCode = &code
+		if err := m.exit.Error(); err != nil {
+			info.Error = err.Error()
+		}
+	}
+	return info
+}
+
+// StartAll starts every process that is not running
+func (d *Daemon) StartAll() error {
+	d.mu.Lock()
+	names := append([]string(nil), d.names...)
+	d.mu.Unlock()
+
+	var errs []error
+	for _, name := range names {
+		if err := d.Start(name); err != nil && !errors.Is(err, ErrRunning) {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close stops every process in the reverse order they were added, with
+// the given timeout each, closes the streams of the clients and shuts
+// down the servers started with Serve, letting the requests in progress
+// complete within the same timeout
+func (d *Daemon) Close(timeout time.Duration) error {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return nil
+	}
+	d.closed = true
+	names := append([]string(nil), d.names...)
+	servers := d.servers
+	d.mu.Unlock()
+
+	var errs []error
+	for i := len(names) - 1; i >= 0; i-- {
+		if _, err := d.Stop(names[i], timeout); err != nil && !errors.Is(err, ErrNotRunning) {
+			errs = append(errs, err)
+		}
+	}
+
+	d.mu.Lock()
+	for _, m := range d.procs {
+		m.logs.close()
+		m.p.Close()
+	}
+	d.mu.Unlock()
+	d.events.close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	for _, srv := range servers {
+		if err := srv.Shutdown(ctx); err != nil {
+			srv.Close()
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
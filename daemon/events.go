@@ -0,0 +1,90 @@
+package daemon
+
+import (
+	"bytes"
+	"sync"
+	"time"
+
+	"github.com/nixpare/process"
+)
+
+// EventType is the kind of a lifecycle Event
+type EventType string
+
+const (
+	EventAdded      EventType = "added"
+	EventStarted    EventType = "started"
+	EventReady      EventType = "ready"
+	EventExited     EventType = "exited"
+	EventRestarting EventType = "restarting"
+	EventFailed     EventType = "failed"
+	EventRemoved    EventType = "removed"
+)
+
+// Event is a change in the lifecycle of a process hosted by the Daemon
+type Event struct {
+	Time     time.Time `json:"time"`
+	Name     string    `json:"name"`
+	Type     EventType `json:"type"`
+	PID      int       `json:"pid,omitempty"`
+	ExitCode *int      `json:"exit_code,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+func exitEvent(name string, t EventType, exitStatus process.ExitStatus) Event {
+	code := exitStatus.ExitCode
+	e := Event{Name: name, Type: t, PID: exitStatus.PID, ExitCode: &code}
+	if err := exitStatus.Error(); err != nil {
+		e.Error = err.Error()
+	}
+	return e
+}
+
+// LogEntry is a line written by a process on its standard output or error
+type LogEntry struct {
+	Time   time.Time `json:"time"`
+	Stream string    `json:"stream"`
+	Line   string    `json:"line"`
+}
+
+// lineWriter splits the output of a process in
+// lines and appends them to its logs
+type lineWriter struct {
+	stream  string
+	logs    *journal[LogEntry]
+	mu      sync.Mutex
+	pending []byte
+}
+
+func (lw *lineWriter) Write(b []byte) (int, error) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+
+	lw.pending = append(lw.pending, b...)
+	for {
+		i := bytes.IndexByte(lw.pending, '\n')
+		if i < 0 {
+			break
+		}
+
+		lw.add(bytes.TrimSuffix(lw.pending[:i], []byte{'\r'}))
+		lw.pending = lw.pending[i+1:]
+	}
+
+	return len(b), nil
+}
+
+// flush appends the last line, if not terminated by a new line
+func (lw *lineWriter) flush() {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+
+	if len(lw.pending) > 0 {
+		lw.add(lw.pending)
+		lw.pending = nil
+	}
+}
+
+func (lw *lineWriter) add(line []byte) {
+	lw.logs.append(LogEntry{Time: time.Now(), Stream: lw.stream, Line: string(line)})
+}
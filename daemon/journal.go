@@ -0,0 +1,76 @@
+package daemon
+
+import "sync"
+
+// journal is a bounded log of items numbered by a sequence, that
+// readers can follow waiting for new items
+type journal[T any] struct {
+	mu      sync.Mutex
+	items   []T
+	first   uint64
+	size    int
+	changed chan struct{}
+	closed  bool
+}
+
+func newJournal[T any](size int) *journal[T] {
+	return &journal[T]{size: size, changed: make(chan struct{})}
+}
+
+// append adds an item, dropping the oldest one if the journal is full
+func (j *journal[T]) append(item T) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.closed {
+		return
+	}
+
+	j.items = append(j.items, item)
+	if len(j.items) > j.size {
+		drop := len(j.items) - j.size
+		j.items = j.items[drop:]
+		j.first += uint64(drop)
+	}
+
+	close(j.changed)
+	j.changed = make(chan struct{})
+}
+
+// read returns the items starting from the sequence number from, the
+// sequence number of the next item and a channel closed when a new item
+// is appended. Items already dropped are skipped
+func (j *journal[T]) read(from uint64) (items []T, next uint64, changed <-chan struct{}, closed bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	next = j.first + uint64(len(j.items))
+	if from < j.first {
+		from = j.first
+	}
+	if from < next {
+		items = append(items, j.items[from-j.first:]...)
+	}
+
+	return items, next, j.changed, j.closed
+}
+
+// end returns the sequence number of the next item
+func (j *journal[T]) end() uint64 {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.first + uint64(len(j.items))
+}
+
+// close wakes up the readers and stops accepting items
+func (j *journal[T]) close() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.closed {
+		return
+	}
+	j.closed = true
+	close(j.changed)
+}
@@ -0,0 +1,158 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+type access int
+
+const (
+	accessRead access = 1 << iota
+	accessWrite
+)
+
+type accessKey struct{}
+
+// requireAccess rejects the requests coming from a client without the
+// given access. Requests not served by Serve, like the ones of an
+// httptest.Server, carry no access information and are always allowed
+func requireAccess(need access, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if granted, ok := r.Context().Value(accessKey{}).(access); ok && granted&need == 0 {
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "permission denied"})
+			return
+		}
+		h(w, r)
+	}
+}
+
+// DefaultSocket returns the path of the socket where procctl looks for
+// the daemon when no other path is given. A program hosting a Daemon
+// should serve it there, unless it's configured otherwise
+func DefaultSocket() string {
+	return filepath.Join(os.TempDir(), "procd.sock")
+}
+
+// Listen creates a unix domain socket at path, replacing a stale
+// socket left by a previous run, with the permissions of mode.
+//
+// Connecting to a socket requires the write permission on it, so only the
+// classes of users with the write permission in mode can connect. To give
+// a class read-only access, give it the write permission here and only
+// the read permission in the mode passed to Serve
+func Listen(path string, mode os.FileMode) (net.Listener, error) {
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("\"%s\" exists and is not a socket", path)
+		}
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("\"%s\" is already in use", path)
+		}
+		os.Remove(path)
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Chmod(path, mode.Perm()); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// Serve serves the API on the listener, usually created with Listen,
+// granting each client the access allowed by mode for its class of user,
+// like for a regular file: the read permission allows to list, describe
+// and follow the processes, while the write permission allows to control
+// them. A client is in the group class if the group of the Daemon is its
+// primary or one of its supplementary groups. The class is found from the
+// credentials of the peer, available on Linux, macOS and FreeBSD: on the
+// other platforms every client gets only the read access.
+// It returns when the listener fails or the Daemon is closed
+func (d *Daemon) Serve(l net.Listener, mode os.FileMode) error {
+	srv := &http.Server{
+		Handler: d,
+		ConnContext: func(ctx context.Context, c net.Conn) context.Context {
+			return context.WithValue(ctx, accessKey{}, peerAccess(c, mode))
+		},
+	}
+
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return ErrClosed
+	}
+	d.servers = append(d.servers, srv)
+	d.mu.Unlock()
+
+	err := srv.Serve(l)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// ListenAndServe creates the socket at path with Listen and serves the API,
+// with the same mode for both: the classes of users with only the read
+// permission can't connect, see Listen to give them the read-only access
+func (d *Daemon) ListenAndServe(path string, mode os.FileMode) error {
+	l, err := Listen(path, mode)
+	if err != nil {
+		return err
+	}
+	return d.Serve(l, mode)
+}
+
+// peerCreds are the credentials of the process on the other side of a
+// connection: gids holds both the primary and the supplementary groups
+type peerCreds struct {
+	uid  int
+	gids []int
+}
+
+// peerAccess returns the access of the client on the other side of c
+func peerAccess(c net.Conn, mode os.FileMode) access {
+	cred, ok := peerCred(c)
+	return credAccess(cred, ok, mode)
+}
+
+// credAccess returns the access of a client with the given credentials.
+// Without credentials, the client can only read
+func credAccess(cred peerCreds, ok bool, mode os.FileMode) access {
+	if !ok {
+		return accessRead
+	}
+	if cred.uid == 0 {
+		return accessRead | accessWrite
+	}
+
+	var perm os.FileMode
+	switch {
+	case cred.uid == os.Geteuid():
+		perm = (mode >> 6) & 07
+	case slices.Contains(cred.gids, os.Getegid()):
+		perm = (mode >> 3) & 07
+	default:
+		perm = mode & 07
+	}
+
+	var granted access
+	if perm&04 != 0 {
+		granted |= accessRead
+	}
+	if perm&02 != 0 {
+		granted |= accessWrite
+	}
+	return granted
+}
@@ -0,0 +1,156 @@
+//go:build !windows
+
+package daemon
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCredAccess(t *testing.T) {
+	uid, gid := os.Geteuid(), os.Getegid()
+	other := uid + 1000
+
+	tests := []struct {
+		name string
+		cred peerCreds
+		ok   bool
+		mode os.FileMode
+		want access
+	}{
+		{"no credentials", peerCreds{}, false, 0666, accessRead},
+		{"root", peerCreds{uid: 0}, true, 0, accessRead | accessWrite},
+		{"owner", peerCreds{uid: uid}, true, 0640, accessRead | accessWrite},
+		{"primary group", peerCreds{uid: other, gids: []int{gid}}, true, 0640, accessRead},
+		{"supplementary group", peerCreds{uid: other, gids: []int{gid + 1, gid}}, true, 0660, accessRead | accessWrite},
+		{"other", peerCreds{uid: other, gids: []int{gid + 1}}, true, 0664, accessRead},
+		{"no access", peerCreds{uid: other, gids: []int{gid + 1}}, true, 0660, 0},
+	}
+
+	for _, tt := range tests {
+		if got := credAccess(tt.cred, tt.ok, tt.mode); got != tt.want {
+			t.Errorf("%s: access = %b, want %b", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestRequireAccess(t *testing.T) {
+	h := requireAccess(accessWrite, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	for granted, want := range map[access]int{
+		accessRead:               http.StatusForbidden,
+		accessRead | accessWrite: http.StatusNoContent,
+	} {
+		r := httptest.NewRequest("POST", "/", nil)
+		r = r.WithContext(context.WithValue(r.Context(), accessKey{}, granted))
+		w := httptest.NewRecorder()
+		h(w, r)
+
+		if w.Code != want {
+			t.Errorf("access %b: status %d, want %d", granted, w.Code, want)
+		}
+	}
+}
+
+// serve starts d on a socket in a temporary directory and
+// returns a client connected to it
+func serve(t *testing.T, d *Daemon, socketMode, accessMode os.FileMode) *http.Client {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "d.sock")
+	l, err := Listen(path, socketMode)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != socketMode {
+		t.Errorf("socket mode = %v, want %v", info.Mode().Perm(), socketMode)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- d.Serve(l, accessMode) }()
+	t.Cleanup(func() {
+		d.Close(time.Second)
+		if err := <-done; err != nil {
+			t.Errorf("Serve: %v", err)
+		}
+	})
+
+	return &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return new(net.Dialer).DialContext(ctx, "unix", path)
+		},
+	}}
+}
+
+func TestServePermissions(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root is always granted every access")
+	}
+
+	tests := []struct {
+		name       string
+		accessMode os.FileMode
+		list, stop int
+	}{
+		// the stop of an unknown process fails after the access check
+		{"read and write", 0600, http.StatusOK, http.StatusNotFound},
+		{"read only", 0400, http.StatusOK, http.StatusForbidden},
+		{"no access", 0060, http.StatusForbidden, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := serve(t, New(), 0600, tt.accessMode)
+
+			resp, err := client.Get("http://daemon/processes")
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.list {
+				t.Errorf("list: status %d, want %d", resp.StatusCode, tt.list)
+			}
+
+			resp, err = client.Post("http://daemon/processes/missing/stop", "", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.stop {
+				t.Errorf("stop: status %d, want %d", resp.StatusCode, tt.stop)
+			}
+		})
+	}
+}
+
+func TestListenKeepsMode(t *testing.T) {
+	for _, mode := range []os.FileMode{0600, 0640, 0660} {
+		path := filepath.Join(t.TempDir(), "d.sock")
+		l, err := Listen(path, mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		info, err := os.Stat(path)
+		l.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != mode {
+			t.Errorf("socket mode = %v, want %v", info.Mode().Perm(), mode)
+		}
+	}
+}
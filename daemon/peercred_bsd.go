@@ -0,0 +1,38 @@
+//go:build darwin || freebsd
+
+package daemon
+
+import (
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// peerCred returns the user and groups of the process on the
+// other side of a unix domain socket, with LOCAL_PEERCRED
+func peerCred(c net.Conn) (cred peerCreds, ok bool) {
+	uc, isUnix := c.(*net.UnixConn)
+	if !isUnix {
+		return peerCreds{}, false
+	}
+
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return peerCreds{}, false
+	}
+
+	var xucred *unix.Xucred
+	var credErr error
+	err = raw.Control(func(fd uintptr) {
+		xucred, credErr = unix.GetsockoptXucred(int(fd), unix.SOL_LOCAL, unix.LOCAL_PEERCRED)
+	})
+	if err != nil || credErr != nil {
+		return peerCreds{}, false
+	}
+
+	cred = peerCreds{uid: int(xucred.Uid)}
+	for _, gid := range xucred.Groups[:min(int(xucred.Ngroups), len(xucred.Groups))] {
+		cred.gids = append(cred.gids, int(gid))
+	}
+	return cred, true
+}
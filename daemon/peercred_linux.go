@@ -0,0 +1,63 @@
+package daemon
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// peerCred returns the user and groups of the process on the other
+// side of a unix domain socket
+func peerCred(c net.Conn) (cred peerCreds, ok bool) {
+	uc, isUnix := c.(*net.UnixConn)
+	if !isUnix {
+		return peerCreds{}, false
+	}
+
+	raw, err := uc.SyscallConn()
+	if err != nil {
+		return peerCreds{}, false
+	}
+
+	var ucred *unix.Ucred
+	var credErr error
+	err = raw.Control(func(fd uintptr) {
+		ucred, credErr = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	})
+	if err != nil || credErr != nil {
+		return peerCreds{}, false
+	}
+
+	cred = peerCreds{uid: int(ucred.Uid), gids: []int{int(ucred.Gid)}}
+	// SO_PEERCRED has only the primary group: the supplementary
+	// ones are read from the status of the peer process
+	cred.gids = append(cred.gids, procGroups(int(ucred.Pid))...)
+	return cred, true
+}
+
+func procGroups(pid int) []int {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return nil
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		groups, ok := strings.CutPrefix(line, "Groups:")
+		if !ok {
+			continue
+		}
+
+		var gids []int
+		for _, field := range strings.Fields(groups) {
+			if gid, err := strconv.Atoi(field); err == nil {
+				gids = append(gids, gid)
+			}
+		}
+		return gids
+	}
+	return nil
+}
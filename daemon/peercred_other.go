@@ -0,0 +1,11 @@
+//go:build !linux && !darwin && !freebsd
+
+package daemon
+
+import "net"
+
+// peerCred is not supported on this platform: every
+// client is given only the read access, see Serve
+func peerCred(c net.Conn) (cred peerCreds, ok bool) {
+	return peerCreds{}, false
+}
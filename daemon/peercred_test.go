@@ -0,0 +1,53 @@
+//go:build linux || darwin || freebsd
+
+package daemon
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestPeerCred(t *testing.T) {
+	l, err := Listen(filepath.Join(t.TempDir(), "d.sock"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	go func() {
+		if c, err := net.Dial("unix", l.Addr().String()); err == nil {
+			defer c.Close()
+			c.Read(make([]byte, 1))
+		}
+	}()
+
+	c, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	cred, ok := peerCred(c)
+	if !ok {
+		t.Fatal("no credentials for a unix socket")
+	}
+	if cred.uid != os.Geteuid() {
+		t.Errorf("uid = %d, want %d", cred.uid, os.Geteuid())
+	}
+	if !slices.Contains(cred.gids, os.Getegid()) {
+		t.Errorf("gids = %v, want them to contain %d", cred.gids, os.Getegid())
+	}
+
+	groups, err := os.Getgroups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, gid := range groups {
+		if !slices.Contains(cred.gids, gid) {
+			t.Errorf("gids = %v, missing the supplementary group %d", cred.gids, gid)
+		}
+	}
+}
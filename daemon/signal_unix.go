@@ -0,0 +1,34 @@
+//go:build !windows
+
+package daemon
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+var (
+	sigInt  os.Signal = syscall.SIGINT
+	sigKill os.Signal = syscall.SIGKILL
+)
+
+func parseSignal(s string) (os.Signal, error) {
+	if n, err := strconv.Atoi(s); err == nil && n > 0 {
+		return syscall.Signal(n), nil
+	}
+
+	name := strings.ToUpper(s)
+	if !strings.HasPrefix(name, "SIG") {
+		name = "SIG" + name
+	}
+
+	sig := unix.SignalNum(name)
+	if sig == 0 {
+		return nil, badRequest("unknown signal \"%s\"", s)
+	}
+	return sig, nil
+}
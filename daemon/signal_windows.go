@@ -0,0 +1,24 @@
+package daemon
+
+import (
+	"os"
+	"strings"
+)
+
+var (
+	sigInt  = os.Interrupt
+	sigKill = os.Kill
+)
+
+// parseSignal only supports INT and KILL, as there are no other
+// signals on Windows
+func parseSignal(s string) (os.Signal, error) {
+	switch strings.TrimPrefix(strings.ToUpper(s), "SIG") {
+	case "INT", "2":
+		return sigInt, nil
+	case "KILL", "9":
+		return sigKill, nil
+	default:
+		return nil, badRequest("unsupported signal \"%s\"", s)
+	}
+}
@@ -41,6 +41,9 @@ For the stdout and stderr argument:
  + for any other value, any data will be captured and written to the io.Writer provided.
    This means that if you pass os.Stdout/Stderr, you will also have the output sent to the parent console
 
+If the output is not needed by the parent, Process.CaptureOutput(false) hands the stdout and stderr
+writers directly to the child: an *os.File is then inherited without any copy in between.
+
 # OS Compatibility
 
 The package is obviously compatible with all operating systems,
@@ -3,6 +3,7 @@ module github.com/nixpare/process
 go 1.22.2
 
 require (
+	github.com/BurntSushi/toml v1.5.0
 	github.com/nixpare/broadcaster v1.3.1
 	golang.org/x/sys v0.30.0
 )
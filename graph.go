@@ -0,0 +1,378 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Condition is what a Process waits from one of its
+// dependencies in a Graph before starting
+type Condition int
+
+const (
+	// ConditionStarted waits for the dependency to be started
+	ConditionStarted Condition = iota
+	// ConditionReady waits for the dependency to be ready, see SetReadiness
+	ConditionReady
+	// ConditionSucceeded waits for the dependency to exit successfully,
+	// which is the case of one-shot jobs like migrations
+	ConditionSucceeded
+)
+
+func (c Condition) String() string {
+	switch c {
+	case ConditionStarted:
+		return "started"
+	case ConditionReady:
+		return "ready"
+	case ConditionSucceeded:
+		return "succeeded"
+	default:
+		return fmt.Sprintf("Condition(%d)", int(c))
+	}
+}
+
+// Graph is a set of named processes linked by dependencies. Starting the
+// Graph starts every Process as soon as the conditions on its dependencies
+// are met, so independent branches are started in parallel; stopping it
+// stops every Process only after the ones depending on it
+type Graph struct {
+	mu    sync.Mutex
+	nodes map[string]*graphNode
+	names []string
+	runs  map[string]*nodeRun
+}
+
+type graphNode struct {
+	name   string
+	p      *Process
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+	deps   []graphEdge
+}
+
+type graphEdge struct {
+	name string
+	cond Condition
+}
+
+// nodeRun tracks a Process during a Graph start
+type nodeRun struct {
+	node    *graphNode
+	started chan struct{}
+	failed  chan struct{}
+	exited  chan struct{}
+	err     error
+	status  ExitStatus
+}
+
+// NewGraph creates an empty Graph
+func NewGraph() *Graph {
+	return &Graph{nodes: make(map[string]*graphNode)}
+}
+
+// Add adds a Process with a unique name to the Graph, with the standard
+// input, output and error passed to Start
+func (g *Graph) Add(name string, p *Process, stdin io.Reader, stdout, stderr io.Writer) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if _, ok := g.nodes[name]; ok {
+		return fmt.Errorf("process \"%s\" already defined", name)
+	}
+
+	g.nodes[name] = &graphNode{name: name, p: p, stdin: stdin, stdout: stdout, stderr: stderr}
+	g.names = append(g.names, name)
+	return nil
+}
+
+// DependsOn declares that the Process name must wait for the dependency
+// dep to meet the condition before starting. An error is returned if
+// either name is unknown or the dependency would create a cycle
+func (g *Graph) DependsOn(name string, dep string, cond Condition) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	node, ok := g.nodes[name]
+	if !ok {
+		return fmt.Errorf("process \"%s\" not defined", name)
+	}
+	if _, ok := g.nodes[dep]; !ok {
+		return fmt.Errorf("process \"%s\" not defined", dep)
+	}
+
+	if path := g.path(dep, name); path != nil {
+		return fmt.Errorf("dependency cycle: %s -> %s", name, joinPath(path))
+	}
+
+	node.deps = append(node.deps, graphEdge{name: dep, cond: cond})
+	return nil
+}
+
+// path returns the chain of dependencies that leads from
+// the node from to the node to, if any
+func (g *Graph) path(from string, to string) []string {
+	if from == to {
+		return []string{to}
+	}
+
+	for _, edge := range g.nodes[from].deps {
+		if path := g.path(edge.name, to); path != nil {
+			return append([]string{from}, path...)
+		}
+	}
+	return nil
+}
+
+func joinPath(path []string) string {
+	s := path[0]
+	for _, name := range path[1:] {
+		s += " -> " + name
+	}
+	return s
+}
+
+// Order returns the names of the processes sorted so that each one comes
+// after its dependencies, keeping the order they were added otherwise.
+// It's the order used to start the processes one at a time
+func (g *Graph) Order() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.order()
+}
+
+func (g *Graph) order() []string {
+	order := make([]string, 0, len(g.names))
+	done := make(map[string]bool, len(g.names))
+
+	for len(order) < len(g.names) {
+		for _, name := range g.names {
+			if done[name] {
+				continue
+			}
+
+			ready := true
+			for _, edge := range g.nodes[name].deps {
+				if !done[edge.name] {
+					ready = false
+					break
+				}
+			}
+
+			if ready {
+				done[name] = true
+				order = append(order, name)
+				break
+			}
+		}
+	}
+
+	return order
+}
+
+// Process returns the Process with the given name, or nil
+func (g *Graph) Process(name string) *Process {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if node, ok := g.nodes[name]; ok {
+		return node.p
+	}
+	return nil
+}
+
+// Start starts every Process of the Graph, each one as soon as the
+// conditions on its dependencies are met, and returns when all of them
+// are started. If a Process can't be started or a condition can't be met
+// (for example a dependency exits with an error), the processes already
+// started are stopped in reverse order, with the given grace period,
+// and the error is returned. Cancelling ctx aborts the start the same way
+func (g *Graph) Start(ctx context.Context, grace time.Duration) error {
+	g.mu.Lock()
+	runs := make(map[string]*nodeRun, len(g.nodes))
+	for name, node := range g.nodes {
+		runs[name] = &nodeRun{
+			node:    node,
+			started: make(chan struct{}),
+			failed:  make(chan struct{}),
+			exited:  make(chan struct{}),
+		}
+	}
+	g.runs = runs
+	g.mu.Unlock()
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, run := range runs {
+		wg.Add(1)
+		go func(run *nodeRun) {
+			defer wg.Done()
+			if err := g.startNode(ctx, runs, run); err != nil {
+				run.err = err
+				close(run.failed)
+				cancel()
+			}
+		}(run)
+	}
+	wg.Wait()
+
+	var errs []error
+	for _, name := range g.Order() {
+		if err := runs[name].err; err != nil && !errors.Is(err, errDependencyFailed) {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		g.Stop(grace)
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		g.Stop(grace)
+		return err
+	}
+
+	return nil
+}
+
+var errDependencyFailed = errors.New("dependency failed")
+
+func (g *Graph) startNode(ctx context.Context, runs map[string]*nodeRun, run *nodeRun) error {
+	for _, edge := range run.node.deps {
+		err := waitCondition(ctx, runs[edge.name], edge.cond)
+		if err != nil {
+			if errors.Is(err, errDependencyFailed) || errors.Is(err, context.Canceled) {
+				return errDependencyFailed
+			}
+			return fmt.Errorf("process \"%s\": dependency \"%s\" not %s: %w", run.node.name, edge.name, edge.cond, err)
+		}
+	}
+
+	err := run.node.p.Start(run.node.stdin, run.node.stdout, run.node.stderr)
+	if err != nil {
+		return fmt.Errorf("process \"%s\": %w", run.node.name, err)
+	}
+	close(run.started)
+
+	go func() {
+		run.status = run.node.p.Wait()
+		close(run.exited)
+	}()
+	return nil
+}
+
+func waitCondition(ctx context.Context, run *nodeRun, cond Condition) error {
+	select {
+	case <-run.started:
+	case <-run.failed:
+		return errDependencyFailed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	switch cond {
+	case ConditionReady:
+		return run.node.p.WaitReady(ctx)
+	case ConditionSucceeded:
+		select {
+		case <-run.exited:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		if run.status.ExitCode != 0 || run.status.ExitError != nil {
+			return fmt.Errorf("exit status (code 0x%x): %v", run.status.ExitCode, run.status.ExitError)
+		}
+	}
+
+	return nil
+}
+
+// Wait waits for every Process started by the Graph to exit and returns
+// the errors of the ones that failed
+func (g *Graph) Wait() error {
+	g.mu.Lock()
+	runs := g.runs
+	g.mu.Unlock()
+
+	var errs []error
+	for _, name := range g.Order() {
+		run := runs[name]
+		if run == nil {
+			continue
+		}
+
+		select {
+		case <-run.started:
+		default:
+			continue
+		}
+
+		<-run.exited
+		if err := run.status.Error(); err != nil {
+			errs = append(errs, fmt.Errorf("process \"%s\": %w", name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Stop stops the running processes of the Graph in reverse dependency
+// order: each Process receives a CTRL-C event only after all the ones that
+// depend on it have exited, so independent branches are stopped in
+// parallel. The grace period is shared: once it has expired, the remaining
+// processes are killed
+func (g *Graph) Stop(grace time.Duration) error {
+	g.mu.Lock()
+	dependents := make(map[string][]string, len(g.nodes))
+	for name, node := range g.nodes {
+		for _, edge := range node.deps {
+			dependents[edge.name] = append(dependents[edge.name], name)
+		}
+	}
+
+	stopped := make(map[string]chan struct{}, len(g.nodes))
+	for name := range g.nodes {
+		stopped[name] = make(chan struct{})
+	}
+	nodes := g.nodes
+	g.mu.Unlock()
+
+	deadline := time.Now().Add(grace)
+	var mu sync.Mutex
+	var errs []error
+	var wg sync.WaitGroup
+
+	for name, node := range nodes {
+		wg.Add(1)
+		go func(name string, node *graphNode) {
+			defer wg.Done()
+			defer close(stopped[name])
+
+			for _, dependent := range dependents[name] {
+				<-stopped[dependent]
+			}
+
+			if !node.p.IsRunning() {
+				return
+			}
+
+			_, err := node.p.StopTimeout(time.Until(deadline))
+			if err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("process \"%s\": %w", name, err))
+				mu.Unlock()
+			}
+		}(name, node)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,127 @@
+//go:build !windows
+
+package process
+
+import (
+	"context"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGraphOrder(t *testing.T) {
+	g := NewGraph()
+	for _, name := range []string{"a", "b", "c"} {
+		if err := g.Add(name, newShell(t, "true"), nil, nil, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := g.Add("a", newShell(t, "true"), nil, nil, nil); err == nil {
+		t.Error("Add accepted a duplicated name")
+	}
+
+	if err := g.DependsOn("a", "c", ConditionStarted); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := g.Order(), []string{"b", "c", "a"}; !slices.Equal(got, want) {
+		t.Errorf("Order = %v, want %v", got, want)
+	}
+
+	err := g.DependsOn("c", "a", ConditionStarted)
+	if err == nil || err.Error() != "dependency cycle: c -> a -> c" {
+		t.Errorf("DependsOn with a cycle = %v, want the cycle error", err)
+	}
+	if err := g.DependsOn("a", "x", ConditionStarted); err == nil {
+		t.Error("DependsOn accepted an unknown dependency")
+	}
+}
+
+func TestGraphConditionSucceeded(t *testing.T) {
+	migrate, app := newShell(t, "sleep 0.2"), newShell(t, "exec sleep 10")
+
+	g := NewGraph()
+	g.Add("migrate", migrate, nil, nil, nil)
+	g.Add("app", app, nil, nil, nil)
+	g.DependsOn("app", "migrate", ConditionSucceeded)
+
+	if err := g.Start(context.Background(), time.Second); err != nil {
+		t.Fatal(err)
+	}
+	defer g.Stop(time.Second)
+
+	if migrate.IsRunning() {
+		t.Error("app was started before migrate exited")
+	}
+	if !app.IsRunning() {
+		t.Error("app is not running")
+	}
+}
+
+func TestGraphDependencyFailed(t *testing.T) {
+	migrate, app := newShell(t, "exit 1"), newShell(t, "exec sleep 10")
+
+	g := NewGraph()
+	g.Add("migrate", migrate, nil, nil, nil)
+	g.Add("app", app, nil, nil, nil)
+	g.DependsOn("app", "migrate", ConditionSucceeded)
+
+	err := g.Start(context.Background(), time.Second)
+	if err == nil || !strings.Contains(err.Error(), `dependency "migrate" not succeeded`) {
+		t.Errorf("Start = %v, want the dependency error", err)
+	}
+	if app.IsRunning() {
+		t.Error("app was started after its dependency failed")
+	}
+}
+
+func TestGraphConditionReady(t *testing.T) {
+	db, app := newShell(t, "sleep 0.2; echo ready; exec sleep 10"), newShell(t, "exec sleep 10")
+	db.SetReadiness(ReadyOnOutput(regexp.MustCompile(`^ready$`)))
+
+	g := NewGraph()
+	g.Add("db", db, nil, nil, nil)
+	g.Add("app", app, nil, nil, nil)
+	g.DependsOn("app", "db", ConditionReady)
+
+	if err := g.Start(context.Background(), time.Second); err != nil {
+		t.Fatal(err)
+	}
+	defer g.Stop(time.Second)
+
+	if !db.IsReady() {
+		t.Error("app was started before db was ready")
+	}
+}
+
+func TestGraphStopOrder(t *testing.T) {
+	g := NewGraph()
+	var mu sync.Mutex
+	var stopped []string
+
+	for _, name := range []string{"db", "cache", "app"} {
+		p := newShell(t, "exec sleep 10")
+		p.AddHook(HookPreStop, func(ctx context.Context, p *Process) error {
+			mu.Lock()
+			defer mu.Unlock()
+			stopped = append(stopped, name)
+			return nil
+		}, HookOptions{})
+		g.Add(name, p, nil, nil, nil)
+	}
+	g.DependsOn("cache", "db", ConditionStarted)
+	g.DependsOn("app", "cache", ConditionStarted)
+
+	if err := g.Start(context.Background(), time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Stop(5 * time.Second); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"app", "cache", "db"}; !slices.Equal(stopped, want) {
+		t.Errorf("stop order = %v, want %v", stopped, want)
+	}
+}
@@ -0,0 +1,303 @@
+package process
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Group manages a set of related processes that are started, waited
+// and stopped together. Processes are started in the order they are
+// added, unless they depend on processes added later, and are stopped
+// in the reverse order.
+//
+// With fail-fast enabled, like an errgroup, the first Process that exits
+// with an error stops all the others
+type Group struct {
+	// FailFast stops the whole Group when a Process exits with an error
+	FailFast bool
+	// GracePeriod is the time given to the processes to exit
+	// after the CTRL-C event when the Group fails fast
+	GracePeriod time.Duration
+
+	mu      sync.Mutex
+	members []*groupMember
+	started []*groupMember
+	exited  []*groupMember
+	// reported is the number of exited processes returned by WaitAny
+	reported int
+	stopping bool
+	changed  chan struct{}
+	firstErr error
+	stopMu   sync.Mutex
+}
+
+type groupMember struct {
+	p         *Process
+	dependsOn []*Process
+	stdin     io.Reader
+	stdout    io.Writer
+	stderr    io.Writer
+	status    ExitStatus
+}
+
+// NewGroup creates an empty Group
+func NewGroup() *Group {
+	return &Group{
+		GracePeriod: 10 * time.Second,
+		changed:     make(chan struct{}),
+	}
+}
+
+// Add adds a Process to the Group, with the standard input, output and
+// error passed to Start. If dependsOn is not empty, the Process is started
+// after those, which must be part of the Group by the time StartAll is called
+func (g *Group) Add(p *Process, stdin io.Reader, stdout, stderr io.Writer, dependsOn ...*Process) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.member(p) != nil {
+		return fmt.Errorf("process \"%s\" is already part of the group", p.ExecName)
+	}
+
+	g.members = append(g.members, &groupMember{
+		p:         p,
+		dependsOn: dependsOn,
+		stdin:     stdin,
+		stdout:    stdout,
+		stderr:    stderr,
+	})
+	return nil
+}
+
+func (g *Group) member(p *Process) *groupMember {
+	for _, m := range g.members {
+		if m.p == p {
+			return m
+		}
+	}
+	return nil
+}
+
+// Processes returns the processes of the Group, in the order they were added
+func (g *Group) Processes() []*Process {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	procs := make([]*Process, 0, len(g.members))
+	for _, m := range g.members {
+		procs = append(procs, m.p)
+	}
+	return procs
+}
+
+// startOrder sorts the members so that each one comes after its
+// dependencies, keeping the order they were added otherwise. The
+// ordering is the one of a Graph with the same dependencies
+func (g *Group) startOrder() ([]*groupMember, error) {
+	graph := NewGraph()
+	names := make(map[*Process]string, len(g.members))
+	byName := make(map[string]*groupMember, len(g.members))
+
+	for i, m := range g.members {
+		// the names only need to be unique and readable in the errors
+		name := m.p.ExecName
+		if _, ok := byName[name]; ok {
+			name = fmt.Sprintf("%s (%d)", name, i)
+		}
+		names[m.p], byName[name] = name, m
+
+		if err := graph.Add(name, m.p, nil, nil, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, m := range g.members {
+		for _, dep := range m.dependsOn {
+			if g.member(dep) == nil {
+				return nil, fmt.Errorf("process \"%s\" depends on \"%s\", which is not part of the group", m.p.ExecName, dep.ExecName)
+			}
+			if err := graph.DependsOn(names[m.p], names[dep], ConditionStarted); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	order := make([]*groupMember, 0, len(g.members))
+	for _, name := range graph.Order() {
+		order = append(order, byName[name])
+	}
+	return order, nil
+}
+
+// StartAll starts every Process of the Group. If a Process fails
+// to start, the ones already started are stopped and the error is returned.
+// The same happens when the Group is stopped while starting, for example
+// because a Process has already failed with fail-fast enabled
+func (g *Group) StartAll() error {
+	g.mu.Lock()
+	order, err := g.startOrder()
+	if err != nil {
+		g.mu.Unlock()
+		return err
+	}
+	g.started = nil
+	g.exited = nil
+	g.reported = 0
+	g.stopping = false
+	g.firstErr = nil
+	g.mu.Unlock()
+
+	for _, m := range order {
+		if err := g.stoppedErr(); err != nil {
+			return err
+		}
+
+		err := m.p.Start(m.stdin, m.stdout, m.stderr)
+		if err != nil {
+			g.StopAll(g.GracePeriod)
+			return err
+		}
+
+		// StopAll takes the started processes and marks the Group as
+		// stopping under the same lock, so a Process started meanwhile
+		// is either stopped there or here
+		g.mu.Lock()
+		g.started = append(g.started, m)
+		stopping := g.stopping
+		g.mu.Unlock()
+
+		go g.monitor(m)
+
+		if stopping {
+			g.StopAll(g.GracePeriod)
+			return g.stoppedErr()
+		}
+	}
+
+	return nil
+}
+
+// stoppedErr returns the reason why the Group is stopping, if it is
+func (g *Group) stoppedErr() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if !g.stopping {
+		return nil
+	}
+	if g.firstErr != nil {
+		return g.firstErr
+	}
+	return errors.New("the group was stopped while starting")
+}
+
+func (g *Group) monitor(m *groupMember) {
+	exitStatus := m.p.Wait()
+
+	g.mu.Lock()
+	m.status = exitStatus
+	g.exited = append(g.exited, m)
+
+	err := exitStatus.Error()
+	if err == nil && !g.stopping {
+		err = signalError(exitStatus)
+	}
+	failed := err != nil && g.firstErr == nil
+	if failed {
+		g.firstErr = fmt.Errorf("process \"%s\": %w", m.p.ExecName, err)
+	}
+
+	close(g.changed)
+	g.changed = make(chan struct{})
+	g.mu.Unlock()
+
+	if failed && g.FailFast {
+		g.StopAll(g.GracePeriod)
+	}
+}
+
+// signalError reports the death of a Process by a signal, which is not
+// an error for ExitStatus, unless it's the interrupt sent by Stop
+func signalError(exitStatus ExitStatus) error {
+	sig, ok := exitStatus.Signal()
+	if !ok || sig == syscall.SIGINT {
+		return nil
+	}
+	return fmt.Errorf("terminated by signal %v", sig)
+}
+
+// WaitAll waits for every started Process to exit and returns
+// the error of the first one that failed, if any
+func (g *Group) WaitAll() error {
+	for {
+		g.mu.Lock()
+		changed, done := g.changed, len(g.exited) == len(g.started)
+		err := g.firstErr
+		g.mu.Unlock()
+
+		if done {
+			return err
+		}
+		<-changed
+	}
+}
+
+// WaitAny waits for the next started Process to exit and returns it with
+// its ExitStatus: every call returns a different Process, in the order
+// they exited, and returns immediately if one has exited since the
+// previous call. An error is returned when every started Process has
+// already been returned
+func (g *Group) WaitAny() (*Process, ExitStatus, error) {
+	for {
+		g.mu.Lock()
+		changed := g.changed
+		if g.reported < len(g.exited) {
+			m := g.exited[g.reported]
+			g.reported++
+			g.mu.Unlock()
+			return m.p, m.status, nil
+		}
+		if g.reported == len(g.started) {
+			g.mu.Unlock()
+			return nil, ExitStatus{}, errors.New("no process of the group is left to wait")
+		}
+		g.mu.Unlock()
+
+		<-changed
+	}
+}
+
+// StopAll stops the running processes in the reverse order they were
+// started: each one receives a CTRL-C event and the Group waits for it to
+// exit before moving to the next one. The grace period is shared by all
+// the processes: once it has expired, the remaining ones are killed
+func (g *Group) StopAll(grace time.Duration) error {
+	g.stopMu.Lock()
+	defer g.stopMu.Unlock()
+
+	g.mu.Lock()
+	started := append([]*groupMember(nil), g.started...)
+	g.stopping = true
+	g.mu.Unlock()
+
+	deadline := time.Now().Add(grace)
+	var errs []error
+
+	for i := len(started) - 1; i >= 0; i-- {
+		p := started[i].p
+		if !p.IsRunning() {
+			continue
+		}
+
+		_, err := p.StopTimeout(time.Until(deadline))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("process \"%s\": %w", p.ExecName, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
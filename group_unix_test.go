@@ -0,0 +1,143 @@
+//go:build !windows
+
+package process
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newShell(t *testing.T, script string) *Process {
+	t.Helper()
+
+	p, err := NewProcess("", "sh", "-c", script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { p.Close() })
+	return p
+}
+
+func TestGroupStartOrder(t *testing.T) {
+	a, b, c := newShell(t, "true"), newShell(t, "true"), newShell(t, "true")
+
+	g := NewGroup()
+	g.Add(a, nil, nil, nil, c)
+	g.Add(b, nil, nil, nil)
+	g.Add(c, nil, nil, nil)
+
+	order, err := g.startOrder()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []*Process
+	for _, m := range order {
+		got = append(got, m.p)
+	}
+	if want := []*Process{b, c, a}; !slices.Equal(got, want) {
+		t.Errorf("start order = %v, want %v", got, want)
+	}
+
+	g = NewGroup()
+	g.Add(a, nil, nil, nil, b)
+	g.Add(b, nil, nil, nil, a)
+	if _, err := g.startOrder(); err == nil || !strings.Contains(err.Error(), "cycle") {
+		t.Errorf("startOrder with a cycle = %v, want a cycle error", err)
+	}
+}
+
+func TestGroupWaitAny(t *testing.T) {
+	fast, slow := newShell(t, "exit 0"), newShell(t, "sleep 0.3")
+
+	g := NewGroup()
+	g.Add(slow, nil, nil, nil)
+	g.Add(fast, nil, nil, nil)
+	if err := g.StartAll(); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []*Process
+	for range 2 {
+		p, _, err := g.WaitAny()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, p)
+	}
+	if want := []*Process{fast, slow}; !slices.Equal(got, want) {
+		t.Errorf("WaitAny order = %v, want %v", got, want)
+	}
+
+	if _, _, err := g.WaitAny(); err == nil {
+		t.Error("WaitAny with every process returned: expected an error")
+	}
+}
+
+func TestGroupFailFastOnSignal(t *testing.T) {
+	crash, long := newShell(t, "kill -SEGV $$"), newShell(t, "exec sleep 10")
+
+	g := NewGroup()
+	g.FailFast = true
+	g.GracePeriod = time.Second
+	g.Add(long, nil, nil, nil)
+	g.Add(crash, nil, nil, nil)
+	if err := g.StartAll(); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- g.WaitAll() }()
+
+	select {
+	case err := <-done:
+		if err == nil || !strings.Contains(err.Error(), "signal") {
+			t.Errorf("WaitAll = %v, want the signal error", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the group didn't fail fast")
+	}
+}
+
+func TestGroupFailFastWhileStarting(t *testing.T) {
+	crash, next, last := newShell(t, "exit 3"), newShell(t, "exec sleep 10"), newShell(t, "exec sleep 10")
+
+	g := NewGroup()
+	g.FailFast = true
+	g.GracePeriod = time.Second
+	g.Add(crash, nil, nil, nil)
+	g.Add(next, nil, nil, nil, crash)
+	g.Add(last, nil, nil, nil, next)
+
+	// next is created only once the group has failed
+	next.AddHook(HookPreStart, func(ctx context.Context, p *Process) error {
+		waitFor(t, "the group to fail", func() bool {
+			g.mu.Lock()
+			defer g.mu.Unlock()
+			return g.stopping
+		})
+		return nil
+	}, HookOptions{})
+	var lastStarted atomic.Bool
+	last.AddHook(HookPreStart, func(ctx context.Context, p *Process) error {
+		lastStarted.Store(true)
+		return nil
+	}, HookOptions{})
+
+	err := g.StartAll()
+	if err == nil || !strings.Contains(err.Error(), "exit") {
+		t.Errorf("StartAll = %v, want the error of the failed process", err)
+	}
+	if err := g.WaitAll(); err == nil {
+		t.Error("WaitAll = nil, want the error of the failed process")
+	}
+	if next.IsRunning() {
+		t.Error("the process started while failing was not stopped")
+	}
+	if lastStarted.Load() {
+		t.Error("a process was started after the group failed")
+	}
+}
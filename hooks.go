@@ -0,0 +1,266 @@
+package process
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// HookPoint is the moment of the lifecycle of a Process when a Hook runs
+type HookPoint int
+
+const (
+	// HookPreStart hooks run in Start before the child is created and
+	// can veto it returning an error. They can still change the Process,
+	// for example its Env
+	HookPreStart HookPoint = iota
+	// HookPostStart hooks run in the background right after the
+	// child is created
+	HookPostStart
+	// HookPostReady hooks run in the background once the Process is
+	// ready, see SetReadiness, after the HookPostStart ones
+	HookPostReady
+	// HookPreStop hooks run in Stop, and so in StopTimeout, before the
+	// CTRL-C event is sent. In StopTimeout they share the timeout with
+	// the graceful exit, see its documentation
+	HookPreStop
+	// HookPostExit hooks run after the child has exited, when IsRunning
+	// already reports false, but before the ExitStatus is reported: Wait
+	// returns only after they are done, so they must not wait for the
+	// Process, and the Process can't be started again until then
+	HookPostExit
+)
+
+func (hp HookPoint) String() string {
+	switch hp {
+	case HookPreStart:
+		return "pre-start"
+	case HookPostStart:
+		return "post-start"
+	case HookPostReady:
+		return "post-ready"
+	case HookPreStop:
+		return "pre-stop"
+	case HookPostExit:
+		return "post-exit"
+	default:
+		return fmt.Sprintf("HookPoint(%d)", int(hp))
+	}
+}
+
+// Hook is a function run at a point of the lifecycle of a Process. The
+// context is cancelled when the hook times out and, for the hooks running
+// in the background, when the Process exits
+type Hook func(ctx context.Context, p *Process) error
+
+// HookOptions are the options of a Hook
+type HookOptions struct {
+	// Name identifies the hook in the errors
+	Name string
+	// Order sorts the hooks of the same point, lower first;
+	// hooks with the same order run as they were added
+	Order int
+	// Timeout is the time given to the hook to complete, zero means no limit
+	Timeout time.Duration
+}
+
+// HookError is the error returned by a Hook
+type HookError struct {
+	Point HookPoint
+	Name  string
+	Err   error
+}
+
+func (e *HookError) Error() string {
+	if e.Name == "" {
+		return fmt.Sprintf("%s hook: %v", e.Point, e.Err)
+	}
+	return fmt.Sprintf("%s hook \"%s\": %v", e.Point, e.Name, e.Err)
+}
+
+func (e *HookError) Unwrap() error {
+	return e.Err
+}
+
+type hookEntry struct {
+	hook Hook
+	opts HookOptions
+}
+
+// AddHook registers a Hook to run at the given point of every run of
+// the Process. An error of a HookPreStart hook makes Start fail without
+// running the next hooks, while the errors of the other hooks are
+// reported in the ExitStatus of the run. It returns a function to
+// remove the hook
+func (p *Process) AddHook(point HookPoint, hook Hook, opts HookOptions) (remove func()) {
+	entry := &hookEntry{hook: hook, opts: opts}
+
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+
+	if p.hooks == nil {
+		p.hooks = make(map[HookPoint][]*hookEntry)
+	}
+	hooks := append(append([]*hookEntry(nil), p.hooks[point]...), entry)
+	sort.SliceStable(hooks, func(i, j int) bool {
+		return hooks[i].opts.Order < hooks[j].opts.Order
+	})
+	p.hooks[point] = hooks
+
+	return func() {
+		p.stateMu.Lock()
+		defer p.stateMu.Unlock()
+
+		hooks := make([]*hookEntry, 0, len(p.hooks[point]))
+		for _, h := range p.hooks[point] {
+			if h != entry {
+				hooks = append(hooks, h)
+			}
+		}
+		p.hooks[point] = hooks
+	}
+}
+
+func (p *Process) hasHooks(points ...HookPoint) bool {
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+
+	for _, point := range points {
+		if len(p.hooks[point]) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// runHooks runs the hooks of the given point in order. HookPreStart
+// hooks stop at the first error, which is returned; the errors of the
+// other hooks are collected and reported in the ExitStatus
+func (p *Process) runHooks(ctx context.Context, point HookPoint) error {
+	p.stateMu.Lock()
+	hooks := p.hooks[point]
+	p.stateMu.Unlock()
+
+	var errs []error
+	for _, h := range hooks {
+		err := runHook(ctx, p, h)
+		if err == nil {
+			continue
+		}
+
+		err = &HookError{Point: point, Name: h.opts.Name, Err: err}
+		if point == HookPreStart {
+			return err
+		}
+		errs = append(errs, err)
+	}
+
+	err := errors.Join(errs...)
+	if err != nil {
+		p.stateMu.Lock()
+		p.hookErrs = append(p.hookErrs, err)
+		p.stateMu.Unlock()
+	}
+	return err
+}
+
+func runHook(ctx context.Context, p *Process, h *hookEntry) error {
+	if h.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.opts.Timeout)
+		defer cancel()
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- h.hook(ctx, p)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// startHooks runs the HookPostStart and HookPostReady hooks
+// in the background for the run that has just started
+func (p *Process) startHooks(ctx context.Context) {
+	if !p.hasHooks(HookPostStart, HookPostReady) {
+		return
+	}
+
+	p.hookWG.Add(1)
+	go func() {
+		defer p.hookWG.Done()
+
+		p.runHooks(ctx, HookPostStart)
+		if p.hasHooks(HookPostReady) && p.WaitReady(ctx) == nil {
+			p.runHooks(ctx, HookPostReady)
+		}
+	}()
+}
+
+// exitHooks waits for the background hooks of the run, runs the
+// HookPostExit ones and returns the errors of all the hooks of the run
+func (p *Process) exitHooks(cancel context.CancelFunc) error {
+	cancel()
+	p.hookWG.Wait()
+	p.runHooks(context.Background(), HookPostExit)
+
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+
+	err := errors.Join(p.hookErrs...)
+	p.hookErrs = nil
+	return err
+}
+
+// CommandHook is a Hook that runs a command and fails if it
+// exits with an error. The command is killed if the context
+// is cancelled
+func CommandHook(wd string, execPath string, args ...string) Hook {
+	return func(ctx context.Context, p *Process) error {
+		cmd, err := NewProcess(wd, execPath, args...)
+		if err != nil {
+			return err
+		}
+		defer cmd.Close()
+
+		if err := cmd.Start(DevNull(), nil, nil); err != nil {
+			return err
+		}
+
+		exited := make(chan ExitStatus, 1)
+		go func() {
+			exited <- cmd.Wait()
+		}()
+
+		select {
+		case exitStatus := <-exited:
+			if exitStatus.ExitCode != 0 {
+				return fmt.Errorf("command \"%s\" exit status (code 0x%x): %s", execPath, exitStatus.ExitCode, bytes.TrimSpace(cmd.Stderr()))
+			}
+			return nil
+		case <-ctx.Done():
+			cmd.Kill()
+			<-exited
+			return ctx.Err()
+		}
+	}
+}
+
+func (p *Process) cloneHooks() map[HookPoint][]*hookEntry {
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+
+	hooks := make(map[HookPoint][]*hookEntry, len(p.hooks))
+	for point, entries := range p.hooks {
+		hooks[point] = entries
+	}
+	return hooks
+}
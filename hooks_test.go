@@ -0,0 +1,66 @@
+package process
+
+import (
+	"context"
+	"os"
+	"testing"
+)
+
+func TestPostExitHookAfterRunning(t *testing.T) {
+	p, err := NewProcess("", os.Args[0], "-test.run=^$")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	var running bool
+	var startErr error
+	p.AddHook(HookPostExit, func(ctx context.Context, p *Process) error {
+		running = p.IsRunning()
+		startErr = p.Start(nil, nil, nil)
+		return nil
+	}, HookOptions{})
+
+	if _, err := p.Run(nil, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if running {
+		t.Error("IsRunning() = true in a post-exit hook")
+	}
+	if startErr == nil {
+		t.Error("Start in a post-exit hook: expected an error")
+	}
+}
+
+func TestCommandHookStdin(t *testing.T) {
+	p, err := NewProcess("", os.Args[0], "-test.run=^$")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	// a command reading its standard input must see it closed
+	hook := CommandHook("", os.Args[0], "-test.run=^TestHelperStdin$")
+	os.Setenv("PROCESS_HELPER_STDIN", "1")
+	defer os.Unsetenv("PROCESS_HELPER_STDIN")
+
+	if err := hook(context.Background(), p); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestHelperStdin is not a real test: it's run as a child by
+// TestCommandHookStdin and reads its standard input until EOF
+func TestHelperStdin(t *testing.T) {
+	if os.Getenv("PROCESS_HELPER_STDIN") == "" {
+		return
+	}
+
+	buf := make([]byte, 512)
+	for {
+		if _, err := os.Stdin.Read(buf); err != nil {
+			os.Exit(0)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+//go:build !windows
+
+package process
+
+import (
+	"context"
+	"errors"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestPreStopHookWithinTimeout(t *testing.T) {
+	p := startShell(t, "exec sleep 10")
+	p.AddHook(HookPreStop, func(ctx context.Context, p *Process) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, HookOptions{Name: "slow"})
+
+	start := time.Now()
+	exitStatus, err := p.StopTimeout(200 * time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("StopTimeout took %v with a hook slower than the timeout", elapsed)
+	}
+
+	if sig, ok := exitStatus.Signal(); !ok || sig != syscall.SIGKILL {
+		t.Errorf("signal = %v, %v, want the kill after the timeout", sig, ok)
+	}
+	var hookErr *HookError
+	if !errors.As(exitStatus.HookError, &hookErr) || hookErr.Point != HookPreStop ||
+		!errors.Is(hookErr, context.DeadlineExceeded) {
+		t.Errorf("HookError = %v, want the deadline of the pre-stop hook", exitStatus.HookError)
+	}
+}
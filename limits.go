@@ -0,0 +1,30 @@
+package process
+
+import "errors"
+
+// Limits are the resource limits of a Process, supported only on Linux.
+// They are applied to the child before the program is executed: the
+// child is started through "/bin/sh", which waits for the limits to be set
+// with prlimit and then replaces itself with the program. A nil field
+// leaves the corresponding limit inherited from the parent process.
+//
+// A Process terminated for exceeding the CPU time or the file size limit
+// is reported by ExitStatus.LimitExceeded
+type Limits struct {
+	// AddressSpace is the maximum size of the virtual memory, in bytes
+	AddressSpace *uint64 `json:"address_space,omitempty" toml:"address_space,omitempty"`
+	// CPUTime is the maximum CPU time, in seconds
+	CPUTime *uint64 `json:"cpu_time,omitempty" toml:"cpu_time,omitempty"`
+	// CoreSize is the maximum size of a core dump, in bytes
+	CoreSize *uint64 `json:"core_size,omitempty" toml:"core_size,omitempty"`
+	// FileSize is the maximum size of a file written by the Process, in bytes
+	FileSize *uint64 `json:"file_size,omitempty" toml:"file_size,omitempty"`
+	// OpenFiles is the maximum number of open file descriptors
+	OpenFiles *uint64 `json:"open_files,omitempty" toml:"open_files,omitempty"`
+	// Processes is the maximum number of processes of the user
+	Processes *uint64 `json:"processes,omitempty" toml:"processes,omitempty"`
+}
+
+// ErrLimitsUnsupported is returned by Start when resource
+// limits can't be applied to a Process
+var ErrLimitsUnsupported = errors.New("resource limits are not supported")
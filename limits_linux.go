@@ -0,0 +1,117 @@
+package process
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+// limitsShell is the shell running limitsTrampoline, found at the
+// path fixed by POSIX instead of the PATH of the parent
+const limitsShell = "/bin/sh"
+
+// limitsTrampoline is run by the shell in place of the program: it waits
+// for the parent to apply the limits, signaled by a line written on the
+// fd passed as the first argument, and then replaces itself with the
+// program, which keeps the same PID and inherits the limits. If the
+// parent closes the pipe without writing, the program is never executed
+const limitsTrampoline = `fd=$1; shift; read -r _ <&"$fd" || exit 126; eval "exec $fd<&-"; exec "$0" "$@"`
+
+// limitsGate holds the child, started through limitsTrampoline,
+// until its limits are applied
+type limitsGate struct {
+	limits *Limits
+	r, w   *os.File
+}
+
+// prepareLimits replaces the command with limitsTrampoline if the
+// Process has Limits
+func (p *Process) prepareLimits() (*limitsGate, error) {
+	if p.Limits == nil {
+		return nil, nil
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := os.Stat(limitsShell); err != nil {
+		r.Close()
+		w.Close()
+		return nil, fmt.Errorf("%w: %w", ErrLimitsUnsupported, err)
+	}
+
+	// the files of ExtraFiles are numbered from 3 in the child, so the
+	// pipe is appended to keep the ones of the caller where they are
+	fd := 3 + len(p.Exec.ExtraFiles)
+	p.Exec.ExtraFiles = append(p.Exec.ExtraFiles, r)
+
+	args := []string{"sh", "-c", limitsTrampoline, p.Exec.Path, strconv.Itoa(fd)}
+	p.Exec.Args = append(args, p.Exec.Args[1:]...)
+	p.Exec.Path = limitsShell
+
+	return &limitsGate{limits: p.Limits, r: r, w: w}, nil
+}
+
+// release applies the limits to the child and lets it execute the
+// program. If the limits can't be applied, the child exits without
+// executing it
+func (g *limitsGate) release(pid int) error {
+	if g == nil {
+		return nil
+	}
+
+	g.r.Close()
+	defer g.w.Close()
+
+	for _, l := range []struct {
+		name     string
+		resource int
+		value    *uint64
+	}{
+		{"address_space", unix.RLIMIT_AS, g.limits.AddressSpace},
+		{"cpu_time", unix.RLIMIT_CPU, g.limits.CPUTime},
+		{"core_size", unix.RLIMIT_CORE, g.limits.CoreSize},
+		{"file_size", unix.RLIMIT_FSIZE, g.limits.FileSize},
+		{"open_files", unix.RLIMIT_NOFILE, g.limits.OpenFiles},
+		{"processes", unix.RLIMIT_NPROC, g.limits.Processes},
+	} {
+		if l.value == nil {
+			continue
+		}
+
+		rlim := &unix.Rlimit{Cur: *l.value, Max: *l.value}
+		raised := l.resource == unix.RLIMIT_CPU && rlim.Max != unix.RLIM_INFINITY
+		if raised {
+			// the kernel sends SIGKILL when the hard limit is reached,
+			// so it's kept higher to let SIGXCPU terminate the child
+			rlim.Max++
+		}
+		err := unix.Prlimit(pid, l.resource, rlim, nil)
+		if raised && errors.Is(err, unix.EPERM) {
+			// the value is the hard limit of the parent, which
+			// can't be raised without privileges
+			rlim.Max--
+			err = unix.Prlimit(pid, l.resource, rlim, nil)
+		}
+		if err != nil {
+			return fmt.Errorf("limit %s: %w", l.name, err)
+		}
+	}
+
+	_, err := g.w.Write([]byte{'\n'})
+	return err
+}
+
+// abort closes the pipe when the child could not start
+func (g *limitsGate) abort() {
+	if g == nil {
+		return
+	}
+	g.r.Close()
+	g.w.Close()
+}
@@ -0,0 +1,84 @@
+package process
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestLimitsApplied(t *testing.T) {
+	openFiles, cpuTime := uint64(64), uint64(unix.RLIM_INFINITY)
+	p := newShell(t, `ulimit -n; ulimit -t; echo "$0 $1"`)
+	p.args = append(p.args, "zero", "one")
+	p.Limits = &Limits{OpenFiles: &openFiles, CPUTime: &cpuTime}
+
+	var out bytes.Buffer
+	if _, err := p.Run(DevNull(), &out, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// the arguments after the script are passed to the program unchanged
+	if got, want := out.String(), "64\nunlimited\nzero one\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
+
+func TestLimitsKeepExtraFiles(t *testing.T) {
+	openFiles := uint64(64)
+	p := newShell(t, "true")
+	p.Limits = &Limits{OpenFiles: &openFiles}
+
+	f, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	p.initCommand()
+	p.Exec.ExtraFiles = []*os.File{f}
+	gate, err := p.prepareLimits()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gate.abort()
+
+	if len(p.Exec.ExtraFiles) != 2 || p.Exec.ExtraFiles[0] != f {
+		t.Fatalf("ExtraFiles = %v, want the caller file followed by the gate", p.Exec.ExtraFiles)
+	}
+	// sh -c script program fd args...
+	if got := p.Exec.Args[4]; got != "4" {
+		t.Errorf("gate fd = %s, want 4", got)
+	}
+}
+
+func TestLimitExceeded(t *testing.T) {
+	fileSize, cpuTime := uint64(4096), uint64(1)
+	tests := []struct {
+		limit  string
+		script string
+		limits Limits
+	}{
+		{"file_size", `exec dd if=/dev/zero of="$0" bs=1024 count=64`, Limits{FileSize: &fileSize}},
+		{"cpu_time", "while :; do :; done", Limits{CPUTime: &cpuTime}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.limit, func(t *testing.T) {
+			p := newShell(t, tt.script)
+			p.args = append(p.args, filepath.Join(t.TempDir(), "out"))
+			p.Limits = &tt.limits
+
+			exitStatus, err := p.Run(DevNull(), nil, nil)
+			if err == nil || !strings.HasPrefix(err.Error(), tt.limit+" limit exceeded") {
+				t.Errorf("Run = %v, want the limit exceeded", err)
+			}
+			if limit, ok := exitStatus.LimitExceeded(); !ok || limit != tt.limit {
+				t.Errorf("LimitExceeded = %q, %v, want %q", limit, ok, tt.limit)
+			}
+		})
+	}
+}
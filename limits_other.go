@@ -0,0 +1,20 @@
+//go:build !linux
+
+package process
+
+type limitsGate struct{}
+
+// prepareLimits fails if the Process has Limits, which
+// are supported only on Linux
+func (p *Process) prepareLimits() (*limitsGate, error) {
+	if p.Limits == nil {
+		return nil, nil
+	}
+	return nil, ErrLimitsUnsupported
+}
+
+func (g *limitsGate) release(pid int) error {
+	return nil
+}
+
+func (g *limitsGate) abort() {}
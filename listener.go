@@ -0,0 +1,244 @@
+package process
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ListenerPolicy decides what happens when an OutputListener is not
+// consuming the lines of a Process fast enough
+type ListenerPolicy int
+
+const (
+	// ListenerBlock waits for the consumer to read the line: no line is
+	// ever lost, but a stuck consumer stalls the output pipe and, once the
+	// pipe is full, the child itself. This is how StdoutListener
+	// and StderrListener behave
+	ListenerBlock ListenerPolicy = iota
+	// ListenerDropOldest discards the oldest buffered line to make
+	// room for the new one
+	ListenerDropOldest
+	// ListenerDropNewest discards the new line when the buffer is full
+	ListenerDropNewest
+	// ListenerDisconnect waits up to ListenerOptions.Timeout for the
+	// consumer, then discards the line and closes the listener
+	ListenerDisconnect
+)
+
+// ListenerOptions configures an OutputListener. With any policy other than
+// ListenerBlock, BufSize is at least 1
+type ListenerOptions struct {
+	BufSize int
+	Policy  ListenerPolicy
+	Timeout time.Duration
+}
+
+// OutputListener receives every line written by a Process on one of its
+// output streams, from the moment it's created until the Process is
+// started again or closed, when the channel is closed. A listener created
+// while the Process is not running receives the lines of its next run
+// instead. Lines never block the Process for longer than the policy
+// allows, and lines that are discarded are counted
+type OutputListener struct {
+	ch   chan []byte
+	done chan struct{}
+	opts ListenerOptions
+	set  *listenerSet
+	// nextRun is set for the listeners that must survive the
+	// reset of the next start, guarded by the listenerSet
+	nextRun      bool
+	mu           sync.Mutex
+	closeOnce    sync.Once
+	dropped      atomic.Uint64
+	disconnected atomic.Bool
+}
+
+// Ch returns the channel of the lines
+func (l *OutputListener) Ch() <-chan []byte {
+	return l.ch
+}
+
+// Dropped returns the number of lines discarded so far
+func (l *OutputListener) Dropped() uint64 {
+	return l.dropped.Load()
+}
+
+// Disconnected reports whether the listener was closed because
+// the consumer exceeded the ListenerDisconnect timeout
+func (l *OutputListener) Disconnected() bool {
+	return l.disconnected.Load()
+}
+
+// Close unregisters the listener and closes its channel
+func (l *OutputListener) Close() {
+	l.closeOnce.Do(func() {
+		close(l.done)
+
+		l.mu.Lock()
+		close(l.ch)
+		l.mu.Unlock()
+
+		if l.set != nil {
+			l.set.remove(l)
+		}
+	})
+}
+
+func (l *OutputListener) send(line []byte) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	select {
+	case <-l.done:
+		return
+	default:
+	}
+
+	switch l.opts.Policy {
+	case ListenerBlock:
+		select {
+		case l.ch <- line:
+		case <-l.done:
+		}
+	case ListenerDropOldest:
+		select {
+		case l.ch <- line:
+			return
+		default:
+		}
+
+		select {
+		case <-l.ch:
+			l.dropped.Add(1)
+		default:
+		}
+
+		select {
+		case l.ch <- line:
+		default:
+			l.dropped.Add(1)
+		}
+	case ListenerDropNewest:
+		select {
+		case l.ch <- line:
+		default:
+			l.dropped.Add(1)
+		}
+	case ListenerDisconnect:
+		timer := time.NewTimer(l.opts.Timeout)
+		defer timer.Stop()
+
+		select {
+		case l.ch <- line:
+		case <-l.done:
+		case <-timer.C:
+			l.dropped.Add(1)
+			l.disconnected.Store(true)
+			go l.Close()
+		}
+	}
+}
+
+// listenerSet holds the OutputListeners of an output stream
+type listenerSet struct {
+	mu        sync.RWMutex
+	listeners map[*OutputListener]struct{}
+	closed    bool
+}
+
+func newListenerSet() *listenerSet {
+	return &listenerSet{listeners: make(map[*OutputListener]struct{})}
+}
+
+func (ls *listenerSet) register(opts ListenerOptions, nextRun bool) *OutputListener {
+	if opts.Policy != ListenerBlock && opts.BufSize < 1 {
+		opts.BufSize = 1
+	}
+
+	l := &OutputListener{
+		ch:   make(chan []byte, opts.BufSize),
+		done: make(chan struct{}),
+		opts: opts,
+	}
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	if ls.closed {
+		l.Close()
+		return l
+	}
+
+	l.set = ls
+	l.nextRun = nextRun
+	ls.listeners[l] = struct{}{}
+	return l
+}
+
+func (ls *listenerSet) remove(l *OutputListener) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+
+	delete(ls.listeners, l)
+}
+
+func (ls *listenerSet) snapshot() []*OutputListener {
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+
+	listeners := make([]*OutputListener, 0, len(ls.listeners))
+	for l := range ls.listeners {
+		listeners = append(listeners, l)
+	}
+	return listeners
+}
+
+func (ls *listenerSet) send(line []byte) {
+	for _, l := range ls.snapshot() {
+		l.send(line)
+	}
+}
+
+// reset is called at every start and closes the listeners of the
+// previous run, keeping the ones registered for this run
+func (ls *listenerSet) reset() {
+	ls.mu.Lock()
+	var old []*OutputListener
+	for l := range ls.listeners {
+		if l.nextRun {
+			l.nextRun = false
+		} else {
+			old = append(old, l)
+		}
+	}
+	ls.mu.Unlock()
+
+	for _, l := range old {
+		l.Close()
+	}
+}
+
+// close closes every registered listener and the
+// ones that will be registered in the future
+func (ls *listenerSet) close() {
+	ls.mu.Lock()
+	ls.closed = true
+	ls.mu.Unlock()
+
+	for _, l := range ls.snapshot() {
+		l.Close()
+	}
+}
+
+// StdoutListenerWith returns an OutputListener for the standard
+// output with the given options
+func (p *Process) StdoutListenerWith(opts ListenerOptions) *OutputListener {
+	return p.outLs.register(opts, !p.IsRunning())
+}
+
+// StderrListenerWith returns an OutputListener for the standard
+// error with the given options
+func (p *Process) StderrListenerWith(opts ListenerOptions) *OutputListener {
+	return p.errLs.register(opts, !p.IsRunning())
+}
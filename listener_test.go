@@ -0,0 +1,189 @@
+package process
+
+import (
+	"runtime"
+	"slices"
+	"testing"
+	"time"
+)
+
+// drain reads every line until the channel is closed
+func drain(t *testing.T, ch <-chan []byte) []string {
+	t.Helper()
+
+	var lines []string
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case line, ok := <-ch:
+			if !ok {
+				return lines
+			}
+			lines = append(lines, string(line))
+		case <-timeout:
+			t.Fatalf("the listener was never closed, got %q", lines)
+		}
+	}
+}
+
+func sendAll(ls *listenerSet, lines ...string) {
+	for _, line := range lines {
+		ls.send([]byte(line))
+	}
+}
+
+func TestListenerBlock(t *testing.T) {
+	ls := newListenerSet()
+	l := ls.register(ListenerOptions{Policy: ListenerBlock}, false)
+
+	sent := make(chan struct{})
+	go func() {
+		sendAll(ls, "a")
+		close(sent)
+	}()
+
+	select {
+	case <-sent:
+		t.Fatal("send returned before the line was read")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if line := <-l.Ch(); string(line) != "a" {
+		t.Fatalf("got %q, want %q", line, "a")
+	}
+	<-sent
+
+	// Close must unblock a pending send
+	sent = make(chan struct{})
+	go func() {
+		sendAll(ls, "b")
+		close(sent)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	l.Close()
+
+	select {
+	case <-sent:
+	case <-time.After(time.Second):
+		t.Fatal("Close didn't unblock the pending send")
+	}
+	if l.Dropped() != 0 {
+		t.Errorf("Dropped() = %d, want 0", l.Dropped())
+	}
+}
+
+func TestListenerDropOldest(t *testing.T) {
+	ls := newListenerSet()
+	l := ls.register(ListenerOptions{Policy: ListenerDropOldest, BufSize: 2}, false)
+
+	sendAll(ls, "a", "b", "c")
+	l.Close()
+
+	if got, want := drain(t, l.Ch()), []string{"b", "c"}; !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if l.Dropped() != 1 {
+		t.Errorf("Dropped() = %d, want 1", l.Dropped())
+	}
+}
+
+func TestListenerDropNewest(t *testing.T) {
+	ls := newListenerSet()
+	l := ls.register(ListenerOptions{Policy: ListenerDropNewest, BufSize: 2}, false)
+
+	sendAll(ls, "a", "b", "c", "d")
+	l.Close()
+
+	if got, want := drain(t, l.Ch()), []string{"a", "b"}; !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if l.Dropped() != 2 {
+		t.Errorf("Dropped() = %d, want 2", l.Dropped())
+	}
+}
+
+func TestListenerDisconnect(t *testing.T) {
+	ls := newListenerSet()
+	l := ls.register(ListenerOptions{Policy: ListenerDisconnect, BufSize: 1, Timeout: 20 * time.Millisecond}, false)
+
+	start := time.Now()
+	sendAll(ls, "a", "b", "c")
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("send blocked for %v", d)
+	}
+
+	if got, want := drain(t, l.Ch()), []string{"a"}; !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if !l.Disconnected() {
+		t.Error("Disconnected() = false, want true")
+	}
+	if l.Dropped() != 1 {
+		t.Errorf("Dropped() = %d, want 1", l.Dropped())
+	}
+	if n := len(ls.snapshot()); n != 0 {
+		t.Errorf("%d listeners still registered", n)
+	}
+}
+
+func TestListenerReset(t *testing.T) {
+	ls := newListenerSet()
+	old := ls.register(ListenerOptions{BufSize: 1}, false)
+	next := ls.register(ListenerOptions{BufSize: 1}, true)
+
+	ls.reset()
+	if got := drain(t, old.Ch()); len(got) != 0 {
+		t.Errorf("old listener got %q", got)
+	}
+
+	sendAll(ls, "a")
+	if line := <-next.Ch(); string(line) != "a" {
+		t.Errorf("got %q, want %q", line, "a")
+	}
+
+	// the listener only survives the first reset
+	ls.reset()
+	drain(t, next.Ch())
+}
+
+func TestListenerBeforeStart(t *testing.T) {
+	var p *Process
+	var err error
+	if runtime.GOOS == "windows" {
+		p, err = NewProcess("", "cmd", "/c", "echo one& echo two")
+	} else {
+		p, err = NewProcess("", "sh", "-c", "echo one; echo two")
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	l := p.StdoutListenerWith(ListenerOptions{Policy: ListenerDropNewest, BufSize: 8})
+
+	if err := p.Start(nil, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	p.Wait()
+
+	// the listener stays open until the next start
+	var got []string
+	for len(got) < 2 {
+		select {
+		case line := <-l.Ch():
+			got = append(got, string(bytesTrimCR(line)))
+		case <-time.After(5 * time.Second):
+			t.Fatalf("got %q", got)
+		}
+	}
+	if want := []string{"one", "two"}; !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func bytesTrimCR(b []byte) []byte {
+	for len(b) > 0 && (b[len(b)-1] == '\r' || b[len(b)-1] == ' ') {
+		b = b[:len(b)-1]
+	}
+	return b
+}
@@ -0,0 +1,47 @@
+package process
+
+type lifecycleKind int
+
+const (
+	lifecycleStarted lifecycleKind = iota
+	lifecycleReady
+	lifecycleExited
+)
+
+// lifecycleEvent is a change of state of a Process,
+// notified to its observers
+type lifecycleEvent struct {
+	kind       lifecycleKind
+	runID      uint64
+	pid        int
+	exitStatus ExitStatus
+}
+
+// observe registers fn to be called on every lifecycle event of the
+// Process. The function is called with the state lock held, so it must
+// not block or call the Process methods
+func (p *Process) observe(fn func(lifecycleEvent)) (remove func()) {
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+
+	if p.observers == nil {
+		p.observers = make(map[uint64]func(lifecycleEvent))
+	}
+
+	id := p.nextObserver
+	p.nextObserver++
+	p.observers[id] = fn
+
+	return func() {
+		p.stateMu.Lock()
+		defer p.stateMu.Unlock()
+
+		delete(p.observers, id)
+	}
+}
+
+func (p *Process) emitLocked(e lifecycleEvent) {
+	for _, fn := range p.observers {
+		fn(e)
+	}
+}
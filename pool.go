@@ -0,0 +1,427 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// PoolOptions are the options of a Pool
+type PoolOptions struct {
+	// IndexVar is the environment variable holding the index of
+	// a replica, POOL_INDEX if empty
+	IndexVar string
+	// PortVar is the environment variable holding the port of
+	// a replica, PORT if empty
+	PortVar string
+	// BasePort is the port of the replica with index 0, the others get
+	// the following ones. If zero, each index gets a port that is free
+	// when the Pool picks it, but another program can take it before the
+	// replica binds it: set BasePort to a reserved range to avoid that
+	BasePort int
+	// RestartDelay is the time waited before replacing a crashed replica
+	RestartDelay time.Duration
+	// StopTimeout is the time given to a replica to exit after the CTRL-C
+	// event before being killed
+	StopTimeout time.Duration
+	// ReadyTimeout is the maximum time a rolling restart waits for a
+	// new replica to become ready, zero means no limit
+	ReadyTimeout time.Duration
+	// StartFirst makes a rolling restart start each new replica, and wait
+	// for it to be ready, before stopping the old one, so that the Pool
+	// never has fewer replicas running. As the two share the port for a
+	// while, the child must bind it with SO_REUSEPORT or equivalent
+	StartFirst bool
+}
+
+// Replica is a child of a Pool
+type Replica struct {
+	Index   int
+	Port    int
+	Process *Process
+	// Restarts is the number of times the replica was replaced
+	// after crashing
+	Restarts int
+}
+
+// ErrPoolStopped is returned by the methods of a stopped Pool
+var ErrPoolStopped = errors.New("pool stopped")
+
+// Pool maintains a number of replicas of a template Process, each one
+// a Process.Clone with its index and a unique port added to its Env.
+// Crashed replicas are replaced with new ones with the same index
+// and port, while replicas that exit successfully are done and
+// removed from the Pool
+type Pool struct {
+	template *Process
+	opts     PoolOptions
+	opMu     sync.Mutex
+	mu       sync.Mutex
+	replicas []*replica
+	ports    map[int]int
+	stopped  bool
+}
+
+type replica struct {
+	index, port int
+	p           *Process
+	restarts    int
+	stopping    bool
+	stop        chan struct{}
+	done        chan struct{}
+}
+
+// NewPool creates a Pool of replicas of the template Process,
+// which is never started itself
+func NewPool(template *Process, opts PoolOptions) *Pool {
+	if opts.IndexVar == "" {
+		opts.IndexVar = "POOL_INDEX"
+	}
+	if opts.PortVar == "" {
+		opts.PortVar = "PORT"
+	}
+	return &Pool{template: template, opts: opts, ports: make(map[int]int)}
+}
+
+// Replicas returns the current replicas, the oldest first
+func (pl *Pool) Replicas() []Replica {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+
+	replicas := make([]Replica, 0, len(pl.replicas))
+	for _, r := range pl.replicas {
+		replicas = append(replicas, Replica{Index: r.index, Port: r.port, Process: r.p, Restarts: r.restarts})
+	}
+	return replicas
+}
+
+// Size returns the number of replicas
+func (pl *Pool) Size() int {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+
+	return len(pl.replicas)
+}
+
+// Scale starts or stops replicas until there are n of them. New replicas
+// get the lowest free indexes, while the newest replicas are stopped first
+func (pl *Pool) Scale(n int) error {
+	pl.opMu.Lock()
+	defer pl.opMu.Unlock()
+
+	for pl.Size() < n {
+		pl.mu.Lock()
+		if pl.stopped {
+			pl.mu.Unlock()
+			return ErrPoolStopped
+		}
+		index := pl.freeIndexLocked()
+		pl.mu.Unlock()
+
+		r, err := pl.startReplica(index)
+		if err != nil {
+			return err
+		}
+
+		pl.mu.Lock()
+		pl.replicas = append(pl.replicas, r)
+		pl.mu.Unlock()
+	}
+
+	for {
+		pl.mu.Lock()
+		if len(pl.replicas) <= n {
+			pl.mu.Unlock()
+			return nil
+		}
+		r := pl.replicas[len(pl.replicas)-1]
+		pl.replicas = pl.replicas[:len(pl.replicas)-1]
+		pl.mu.Unlock()
+
+		pl.stopReplica(r)
+	}
+}
+
+// RollingRestart replaces the replicas one at a time, the oldest first:
+// each one is stopped and a new one with the same index and port is
+// started, waiting for it to be ready before moving to the next one.
+// A replica is down between the stop and the start of the new one, so a
+// Pool with a single replica is down too, unless StartFirst is set.
+// It stops at the first replica that fails to start or become ready
+func (pl *Pool) RollingRestart(ctx context.Context) error {
+	pl.opMu.Lock()
+	defer pl.opMu.Unlock()
+
+	pl.mu.Lock()
+	old := append([]*replica(nil), pl.replicas...)
+	pl.mu.Unlock()
+
+	for _, r := range old {
+		pl.mu.Lock()
+		if pl.stopped {
+			pl.mu.Unlock()
+			return ErrPoolStopped
+		}
+		// the replica could have exited successfully in the meantime
+		removed := pl.indexLocked(r) < 0
+		pl.mu.Unlock()
+		if removed {
+			continue
+		}
+
+		if pl.opts.StartFirst {
+			if err := pl.replaceStartFirst(ctx, r); err != nil {
+				return err
+			}
+			continue
+		}
+
+		pl.stopReplica(r)
+		nr, err := pl.startReplica(r.index)
+
+		pl.mu.Lock()
+		if i := pl.indexLocked(r); i >= 0 {
+			if err == nil {
+				pl.replicas[i] = nr
+			} else {
+				pl.replicas = append(pl.replicas[:i], pl.replicas[i+1:]...)
+			}
+		}
+		pl.mu.Unlock()
+
+		if err != nil {
+			return err
+		}
+		if err := pl.waitReady(ctx, nr); err != nil {
+			return fmt.Errorf("pool replica %d: %w", nr.index, err)
+		}
+	}
+	return nil
+}
+
+// replaceStartFirst replaces the replica with a new one that is started,
+// and ready, before the old one is stopped. The old one is kept if the
+// new one fails
+func (pl *Pool) replaceStartFirst(ctx context.Context, r *replica) error {
+	nr, err := pl.startReplica(r.index)
+	if err != nil {
+		return err
+	}
+	if err := pl.waitReady(ctx, nr); err != nil {
+		pl.stopReplica(nr)
+		return fmt.Errorf("pool replica %d: %w", nr.index, err)
+	}
+
+	pl.mu.Lock()
+	i := pl.indexLocked(r)
+	if i >= 0 {
+		pl.replicas[i] = nr
+	} else {
+		pl.replicas = append(pl.replicas, nr)
+	}
+	pl.mu.Unlock()
+
+	pl.stopReplica(r)
+	return nil
+}
+
+// indexLocked returns the position of the replica in
+// the Pool, or -1 if it's not part of it anymore
+func (pl *Pool) indexLocked(r *replica) int {
+	for i, cur := range pl.replicas {
+		if cur == r {
+			return i
+		}
+	}
+	return -1
+}
+
+func (pl *Pool) waitReady(ctx context.Context, r *replica) error {
+	if pl.opts.ReadyTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, pl.opts.ReadyTimeout)
+		defer cancel()
+	}
+
+	pl.mu.Lock()
+	p := r.p
+	pl.mu.Unlock()
+	return p.WaitReady(ctx)
+}
+
+// Stop stops every replica, killing the ones still running after the
+// StopTimeout, and returns when all of them have exited. It waits for
+// a running Scale or RollingRestart to complete first. The Pool can't
+// be used anymore
+func (pl *Pool) Stop() {
+	pl.opMu.Lock()
+	defer pl.opMu.Unlock()
+
+	pl.mu.Lock()
+	pl.stopped = true
+	replicas := pl.replicas
+	pl.replicas = nil
+	pl.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, r := range replicas {
+		wg.Add(1)
+		go func(r *replica) {
+			defer wg.Done()
+			pl.stopReplica(r)
+		}(r)
+	}
+	wg.Wait()
+}
+
+func (pl *Pool) freeIndexLocked() int {
+	used := make(map[int]bool, len(pl.replicas))
+	for _, r := range pl.replicas {
+		used[r.index] = true
+	}
+
+	index := 0
+	for used[index] {
+		index++
+	}
+	return index
+}
+
+// port returns the port of the given index, the same for every
+// replica with that index
+func (pl *Pool) port(index int) (int, error) {
+	if pl.opts.BasePort > 0 {
+		return pl.opts.BasePort + index, nil
+	}
+
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+
+	if port, ok := pl.ports[index]; ok {
+		return port, nil
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, fmt.Errorf("pool replica %d: port allocation: %w", index, err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	pl.ports[index] = port
+	return port, nil
+}
+
+// newProcess creates the Process of a replica from the template
+func (pl *Pool) newProcess(index, port int) *Process {
+	p := pl.template.Clone()
+	if len(p.Env) == 0 {
+		p.Env = os.Environ()
+	}
+	p.Env = append(p.Env,
+		pl.opts.IndexVar+"="+strconv.Itoa(index),
+		pl.opts.PortVar+"="+strconv.Itoa(port),
+	)
+	return p
+}
+
+func (pl *Pool) startReplica(index int) (*replica, error) {
+	port, err := pl.port(index)
+	if err != nil {
+		return nil, err
+	}
+
+	p := pl.newProcess(index, port)
+	if err := p.Start(DevNull(), nil, nil); err != nil {
+		p.Close()
+		return nil, fmt.Errorf("pool replica %d: %w", index, err)
+	}
+
+	r := &replica{index: index, port: port, p: p, stop: make(chan struct{}), done: make(chan struct{})}
+	go pl.supervise(r)
+	return r, nil
+}
+
+// stopReplica stops the replica, without replacing it, and waits
+// for its supervisor to return
+func (pl *Pool) stopReplica(r *replica) {
+	pl.mu.Lock()
+	r.stopping = true
+	close(r.stop)
+	p := r.p
+	pl.mu.Unlock()
+
+	p.StopTimeout(pl.opts.StopTimeout)
+	<-r.done
+	p.Close()
+}
+
+// supervise replaces the Process of the replica every time it exits
+// with an error or by a signal, as classified by Group, until the
+// replica is stopped. A replica that exits successfully is removed
+// from the Pool
+func (pl *Pool) supervise(r *replica) {
+	defer close(r.done)
+
+	pl.mu.Lock()
+	p := r.p
+	pl.mu.Unlock()
+
+	var startErr error
+	for {
+		exitStatus := p.Wait()
+
+		pl.mu.Lock()
+		stopping, done := r.stopping, !r.stopping && exitStatus.Error() == nil && signalError(exitStatus) == nil
+		if i := pl.indexLocked(r); done && i >= 0 {
+			pl.replicas = append(pl.replicas[:i], pl.replicas[i+1:]...)
+		}
+		pl.mu.Unlock()
+		if done {
+			p.Close()
+		}
+		if stopping || done {
+			return
+		}
+
+		delay := pl.opts.RestartDelay
+		if startErr != nil {
+			// don't spin when the replacement can't start
+			delay = max(delay, time.Second)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-r.stop:
+			timer.Stop()
+			return
+		}
+
+		np := pl.newProcess(r.index, r.port)
+		startErr = np.Start(DevNull(), nil, nil)
+		if startErr != nil {
+			np.Close()
+			continue
+		}
+
+		// stopReplica can't see the new Process while it's starting,
+		// so it's stopped here if the replica was stopped meanwhile
+		pl.mu.Lock()
+		if r.stopping {
+			pl.mu.Unlock()
+			np.StopTimeout(pl.opts.StopTimeout)
+			np.Close()
+			return
+		}
+		p.Close()
+		r.p, p = np, np
+		r.restarts++
+		pl.mu.Unlock()
+	}
+}
@@ -0,0 +1,125 @@
+//go:build !windows
+
+package process
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestPoolSuccessfulExitNotReplaced(t *testing.T) {
+	pl := NewPool(newShell(t, "exit 0"), PoolOptions{BasePort: 20000})
+	defer pl.Stop()
+
+	if err := pl.Scale(2); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the replicas to be removed", func() bool { return pl.Size() == 0 })
+}
+
+func TestPoolSignalReplaced(t *testing.T) {
+	template := newShell(t, "sleep 0.3; kill -SEGV $$")
+
+	var starts atomic.Int32
+	template.AddHook(HookPreStart, func(ctx context.Context, p *Process) error {
+		starts.Add(1)
+		return nil
+	}, HookOptions{})
+
+	pl := NewPool(template, PoolOptions{BasePort: 20000, StopTimeout: time.Second})
+	defer pl.Stop()
+
+	// a death by signal is a crash, even without an exit code
+	if err := pl.Scale(2); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the replacements to start", func() bool { return starts.Load() >= 4 })
+	if n := pl.Size(); n != 2 {
+		t.Errorf("Size = %d after the crashes, want 2", n)
+	}
+}
+
+func TestPoolCrashReplacedWithoutLock(t *testing.T) {
+	template := newShell(t, "read line; exit 1")
+
+	var starts atomic.Int32
+	release := make(chan struct{})
+	template.AddHook(HookPreStart, func(ctx context.Context, p *Process) error {
+		if starts.Add(1) > 1 {
+			<-release
+		}
+		return nil
+	}, HookOptions{})
+
+	pl := NewPool(template, PoolOptions{BasePort: 20000, StopTimeout: time.Second})
+	defer pl.Stop()
+	defer close(release)
+
+	// the replica reads its standard input, which must be closed
+	if err := pl.Scale(1); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the replacement to start", func() bool { return starts.Load() == 2 })
+
+	done := make(chan struct{})
+	go func() {
+		pl.Replicas()
+		pl.Size()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the Pool is locked by a starting replica")
+	}
+}
+
+func TestPoolRollingRestartStartFirst(t *testing.T) {
+	template := newShell(t, "exec sleep 10")
+
+	var pl *Pool
+	var others atomic.Int32
+	template.AddHook(HookPreStop, func(ctx context.Context, p *Process) error {
+		for _, r := range pl.Replicas() {
+			if r.Process != p && r.Process.IsRunning() {
+				others.Add(1)
+			}
+		}
+		return nil
+	}, HookOptions{})
+
+	pl = NewPool(template, PoolOptions{BasePort: 20000, StartFirst: true, StopTimeout: time.Second})
+	defer pl.Stop()
+
+	if err := pl.Scale(1); err != nil {
+		t.Fatal(err)
+	}
+	old := pl.Replicas()[0].Process
+
+	if err := pl.RollingRestart(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if pl.Replicas()[0].Process == old {
+		t.Error("the replica was not replaced")
+	}
+	if old.IsRunning() {
+		t.Error("the old replica is still running")
+	}
+	if others.Load() != 1 {
+		t.Error("the old replica was stopped before the new one was running")
+	}
+}
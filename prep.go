@@ -1,103 +1,187 @@
 package process
 
 import (
-	"bufio"
+	"bytes"
 	"errors"
 	"fmt"
 	"io"
+	"os"
 	"sync"
 
 	"github.com/nixpare/broadcaster"
 )
 
+// outputStream groups everything that receives the
+// captured output of a Process stream
+type outputStream struct {
+	id    string
+	bc    *broadcaster.BufBroadcaster[[]byte]
+	ls    *listenerSet
+	sinks *sinkSet
+}
+
+func (p *Process) stdoutStream() outputStream {
+	return outputStream{id: "stdout", bc: p.outBc, ls: p.outLs, sinks: p.outSinks}
+}
+
+func (p *Process) stderrStream() outputStream {
+	return outputStream{id: "stderr", bc: p.errBc, ls: p.errLs, sinks: p.errSinks}
+}
+
 func (p *Process) prepareStdout(stdout io.Writer) error {
+	p.outBc.Reset()
+	p.outLs.reset()
+
+	if p.noCapture {
+		p.Exec.Stdout = stdout
+		return nil
+	}
+
 	outPipe, err := p.Exec.StdoutPipe()
 	if err != nil {
 		return err
 	}
 
-	p.outBc.Reset()
-
 	p.stdOutErrWG.Add(1)
 	go func() {
 		defer p.stdOutErrWG.Done()
-		pipeOutput(p.outBc, outPipe, stdout, "stdout")
+		pipeOutput(p.stdoutStream(), outPipe, stdout)
 	}()
-	
+
 	return nil
 }
 
 func (p *Process) prepareStderr(stderr io.Writer) error {
+	p.errBc.Reset()
+	p.errLs.reset()
+
+	if p.noCapture {
+		p.Exec.Stderr = stderr
+		return nil
+	}
+
 	errPipe, err := p.Exec.StderrPipe()
 	if err != nil {
 		return err
 	}
 
-	p.errBc.Reset()
-
 	p.stdOutErrWG.Add(1)
 	go func() {
 		defer p.stdOutErrWG.Done()
-		pipeOutput(p.errBc, errPipe, stderr, "stderr")
+		pipeOutput(p.stderrStream(), errPipe, stderr)
 	}()
 
 	return nil
 }
 
-func pipeOutput(bc *broadcaster.BufBroadcaster[[]byte], r io.ReadCloser, w io.Writer, pipeID string) {
-	pipeR, pipeW := io.Pipe()
-	var buf [1024]byte
-
-	br := bufio.NewReader(pipeR)
-	var wg sync.WaitGroup
-
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-
-		for {
-			line, err := br.ReadBytes('\n')
-			if err != nil {
-				if !errors.Is(err, io.EOF) {
-					line = []byte(fmt.Sprintf("broken %s pipe: %v", pipeID, err))
-				}
-			}
+// CaptureOutput enables or disables the capture of the standard output and
+// error, and must be called before the start. By default the output is
+// captured, so that it can be accessed with the methods of the Process.
+//
+// With the capture disabled, the writers provided to Start are handed
+// directly to the child: an *os.File (like os.Stdout or a log file) is
+// inherited by the child without any copy in the parent. In this case
+// Stdout, Stderr, the listeners and the writers added with AddStdoutWriter
+// and AddStderrWriter receive nothing
+func (p *Process) CaptureOutput(flag bool) {
+	p.noCapture = !flag
+}
 
-			if len(line) > 0 {
-				if line[len(line)-1] == '\n' {
-					line = line[:len(line)-1]
-				}
+const outputChunkSize = 32 * 1024
 
-				bc.Send(line)
-			}
+var outputChunkPool = sync.Pool{
+	New: func() any {
+		b := make([]byte, outputChunkSize)
+		return &b
+	},
+}
 
-			if err != nil {
-				break
-			}
-		}
-	}()
+// pipeOutput reads the output of the child in chunks, writing each one
+// to w and to the sinks, and splits them into lines in the same pass
+func pipeOutput(stream outputStream, r io.Reader, w io.Writer) {
+	bufp := outputChunkPool.Get().(*[]byte)
+	defer outputChunkPool.Put(bufp)
 
+	var pending []byte
 	for {
-		n, err := r.Read(buf[:])
-		b := buf[:n]
+		n, err := r.Read(*bufp)
+		b := (*bufp)[:n]
 		if err != nil {
-			if !errors.Is(err, io.EOF) {
-				b = append(b, []byte(fmt.Sprintf("broken %s pipe: %v", pipeID, err))...)
+			// the pipe is closed by the parent only if the child
+			// could not start, so there is nothing broken to report
+			if !errors.Is(err, io.EOF) && !errors.Is(err, os.ErrClosed) {
+				b = append(b, []byte(fmt.Sprintf("broken %s pipe: %v", stream.id, err))...)
 			}
 		}
 
 		if len(b) > 0 {
-			pipeW.Write(b)
 			if w != nil && w != dev_null {
 				w.Write(b)
 			}
+
+			stream.sinks.feedMu.Lock()
+			stream.sinks.write(b)
+			pending = stream.splitLines(pending, b)
+			stream.sinks.partial = pending
+			stream.sinks.feedMu.Unlock()
 		}
 
 		if err != nil {
-			pipeW.CloseWithError(err)
 			break
 		}
 	}
 
-	wg.Wait()
+	stream.sinks.feedMu.Lock()
+	defer stream.sinks.feedMu.Unlock()
+
+	if len(pending) > 0 {
+		stream.send(append([]byte(nil), pending...))
+	}
+	stream.sinks.partial = nil
+}
+
+// attach adds a sink to the stream and returns the lines captured before
+// it, with the incomplete last line, so that the output written before
+// and after the sink is neither repeated nor missing
+func (stream outputStream) attach(w io.Writer, policy SinkPolicy) (lines [][]byte, partial []byte, s *sink, remove func()) {
+	stream.sinks.feedMu.Lock()
+	defer stream.sinks.feedMu.Unlock()
+
+	s, remove = stream.sinks.addSink(w, policy)
+	return stream.bc.Data(), append([]byte(nil), stream.sinks.partial...), s, remove
+}
+
+// listen registers an OutputListener for the current run and returns
+// the lines captured before it, which the listener will not receive
+func (stream outputStream) listen(opts ListenerOptions) ([][]byte, *OutputListener) {
+	stream.sinks.feedMu.Lock()
+	defer stream.sinks.feedMu.Unlock()
+
+	return stream.bc.Data(), stream.ls.register(opts, false)
+}
+
+// splitLines sends every complete line found in the chunk, prepending the
+// incomplete line left by the previous chunk, and returns the incomplete
+// line at the end of this one. Every line sent is a new allocation, as
+// it is retained by the broadcaster
+func (stream outputStream) splitLines(pending []byte, b []byte) []byte {
+	for {
+		i := bytes.IndexByte(b, '\n')
+		if i < 0 {
+			return append(pending, b...)
+		}
+
+		line := make([]byte, len(pending)+i)
+		copy(line, pending)
+		copy(line[len(pending):], b[:i])
+		pending = pending[:0]
+
+		stream.send(line)
+		b = b[i+1:]
+	}
+}
+
+func (stream outputStream) send(line []byte) {
+	stream.bc.Send(line)
+	stream.ls.send(line)
 }
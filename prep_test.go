@@ -0,0 +1,81 @@
+package process
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"strconv"
+	"testing"
+
+	"github.com/nixpare/broadcaster"
+)
+
+// TestHelperOutput is not a real test: it's run as a child by the
+// benchmarks and writes PROCESS_HELPER_LINES lines on its standard output
+func TestHelperOutput(t *testing.T) {
+	n, err := strconv.Atoi(os.Getenv("PROCESS_HELPER_LINES"))
+	if err != nil {
+		return
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	line := bytes.Repeat([]byte("x"), 79)
+	for i := 0; i < n; i++ {
+		w.Write(line)
+		w.WriteByte('\n')
+	}
+	w.Flush()
+	os.Exit(0)
+}
+
+const benchLines = 50_000
+
+func benchmarkOutput(b *testing.B, capture bool) {
+	b.SetBytes(benchLines * 80)
+	for i := 0; i < b.N; i++ {
+		p, err := NewProcess("", os.Args[0], "-test.run=^TestHelperOutput$")
+		if err != nil {
+			b.Fatal(err)
+		}
+		p.Env = append(os.Environ(), "PROCESS_HELPER_LINES="+strconv.Itoa(benchLines))
+		p.CaptureOutput(capture)
+
+		exitStatus, err := p.Run(nil, nil, nil)
+		if err != nil {
+			b.Fatal(err, exitStatus)
+		}
+		p.Close()
+	}
+}
+
+func BenchmarkOutputCaptured(b *testing.B) {
+	benchmarkOutput(b, true)
+}
+
+func BenchmarkOutputNotCaptured(b *testing.B) {
+	benchmarkOutput(b, false)
+}
+
+func BenchmarkSplitLines(b *testing.B) {
+	stream := outputStream{
+		id:    "stdout",
+		bc:    broadcaster.NewBufBroadcaster[[]byte](),
+		ls:    newListenerSet(),
+		sinks: newSinkSet(),
+	}
+
+	// chunks that split lines in the middle, like the pipe does
+	data := bytes.Repeat([]byte("a line of the output of the child\n"), 4096)
+	const chunkSize = 4000
+
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		var pending []byte
+		for off := 0; off < len(data); off += chunkSize {
+			end := min(off+chunkSize, len(data))
+			pending = stream.splitLines(pending, data[off:end])
+		}
+		stream.bc.Reset()
+	}
+}
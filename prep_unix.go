@@ -7,9 +7,13 @@ import (
 
 func (p *Process) prepareStdin(stdin io.Reader) error {
 	if stdin == nil {
-		var err error
-		p.in, err = p.Exec.StdinPipe()
-		return err
+		pipe, err := p.Exec.StdinPipe()
+		if err != nil {
+			return err
+		}
+
+		p.in = newStdinWriter(pipe, p.inSinks)
+		return nil
 	}
 	
 	p.Exec.Stdin = stdin
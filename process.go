@@ -1,7 +1,7 @@
 package process
 
 import (
-	"errors"
+	"context"
 	"fmt"
 	"io"
 	"os"
@@ -9,6 +9,7 @@ import (
 	"path/filepath"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/nixpare/broadcaster"
 )
@@ -20,20 +21,57 @@ import (
 //
 // For more details, see the package documentation
 type Process struct {
-	ExecName       string
-	execPath       string
-	args           []string
-	wd             string
-	Env            []string
-	SysProcAttr    *syscall.SysProcAttr
-	Exec           *exec.Cmd
-	exitComm       *broadcaster.Broadcaster[ExitStatus]
-	running        bool
+	ExecName string
+	execPath string
+	args     []string
+	wd       string
+	Env      []string
+	// Limits are the resource limits applied to the Process at every
+	// start, see Limits
+	Limits *Limits
+	// Cgroup is the cgroup v2 the Process is started in, see Cgroup
+	Cgroup      *Cgroup
+	SysProcAttr *syscall.SysProcAttr
+	Exec        *exec.Cmd
+	running     bool
+	// exiting is set while the HookPostExit hooks run, after the
+	// child has exited and before the ExitStatus is reported
+	exiting        bool
 	lastExitStatus ExitStatus
-	in             io.WriteCloser
+	in             *stdinWriter
 	stdOutErrWG    sync.WaitGroup
 	outBc          *broadcaster.BufBroadcaster[[]byte]
 	errBc          *broadcaster.BufBroadcaster[[]byte]
+	outSinks       *sinkSet
+	errSinks       *sinkSet
+	outLs          *listenerSet
+	errLs          *listenerSet
+	inSinks        *sinkSet
+	noCapture      bool
+	stateMu        sync.Mutex
+	stateCh        chan struct{}
+	closed         bool
+	runID          uint64
+	pid            int
+	readiness      ReadinessCheck
+	ready          bool
+	readyErr       error
+	observers      map[uint64]func(lifecycleEvent)
+	nextObserver   uint64
+	hooks          map[HookPoint][]*hookEntry
+	hookErrs       []error
+	hookWG         sync.WaitGroup
+	hookCancel     context.CancelFunc
+	cgroup         *cgroupRun
+	watchdogReason string
+	// watchdogSignal is the signal sent by the Watchdog with the
+	// reason, which is kept only if the signal terminated the child
+	watchdogSignal os.Signal
+	// startStdin, startStdout and startStderr are the ones given to
+	// the last Start, used by the Watchdog to restart the Process
+	startStdin  io.Reader
+	startStdout io.Writer
+	startStderr io.Writer
 }
 
 // NewProcess creates a new Process with the given arguments.
@@ -73,9 +111,14 @@ func NewProcess(wd string, execPath string, args ...string) (*Process, error) {
 		args:        args,
 		wd:          wd,
 		SysProcAttr: initSysProcAttr(),
-		exitComm:    broadcaster.NewBroadcaster[ExitStatus](),
 		outBc:       broadcaster.NewBufBroadcaster[[]byte](),
 		errBc:       broadcaster.NewBufBroadcaster[[]byte](),
+		outSinks:    newSinkSet(),
+		errSinks:    newSinkSet(),
+		inSinks:     newSinkSet(),
+		outLs:       newListenerSet(),
+		errLs:       newListenerSet(),
+		stateCh:     make(chan struct{}),
 	}
 
 	return p, nil
@@ -97,24 +140,90 @@ func (p *Process) Run(stdin io.Reader, stdout, stderr io.Writer) (exitStatus Exi
 // the execution it will be reported in the ExitStatus provided by calling
 // the Wait method
 func (p *Process) Start(stdin io.Reader, stdout, stderr io.Writer) error {
-	if p.IsRunning() {
+	p.stateMu.Lock()
+	running, exiting := p.running, p.exiting
+	p.stateMu.Unlock()
+
+	if running {
 		return fmt.Errorf("process \"%s\" is already running", p.ExecName)
 	}
+	if exiting {
+		return fmt.Errorf("process \"%s\" is still running its exit hooks", p.ExecName)
+	}
+
+	if err := p.runHooks(context.Background(), HookPreStart); err != nil {
+		return fmt.Errorf("process \"%s\": %w", p.ExecName, err)
+	}
 
 	p.initCommand()
 
-	err := p.preparePipes(stdin, stdout, stderr)
+	gate, err := p.prepareLimits()
+	if err != nil {
+		return fmt.Errorf("process \"%s\" limits error: %w", p.ExecName, err)
+	}
+
+	cgroup, err := p.prepareCgroup()
+	if err != nil {
+		gate.abort()
+		return fmt.Errorf("process \"%s\" cgroup error: %w", p.ExecName, err)
+	}
+
+	err = p.preparePipes(stdin, stdout, stderr)
 	if err != nil {
+		gate.abort()
+		cgroup.abort()
 		return fmt.Errorf("process \"%s\" pipe error: %w", p.ExecName, err)
 	}
 
 	err = p.Exec.Start()
 	if err != nil {
+		gate.abort()
+		cgroup.abort()
+		// the pipes are closed by the failed start, which
+		// ends the goroutines copying the output
+		p.stdOutErrWG.Wait()
 		return fmt.Errorf("process \"%s\" startup error: %w", p.ExecName, err)
 	}
+	cgroup.started()
+
+	if err := gate.release(p.Exec.Process.Pid); err != nil {
+		// the child exits without executing the program
+		p.Exec.Process.Kill()
+		p.waitExit()
+		cgroup.exited()
+		return fmt.Errorf("process \"%s\" limits error: %w", p.ExecName, err)
+	}
+
+	if p.in != nil {
+		p.in.start()
+	}
 
+	hookCtx, hookCancel := context.WithCancel(context.Background())
+
+	p.stateMu.Lock()
 	p.running = true
+	p.hookCancel = hookCancel
+	p.cgroup = cgroup
+	p.watchdogReason = ""
+	p.watchdogSignal = nil
+	p.startStdin, p.startStdout, p.startStderr = stdin, stdout, stderr
+	p.runID++
+	p.pid = p.Exec.Process.Pid
+	p.ready = p.readiness == nil
+	p.readyErr = nil
+	runID, readiness := p.runID, p.readiness
+	p.changeStateLocked()
+	p.emitLocked(lifecycleEvent{kind: lifecycleStarted, runID: runID, pid: p.Exec.Process.Pid})
+	if p.ready {
+		p.emitLocked(lifecycleEvent{kind: lifecycleReady, runID: runID, pid: p.Exec.Process.Pid})
+	}
+	p.stateMu.Unlock()
+
 	go p.afterStart()
+	if readiness != nil {
+		go p.checkReadiness(runID, readiness)
+	}
+	p.startHooks(hookCtx)
 
 	return nil
 }
@@ -123,11 +232,12 @@ func (p *Process) initCommand() {
 	p.Exec = exec.Command(p.execPath, p.args...)
 	p.Exec.Dir = p.wd
 	p.Exec.Env = p.Env
-	
+
 	p.Exec.SysProcAttr = p.SysProcAttr
 }
 
 func (p *Process) preparePipes(stdin io.Reader, stdout, stderr io.Writer) error {
+	p.in = nil
 	err := p.prepareStdin(stdin)
 	if err != nil {
 		return err
@@ -141,35 +251,157 @@ func (p *Process) preparePipes(stdin io.Reader, stdout, stderr io.Writer) error
 	return p.prepareStderr(stderr)
 }
 
-// afterStart waits for the Process with the already provided function by *os.Process,
-// then sends the ExitStatus via the broadcaster
-func (p *Process) afterStart() {
+// waitExit waits for the child to exit and for its output to be
+// consumed, then stops the input writer
+func (p *Process) waitExit() error {
 	p.stdOutErrWG.Wait()
 	err := p.Exec.Wait()
-
-	p.lastExitStatus = ExitStatus{
-		PID:       p.Exec.Process.Pid,
-		ExitCode:  p.Exec.ProcessState.ExitCode(),
-		ExitError: err,
+	if p.in != nil {
+		p.in.stop()
 	}
+	return err
+}
+
+// afterStart waits for the Process to exit, runs the HookPostExit
+// hooks and reports the ExitStatus to the observers and to Wait
+func (p *Process) afterStart() {
+	err := p.waitExit()
 
-	p.exitComm.Send(p.lastExitStatus)
+	p.stateMu.Lock()
+	hookCancel, cgroup := p.hookCancel, p.cgroup
+	watchdogReason, watchdogSignal := p.watchdogReason, p.watchdogSignal
 	p.running = false
+	p.exiting = true
+	p.changeStateLocked()
+	p.stateMu.Unlock()
+
+	exitStatus := ExitStatus{
+		PID:            p.Exec.Process.Pid,
+		ExitCode:       p.Exec.ProcessState.ExitCode(),
+		ExitError:      err,
+		HookError:      p.exitHooks(hookCancel),
+		Cgroup:         cgroup.exited(),
+		WatchdogReason: watchdogReason,
+	}
+	if sig, ok := exitStatus.Signal(); watchdogSignal != nil && (!ok || sig != watchdogSignal) {
+		// the child survived the signal of the Watchdog
+		exitStatus.WatchdogReason = ""
+	}
+
+	p.stateMu.Lock()
+	p.lastExitStatus = exitStatus
+	p.exiting = false
+	p.changeStateLocked()
+	p.emitLocked(lifecycleEvent{kind: lifecycleExited, runID: p.runID, pid: exitStatus.PID, exitStatus: exitStatus})
+	p.stateMu.Unlock()
+}
+
+// stateChanged returns a channel that is closed the next time
+// the Process starts, exits or is closed
+func (p *Process) stateChanged() <-chan struct{} {
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+
+	return p.stateCh
+}
+
+func (p *Process) notifyStateChange() {
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+
+	p.changeStateLocked()
+}
+
+func (p *Process) changeStateLocked() {
+	close(p.stateCh)
+	p.stateCh = make(chan struct{})
+}
+
+func (p *Process) isClosed() bool {
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+
+	return p.closed
+}
+
+// currentRun returns the number of the current or last
+// run, counting from 1, and whether it's running
+func (p *Process) currentRun() (uint64, bool) {
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+
+	return p.runID, p.running
 }
 
 // Wait waits for the Process termination (if running) and returns the last Process
 // state known
 func (p *Process) Wait() ExitStatus {
-	if p.IsRunning() {
-		l := p.exitComm.Register(0)
-		defer l.Unregister()
-		return l.Get()
+	for {
+		p.stateMu.Lock()
+		running, changed, exitStatus := p.running || p.exiting, p.stateCh, p.lastExitStatus
+		p.stateMu.Unlock()
+
+		if !running {
+			return exitStatus
+		}
+		<-changed
+	}
+}
+
+// StopTimeout sends a CTRL-C event to the Process, like Stop, and kills it
+// if it's still running after the timeout. It returns once the Process has exited.
+// The HookPreStop hooks run within the timeout: if they don't complete in
+// time, their context is cancelled and the Process is killed right away
+func (p *Process) StopTimeout(timeout time.Duration) (ExitStatus, error) {
+	changed := p.stateChanged()
+	if !p.IsRunning() {
+		return p.Wait(), nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := p.stopContext(ctx); err != nil {
+		return p.killAndWait()
+	}
+
+	for {
+		select {
+		case <-changed:
+			changed = p.stateChanged()
+			if !p.IsRunning() {
+				return p.Wait(), nil
+			}
+		case <-ctx.Done():
+			return p.killAndWait()
+		}
 	}
-	return p.lastExitStatus
 }
 
-// Stop sends a CTRL-C event to the Process to allow a graceful exit
+func (p *Process) killAndWait() (ExitStatus, error) {
+	err := p.Kill()
+	if err != nil && p.IsRunning() {
+		return ExitStatus{}, err
+	}
+
+	return p.Wait(), nil
+}
+
+// Stop runs the HookPreStop hooks and then sends a CTRL-C event
+// to the Process to allow a graceful exit
 func (p *Process) Stop() error {
+	return p.stopContext(context.Background())
+}
+
+// stopContext is Stop with the HookPreStop hooks bound to ctx: if ctx
+// is done once they return, no CTRL-C event is sent and its error is returned
+func (p *Process) stopContext(ctx context.Context) error {
+	if p.IsRunning() {
+		p.runHooks(ctx, HookPreStop)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	return p.stop()
 }
 
@@ -179,6 +411,17 @@ func (p *Process) Kill() error {
 		return fmt.Errorf("program \"%s\" is already stopped", p.ExecName)
 	}
 
+	p.stateMu.Lock()
+	cgroup := p.cgroup
+	p.stateMu.Unlock()
+
+	if killed, err := cgroup.kill(); killed {
+		if err != nil {
+			return fmt.Errorf("program \"%s\" kill error: %w", p.ExecName, err)
+		}
+		return nil
+	}
+
 	err := p.Exec.Process.Kill()
 	if err != nil {
 		return fmt.Errorf("program \"%s\" kill error: %w", p.ExecName, err)
@@ -187,25 +430,6 @@ func (p *Process) Kill() error {
 	return nil
 }
 
-// SendInput sends data to the Process via a pipe, if the Process is
-// running and can pipe data. The Process might take any input until
-// a newline or an EOF: for the first one you can use the SendText method,
-// for the second case, you can close the pipe via the CloseInput method
-//
-// For more details, see the package documentation
-func (p *Process) SendInput(data []byte) error {
-	if !p.IsRunning() {
-		return fmt.Errorf("program \"%s\" is not running", p.ExecName)
-	}
-
-	if p.in == nil {
-		return errors.New("can't pipe input to the process, see package documentation for more details")
-	}
-
-	_, err := p.in.Write(data)
-	return err
-}
-
 // Sends a text with a newline appended automatically, to
 // simulate a real user behind a keyboard
 func (p *Process) SendText(text string) error {
@@ -213,9 +437,17 @@ func (p *Process) SendText(text string) error {
 }
 
 // Closes the input pipe, simulating a CTRL-Z or an EOF
-// (if the stdin comes from a file)
+// (if the stdin comes from a file). The pipe is closed immediately,
+// even if the child is not reading: the data still queued by SendInput
+// is discarded, so use SendInputContext to wait for it to be written.
+// The error of the last failed write, if any, is returned
 func (p *Process) CloseInput() error {
-	return p.in.Close()
+	in, err := p.stdin()
+	if err != nil {
+		return err
+	}
+
+	return in.close()
 }
 
 func joinLines(lines [][]byte) []byte {
@@ -257,19 +489,28 @@ func (p *Process) StderrLines() [][]byte {
 	return p.errBc.Data()
 }
 
+// StdoutListener returns a channel receiving every line of the standard
+// output, until the Process is started again or closed. Lines are sent
+// with the ListenerBlock policy: a consumer that stops reading stalls the
+// output pipe and then the child; see StdoutListenerWith for the alternatives
 func (p *Process) StdoutListener(bufSize int) <-chan []byte {
 	return p.outBc.Register(bufSize).Ch()
 }
 
+// StderrListener is like StdoutListener, but for the standard error
 func (p *Process) StderrListener(bufSize int) <-chan []byte {
 	return p.errBc.Register(bufSize).Ch()
 }
 
+// ConnectStdout returns the standard output captured so far together with
+// a channel, with the same guarantees of StdoutListener, receiving every
+// following line, without losing any line in between
 func (p *Process) ConnectStdout(bufSize int) ([][]byte, <-chan []byte) {
 	old, ch := p.outBc.Connect(bufSize)
 	return old, ch.Ch()
 }
 
+// ConnectStderr is like ConnectStdout, but for the standard error
 func (p *Process) ConnectStderr(bufSize int) ([][]byte, <-chan []byte) {
 	old, ch := p.errBc.Connect(bufSize)
 	return old, ch.Ch()
@@ -277,6 +518,9 @@ func (p *Process) ConnectStderr(bufSize int) ([][]byte, <-chan []byte) {
 
 // IsRunning reports whether the Process is running
 func (p *Process) IsRunning() bool {
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+
 	return p.running
 }
 
@@ -295,11 +539,14 @@ func (p *Process) WorkDir() string {
 }
 
 func (p *Process) PID() int {
-	if p.Exec.Process == nil {
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+
+	if p.pid == 0 {
 		return -1
 	}
 
-	return p.Exec.Process.Pid
+	return p.pid
 }
 
 func (p *Process) InheritConsole(flag bool) {
@@ -313,10 +560,20 @@ func (p *Process) Clone() *Process {
 		args:        p.args,
 		wd:          p.wd,
 		Env:         append([]string{}, p.Env...),
+		Limits:      p.Limits,
+		Cgroup:      p.Cgroup,
 		SysProcAttr: p.SysProcAttr,
-		exitComm:    broadcaster.NewBroadcaster[ExitStatus](),
 		outBc:       broadcaster.NewBufBroadcaster[[]byte](),
 		errBc:       broadcaster.NewBufBroadcaster[[]byte](),
+		outSinks:    newSinkSet(),
+		errSinks:    newSinkSet(),
+		inSinks:     newSinkSet(),
+		outLs:       newListenerSet(),
+		errLs:       newListenerSet(),
+		stateCh:     make(chan struct{}),
+		noCapture:   p.noCapture,
+		readiness:   p.readiness,
+		hooks:       p.cloneHooks(),
 	}
 }
 
@@ -336,9 +593,15 @@ func (p *Process) Close() error {
 		return err
 	}
 
-	p.exitComm.Close()
+	p.stateMu.Lock()
+	p.closed = true
+	p.stateMu.Unlock()
+	p.notifyStateChange()
+
 	p.outBc.Close()
 	p.errBc.Close()
-	
+	p.outLs.close()
+	p.errLs.close()
+
 	return nil
 }
@@ -16,7 +16,7 @@ func inheritConsole(spa *syscall.SysProcAttr, flag bool) {
 
 // stop sends a CTRL+C signal
 func (p *Process) stop() error {
-	if !p.running {
+	if !p.IsRunning() {
 		return nil
 	}
 	
@@ -53,7 +53,7 @@ func initSysProcAttr() *syscall.SysProcAttr {
 
 // stop generates a CTRL+C signal
 func (p *Process) stop() error {
-	if !p.running {
+	if !p.IsRunning() {
 		return nil
 	}
 
@@ -0,0 +1,152 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"time"
+)
+
+// ReadinessCheck blocks until the running Process p is ready to do its
+// job, returning nil, or until ctx is done or the check fails, returning
+// an error. The context is cancelled when the Process exits
+type ReadinessCheck func(ctx context.Context, p *Process) error
+
+// ErrNotReady is returned by WaitReady when the Process exits, or
+// its ReadinessCheck fails, before becoming ready
+var ErrNotReady = errors.New("process not ready")
+
+// SetReadiness sets the check run every time the Process starts to
+// establish when it's ready. Without a check, a Process is ready as
+// soon as it's started
+func (p *Process) SetReadiness(check ReadinessCheck) {
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+
+	p.readiness = check
+}
+
+// IsReady reports whether the Process is running and ready
+func (p *Process) IsReady() bool {
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+
+	return p.running && p.ready
+}
+
+// WaitReady waits for the running Process to become ready
+func (p *Process) WaitReady(ctx context.Context) error {
+	for {
+		p.stateMu.Lock()
+		running, ready, readyErr, changed := p.running, p.ready, p.readyErr, p.stateCh
+		p.stateMu.Unlock()
+
+		switch {
+		case !running:
+			return fmt.Errorf("program \"%s\": %w: not running", p.ExecName, ErrNotReady)
+		case ready:
+			return nil
+		case readyErr != nil:
+			return fmt.Errorf("program \"%s\": %w: %w", p.ExecName, ErrNotReady, readyErr)
+		}
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// checkReadiness runs the ReadinessCheck for the run that has just started
+func (p *Process) checkReadiness(runID uint64, check ReadinessCheck) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		p.Wait()
+		cancel()
+	}()
+
+	err := check(ctx, p)
+
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+
+	if p.runID != runID || !p.running {
+		return
+	}
+	if err == nil {
+		p.ready = true
+		p.emitLocked(lifecycleEvent{kind: lifecycleReady, runID: runID, pid: p.Exec.Process.Pid})
+	} else {
+		p.readyErr = err
+	}
+	p.changeStateLocked()
+}
+
+// ReadyOnOutput is a ReadinessCheck that waits for a line of the
+// standard output matching re. The check never slows down the Process:
+// if it falls behind, the oldest lines not yet matched are skipped
+func ReadyOnOutput(re *regexp.Regexp) ReadinessCheck {
+	return func(ctx context.Context, p *Process) error {
+		old, l := p.stdoutStream().listen(ListenerOptions{BufSize: 64, Policy: ListenerDropOldest})
+		defer l.Close()
+
+		for _, line := range old {
+			if re.Match(line) {
+				return nil
+			}
+		}
+
+		for {
+			select {
+			case line, ok := <-l.Ch():
+				if !ok {
+					return errors.New("output closed")
+				}
+				if re.Match(line) {
+					return nil
+				}
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+// ReadyOnTCP is a ReadinessCheck that waits for a TCP connection
+// to addr to succeed, trying every interval
+func ReadyOnTCP(addr string, interval time.Duration) ReadinessCheck {
+	return func(ctx context.Context, p *Process) error {
+		var d net.Dialer
+		for {
+			conn, err := d.DialContext(ctx, "tcp", addr)
+			if err == nil {
+				conn.Close()
+				return nil
+			}
+
+			select {
+			case <-time.After(interval):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+// ReadyAfter is a ReadinessCheck that considers the Process ready
+// once it has been running for the given duration
+func ReadyAfter(d time.Duration) ReadinessCheck {
+	return func(ctx context.Context, p *Process) error {
+		select {
+		case <-time.After(d):
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,103 @@
+//go:build !windows
+
+package process
+
+import (
+	"context"
+	"errors"
+	"net"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func waitReady(t *testing.T, p *Process) error {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return p.WaitReady(ctx)
+}
+
+func TestReadyOnOutput(t *testing.T) {
+	// the check skips lines instead of slowing down the process
+	p := newShell(t, `i=0; while [ $i -lt 5000 ]; do echo line$i; i=$((i+1)); done
+		echo listening; exec sleep 10`)
+	p.SetReadiness(ReadyOnOutput(regexp.MustCompile(`^listening$`)))
+	if err := p.Start(DevNull(), nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		p.Kill()
+		p.Wait()
+	})
+
+	if err := waitReady(t, p); err != nil {
+		t.Fatal(err)
+	}
+	if !p.IsReady() {
+		t.Error("IsReady = false after WaitReady")
+	}
+}
+
+func TestReadyNotReadyOnExit(t *testing.T) {
+	p := newShell(t, "echo starting; sleep 0.1")
+	p.SetReadiness(ReadyOnOutput(regexp.MustCompile(`^listening$`)))
+	if err := p.Start(DevNull(), nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := waitReady(t, p); !errors.Is(err, ErrNotReady) {
+		t.Errorf("WaitReady = %v, want ErrNotReady", err)
+	}
+	p.Wait()
+}
+
+func TestReadyCheckFailed(t *testing.T) {
+	p := startShellWithReadiness(t, func(ctx context.Context, p *Process) error {
+		return errors.New("broken")
+	})
+
+	err := waitReady(t, p)
+	if !errors.Is(err, ErrNotReady) || err.Error() != `program "sh": process not ready: broken` {
+		t.Errorf("WaitReady = %v, want the error of the check", err)
+	}
+}
+
+func TestReadyOnTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	p := startShellWithReadiness(t, ReadyOnTCP(ln.Addr().String(), 10*time.Millisecond))
+	if err := waitReady(t, p); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadyAfter(t *testing.T) {
+	p := startShellWithReadiness(t, ReadyAfter(200*time.Millisecond))
+	if p.IsReady() {
+		t.Error("IsReady = true before the delay")
+	}
+	if err := waitReady(t, p); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func startShellWithReadiness(t *testing.T, check ReadinessCheck) *Process {
+	t.Helper()
+
+	p := newShell(t, "exec sleep 10")
+	p.SetReadiness(check)
+	if err := p.Start(DevNull(), nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		p.Kill()
+		p.Wait()
+	})
+	return p
+}
@@ -0,0 +1,332 @@
+package process
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RegistryEventType is the kind of a RegistryEvent
+type RegistryEventType int
+
+const (
+	// EventRegistered is sent when a Process is added to the Registry
+	EventRegistered RegistryEventType = iota
+	// EventStarted is sent when a Process starts for the first time
+	EventStarted
+	// EventReady is sent when a Process becomes ready, see SetReadiness
+	EventReady
+	// EventExited is sent when a Process exits, with its ExitStatus
+	EventExited
+	// EventRestarted is sent when a Process starts again after exiting
+	EventRestarted
+	// EventRemoved is sent when a Process is removed from the Registry
+	EventRemoved
+)
+
+func (t RegistryEventType) String() string {
+	switch t {
+	case EventRegistered:
+		return "registered"
+	case EventStarted:
+		return "started"
+	case EventReady:
+		return "ready"
+	case EventExited:
+		return "exited"
+	case EventRestarted:
+		return "restarted"
+	case EventRemoved:
+		return "removed"
+	default:
+		return fmt.Sprintf("RegistryEventType(%d)", int(t))
+	}
+}
+
+// RegistryEvent is a change in the lifecycle of a Process of a Registry
+type RegistryEvent struct {
+	Type    RegistryEventType
+	Time    time.Time
+	Name    string
+	Process *Process
+	PID     int
+	// ExitStatus is set only for EventExited
+	ExitStatus ExitStatus
+}
+
+// Registry maps unique names to processes and sends the lifecycle events
+// of all of them to its subscribers, so that the whole program can be
+// observed with one subscription. Every subscriber has its own buffer and
+// a policy for when it's full, so a slow subscriber never blocks the
+// processes nor the other subscribers
+type Registry struct {
+	mu     sync.Mutex
+	procs  map[string]*registryEntry
+	names  []string
+	subs   map[*RegistrySubscription]struct{}
+	closed bool
+}
+
+// RegistrySubscription receives the events of a Registry,
+// see Registry.SubscribeWith
+type RegistrySubscription struct {
+	ch           chan RegistryEvent
+	policy       ListenerPolicy
+	r            *Registry
+	closed       bool
+	dropped      atomic.Uint64
+	disconnected atomic.Bool
+}
+
+type registryEntry struct {
+	p       *Process
+	active  bool
+	removeO func()
+}
+
+// NewRegistry creates an empty Registry
+func NewRegistry() *Registry {
+	return &Registry{
+		procs: make(map[string]*registryEntry),
+		subs:  make(map[*RegistrySubscription]struct{}),
+	}
+}
+
+// Register adds the Process to the Registry with a unique name
+func (r *Registry) Register(name string, p *Process) error {
+	// the observer is called with the lock of the Process held and takes
+	// the registry lock, so it's registered without the registry lock
+	// and it ignores the events until the entry is active
+	entry := &registryEntry{p: p}
+	entry.removeO = p.observe(func(e lifecycleEvent) {
+		event := RegistryEvent{Name: name, Process: p, PID: e.pid}
+		switch e.kind {
+		case lifecycleStarted:
+			event.Type = EventStarted
+			if e.runID > 1 {
+				event.Type = EventRestarted
+			}
+		case lifecycleReady:
+			event.Type = EventReady
+		case lifecycleExited:
+			event.Type = EventExited
+			event.ExitStatus = e.exitStatus
+		}
+		r.enqueue(entry, event)
+	})
+
+	// the Process lock can't be taken with the registry lock held
+	pid := p.PID()
+
+	r.mu.Lock()
+	err := r.addLocked(name, entry, pid)
+	r.mu.Unlock()
+
+	if err != nil {
+		entry.removeO()
+	}
+	return err
+}
+
+func (r *Registry) addLocked(name string, entry *registryEntry, pid int) error {
+	if r.closed {
+		return fmt.Errorf("registry closed")
+	}
+	if _, ok := r.procs[name]; ok {
+		return fmt.Errorf("process \"%s\" already registered", name)
+	}
+	for _, e := range r.procs {
+		if e.p == entry.p {
+			return fmt.Errorf("process \"%s\" already registered with another name", entry.p.ExecName)
+		}
+	}
+
+	entry.active = true
+	r.procs[name] = entry
+	r.names = append(r.names, name)
+	r.enqueueLocked(RegistryEvent{Type: EventRegistered, Name: name, Process: entry.p, PID: pid})
+	return nil
+}
+
+// Get returns the Process registered with the given name
+func (r *Registry) Get(name string) (*Process, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	entry, ok := r.procs[name]
+	if !ok {
+		return nil, false
+	}
+	return entry.p, true
+}
+
+// List returns the names of the processes in the order they were registered
+func (r *Registry) List() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]string(nil), r.names...)
+}
+
+// Remove removes the Process from the Registry, without stopping it
+func (r *Registry) Remove(name string) error {
+	r.mu.Lock()
+	entry, ok := r.procs[name]
+	if !ok {
+		r.mu.Unlock()
+		return fmt.Errorf("process \"%s\" not registered", name)
+	}
+
+	entry.active = false
+	delete(r.procs, name)
+	for i, n := range r.names {
+		if n == name {
+			r.names = append(r.names[:i], r.names[i+1:]...)
+			break
+		}
+	}
+	r.enqueueLocked(RegistryEvent{Type: EventRemoved, Name: name, Process: entry.p})
+	r.mu.Unlock()
+
+	entry.removeO()
+	return nil
+}
+
+// Subscribe returns a channel receiving every event of the Registry
+// and a function to stop the subscription. A subscriber that lets more
+// than bufSize events pile up is disconnected and its channel closed,
+// see SubscribeWith for the other policies
+func (r *Registry) Subscribe(bufSize int) (<-chan RegistryEvent, func()) {
+	s := r.SubscribeWith(ListenerOptions{BufSize: bufSize, Policy: ListenerDisconnect})
+	return s.Ch(), s.Close
+}
+
+// SubscribeWith returns a subscription to the events of the Registry
+// with a buffer of opts.BufSize events, at least one. When the buffer is
+// full, ListenerDropOldest and ListenerDropNewest discard an event, while
+// any other policy disconnects the subscriber immediately, as waiting
+// would block the processes: opts.Timeout is ignored
+func (r *Registry) SubscribeWith(opts ListenerOptions) *RegistrySubscription {
+	s := &RegistrySubscription{
+		ch:     make(chan RegistryEvent, max(opts.BufSize, 1)),
+		policy: opts.Policy,
+		r:      r,
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		s.closeLocked()
+	} else {
+		r.subs[s] = struct{}{}
+	}
+	return s
+}
+
+// Ch returns the channel of the events
+func (s *RegistrySubscription) Ch() <-chan RegistryEvent {
+	return s.ch
+}
+
+// Dropped returns the number of events discarded so far
+func (s *RegistrySubscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Disconnected reports whether the subscription was
+// closed because its buffer was full
+func (s *RegistrySubscription) Disconnected() bool {
+	return s.disconnected.Load()
+}
+
+// Close stops the subscription and closes its channel
+func (s *RegistrySubscription) Close() {
+	s.r.mu.Lock()
+	defer s.r.mu.Unlock()
+
+	s.closeLocked()
+}
+
+func (s *RegistrySubscription) closeLocked() {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	delete(s.r.subs, s)
+	close(s.ch)
+}
+
+// sendLocked delivers the event without ever blocking
+func (s *RegistrySubscription) sendLocked(e RegistryEvent) {
+	select {
+	case s.ch <- e:
+		return
+	default:
+	}
+
+	switch s.policy {
+	case ListenerDropOldest:
+		select {
+		case <-s.ch:
+		default:
+		}
+		select {
+		case s.ch <- e:
+		default:
+		}
+		s.dropped.Add(1)
+	case ListenerDropNewest:
+		s.dropped.Add(1)
+	default:
+		s.dropped.Add(1)
+		s.disconnected.Store(true)
+		s.closeLocked()
+	}
+}
+
+// Close removes every Process from the Registry, without stopping them,
+// and closes the subscriptions
+func (r *Registry) Close() {
+	r.mu.Lock()
+	if r.closed {
+		r.mu.Unlock()
+		return
+	}
+	r.closed = true
+	for _, entry := range r.procs {
+		entry.active = false
+	}
+	entries := r.procs
+	r.procs = make(map[string]*registryEntry)
+	r.names = nil
+	for s := range r.subs {
+		s.closeLocked()
+	}
+	r.mu.Unlock()
+
+	for _, entry := range entries {
+		entry.removeO()
+	}
+}
+
+func (r *Registry) enqueue(entry *registryEntry, e RegistryEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if entry.active {
+		r.enqueueLocked(e)
+	}
+}
+
+func (r *Registry) enqueueLocked(e RegistryEvent) {
+	if r.closed {
+		return
+	}
+
+	e.Time = time.Now()
+	for s := range r.subs {
+		s.sendLocked(e)
+	}
+}
@@ -0,0 +1,111 @@
+package process
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+)
+
+// registryEvents registers n processes that are never started,
+// producing n EventRegistered events
+func registryEvents(t *testing.T, r *Registry, n int) {
+	t.Helper()
+
+	for i := range n {
+		p, err := NewProcess("", os.Args[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := r.Register(fmt.Sprint(i), p); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func receiveNames(s *RegistrySubscription) []string {
+	var names []string
+	for e := range s.Ch() {
+		names = append(names, e.Name)
+	}
+	return names
+}
+
+func TestRegistrySubscriptionPolicies(t *testing.T) {
+	tests := []struct {
+		policy       ListenerPolicy
+		names        []string
+		dropped      uint64
+		disconnected bool
+	}{
+		{ListenerDropOldest, []string{"2", "3"}, 2, false},
+		{ListenerDropNewest, []string{"0", "1"}, 2, false},
+		{ListenerDisconnect, []string{"0", "1"}, 1, true},
+	}
+
+	for _, tt := range tests {
+		r := NewRegistry()
+		s := r.SubscribeWith(ListenerOptions{BufSize: 2, Policy: tt.policy})
+
+		registryEvents(t, r, 4)
+		r.Close()
+
+		names := receiveNames(s)
+		if fmt.Sprint(names) != fmt.Sprint(tt.names) {
+			t.Errorf("policy %d: got %v, want %v", tt.policy, names, tt.names)
+		}
+		if s.Dropped() != tt.dropped {
+			t.Errorf("policy %d: Dropped() = %d, want %d", tt.policy, s.Dropped(), tt.dropped)
+		}
+		if s.Disconnected() != tt.disconnected {
+			t.Errorf("policy %d: Disconnected() = %v, want %v", tt.policy, s.Disconnected(), tt.disconnected)
+		}
+	}
+}
+
+func TestRegistrySlowSubscriber(t *testing.T) {
+	r := NewRegistry()
+	defer r.Close()
+
+	// a subscriber that never reads must not delay the others
+	r.Subscribe(1)
+	ch, unsubscribe := r.Subscribe(16)
+	defer unsubscribe()
+
+	done := make(chan struct{})
+	go func() {
+		registryEvents(t, r, 8)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Register blocked on a slow subscriber")
+	}
+	if len(ch) != 8 {
+		t.Errorf("got %d events, want 8", len(ch))
+	}
+}
+
+func TestRegistryRegisterWhileStarting(t *testing.T) {
+	p, err := NewProcess("", os.Args[0], "-test.run=^$")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	r := NewRegistry()
+	defer r.Close()
+	ch, _ := r.Subscribe(16)
+
+	// run with -race: Register reads the PID while Start sets it
+	go p.Start(nil, nil, nil)
+	if err := r.Register("p", p); err != nil {
+		t.Fatal(err)
+	}
+	if e := <-ch; e.Type != EventRegistered {
+		t.Errorf("first event = %v, want %v", e.Type, EventRegistered)
+	}
+	p.Wait()
+}
@@ -0,0 +1,194 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"regexp"
+	"slices"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy are the options of RunWithRetry
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of runs, 3 if zero
+	MaxAttempts int
+	// Backoff is the delay before the first retry, doubled (or multiplied
+	// by Multiplier) after each attempt up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	Multiplier float64
+	// Jitter adds to each delay a random duration up to Jitter
+	Jitter time.Duration
+	// Timeout is the maximum duration of each attempt, after which
+	// the Process is killed; zero means no limit. An attempt that timed
+	// out is always transient, unless Retryable says otherwise, as the
+	// kill leaves no exit code or output to match
+	Timeout time.Duration
+
+	// ExitCodes, Signals and Stderr decide which failures are transient:
+	// a failed attempt is retried if its exit code, the signal that
+	// terminated it or its stderr output matches any of them. If none
+	// is set, every failure is retried
+	ExitCodes []int
+	Signals   []syscall.Signal
+	Stderr    *regexp.Regexp
+	// Retryable, if set, replaces ExitCodes, Signals and Stderr
+	Retryable func(a Attempt) bool
+}
+
+// Attempt is the record of a run of RunWithRetry
+type Attempt struct {
+	ExitStatus ExitStatus
+	Stdout     []byte
+	Stderr     []byte
+	Started    time.Time
+	Duration   time.Duration
+	// Err is set if the attempt could not start, failed or timed out
+	Err error
+	// Retryable reports whether the failure was considered transient
+	Retryable bool
+}
+
+// RetryResult holds every attempt of RunWithRetry, the oldest first
+type RetryResult struct {
+	Attempts []Attempt
+}
+
+// Last returns the last attempt
+func (r RetryResult) Last() Attempt {
+	if len(r.Attempts) == 0 {
+		return Attempt{}
+	}
+	return r.Attempts[len(r.Attempts)-1]
+}
+
+// ErrAttemptTimeout is the error of an attempt killed after the
+// Timeout of the RetryPolicy
+var ErrAttemptTimeout = errors.New("attempt timed out")
+
+// RunWithRetry runs a fresh Process.Clone of p until it exits successfully,
+// the failure is not retryable following the policy, or the attempts
+// are exhausted, waiting between attempts with an exponential backoff.
+// Errors that prevent the Process from starting are never retried.
+// The standard input of the attempts is the NULL file.
+// Cancelling ctx kills the running attempt and stops the retries.
+// The error is nil only if the last attempt succeeded
+func (p *Process) RunWithRetry(ctx context.Context, policy RetryPolicy) (RetryResult, error) {
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = 3
+	}
+	if policy.Multiplier <= 0 {
+		policy.Multiplier = 2
+	}
+
+	var result RetryResult
+	delay := policy.Backoff
+	for {
+		a := runRetryAttempt(ctx, p.Clone(), policy.Timeout)
+		if a.Err != nil && ctx.Err() == nil && !errors.Is(a.Err, errStart) {
+			a.Retryable = policy.retryable(a)
+		}
+		result.Attempts = append(result.Attempts, a)
+
+		switch {
+		case a.Err == nil:
+			return result, nil
+		case ctx.Err() != nil:
+			return result, fmt.Errorf("process \"%s\": %w", p.ExecName, ctx.Err())
+		case !a.Retryable:
+			return result, fmt.Errorf("process \"%s\": permanent failure after %d attempts: %w", p.ExecName, len(result.Attempts), a.Err)
+		case len(result.Attempts) >= policy.MaxAttempts:
+			return result, fmt.Errorf("process \"%s\": %d attempts failed: %w", p.ExecName, len(result.Attempts), a.Err)
+		}
+
+		wait := delay
+		if policy.Jitter > 0 {
+			wait += rand.N(policy.Jitter)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return result, fmt.Errorf("process \"%s\": %w", p.ExecName, ctx.Err())
+		}
+
+		delay = time.Duration(float64(delay) * policy.Multiplier)
+		if policy.MaxBackoff > 0 && delay > policy.MaxBackoff {
+			delay = policy.MaxBackoff
+		}
+	}
+}
+
+// errStart marks the errors of the attempts that could not start
+var errStart = errors.New("start failed")
+
+func runRetryAttempt(ctx context.Context, p *Process, timeout time.Duration) Attempt {
+	defer p.Close()
+
+	// the deadline of ctx stops the retries, only the one of the attempt times it out
+	attemptCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		attemptCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	a := Attempt{Started: time.Now()}
+	if err := p.Start(DevNull(), nil, nil); err != nil {
+		a.Err = fmt.Errorf("%w: %w", errStart, err)
+		return a
+	}
+
+	exited := make(chan ExitStatus, 1)
+	go func() {
+		exited <- p.Wait()
+	}()
+
+	select {
+	case a.ExitStatus = <-exited:
+		if err := a.ExitStatus.Error(); err != nil {
+			a.Err = err
+		} else if sig, ok := a.ExitStatus.Signal(); ok {
+			a.Err = fmt.Errorf("terminated by signal: %v", sig)
+		} else if a.ExitStatus.ExitCode != 0 {
+			a.Err = fmt.Errorf("exit status (code 0x%x)", a.ExitStatus.ExitCode)
+		}
+	case <-attemptCtx.Done():
+		p.Kill()
+		a.ExitStatus = <-exited
+		a.Err = ctx.Err()
+		if a.Err == nil {
+			a.Err = ErrAttemptTimeout
+		}
+	}
+
+	a.Duration = time.Since(a.Started)
+	a.Stdout, a.Stderr = p.Stdout(), p.Stderr()
+	return a
+}
+
+func (policy RetryPolicy) retryable(a Attempt) bool {
+	if policy.Retryable != nil {
+		return policy.Retryable(a)
+	}
+	if errors.Is(a.Err, ErrAttemptTimeout) {
+		return true
+	}
+	if policy.ExitCodes == nil && policy.Signals == nil && policy.Stderr == nil {
+		return true
+	}
+
+	if sig, ok := a.ExitStatus.Signal(); ok {
+		if slices.Contains(policy.Signals, sig) {
+			return true
+		}
+	} else if slices.Contains(policy.ExitCodes, a.ExitStatus.ExitCode) {
+		return true
+	}
+	return policy.Stderr != nil && policy.Stderr.Match(a.Stderr)
+}
@@ -0,0 +1,131 @@
+//go:build !windows
+
+package process
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRetryUntilSuccess(t *testing.T) {
+	p := newShell(t, flakyScript(t, 3))
+
+	result, err := p.RunWithRetry(context.Background(), RetryPolicy{MaxAttempts: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(result.Attempts); n != 3 {
+		t.Errorf("%d attempts, want 3", n)
+	}
+	for _, a := range result.Attempts[:2] {
+		if a.Err == nil || !a.Retryable {
+			t.Errorf("failed attempt = %v, retryable %v", a.Err, a.Retryable)
+		}
+	}
+	if last := result.Last(); last.Err != nil || last.ExitStatus.ExitCode != 0 {
+		t.Errorf("last attempt = %v", last.Err)
+	}
+}
+
+func TestRetryConditions(t *testing.T) {
+	tests := []struct {
+		name     string
+		script   string
+		policy   RetryPolicy
+		attempts int
+	}{
+		{"exit code", "exit 75", RetryPolicy{ExitCodes: []int{75}}, 3},
+		{"other exit code", "exit 1", RetryPolicy{ExitCodes: []int{75}}, 1},
+		{"signal", "kill -USR1 $$", RetryPolicy{Signals: []syscall.Signal{syscall.SIGUSR1}}, 3},
+		{"signal as exit code", "kill -USR1 $$", RetryPolicy{ExitCodes: []int{-1, int(syscall.SIGUSR1)}}, 1},
+		{"stderr", "echo 'connection refused' >&2; exit 1", RetryPolicy{Stderr: regexp.MustCompile(`refused`)}, 3},
+		{"other stderr", "echo 'bad input' >&2; exit 1", RetryPolicy{Stderr: regexp.MustCompile(`refused`)}, 1},
+		{"every failure", "exit 1", RetryPolicy{}, 3},
+		{"retryable", "exit 75", RetryPolicy{ExitCodes: []int{75}, Retryable: func(a Attempt) bool { return false }}, 1},
+		// a timeout is transient whatever the other conditions say
+		{"timeout", "exec sleep 10", RetryPolicy{ExitCodes: []int{75}, Timeout: 100 * time.Millisecond}, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := newShell(t, tt.script).RunWithRetry(context.Background(), tt.policy)
+			if err == nil {
+				t.Fatal("RunWithRetry succeeded")
+			}
+			if n := len(result.Attempts); n != tt.attempts {
+				t.Errorf("%d attempts, want %d: %v", n, tt.attempts, err)
+			}
+			if last := result.Last(); last.Retryable != (tt.attempts > 1) {
+				t.Errorf("last attempt retryable = %v", last.Retryable)
+			}
+		})
+	}
+}
+
+func TestRetryTimeout(t *testing.T) {
+	p := newShell(t, "exec sleep 10")
+
+	result, err := p.RunWithRetry(context.Background(), RetryPolicy{MaxAttempts: 1, Timeout: 100 * time.Millisecond})
+	if !errors.Is(err, ErrAttemptTimeout) {
+		t.Errorf("RunWithRetry = %v, want %v", err, ErrAttemptTimeout)
+	}
+	if d := result.Last().Duration; d > 2*time.Second {
+		t.Errorf("the attempt lasted %v", d)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	p := newShell(t, "exit 1")
+
+	policy := RetryPolicy{MaxAttempts: 4, Backoff: 100 * time.Millisecond, MaxBackoff: 150 * time.Millisecond}
+	result, err := p.RunWithRetry(context.Background(), policy)
+	if err == nil {
+		t.Fatal("RunWithRetry succeeded")
+	}
+
+	// the second delay is doubled but capped by MaxBackoff
+	want := []time.Duration{100 * time.Millisecond, 150 * time.Millisecond, 150 * time.Millisecond}
+	for i, a := range result.Attempts[1:] {
+		prev := result.Attempts[i]
+		delay := a.Started.Sub(prev.Started.Add(prev.Duration))
+		if delay < want[i] || delay > want[i]+time.Second {
+			t.Errorf("delay before attempt %d = %v, want %v", i+2, delay, want[i])
+		}
+	}
+}
+
+func TestRetryStartError(t *testing.T) {
+	p := newShell(t, "true")
+	p.AddHook(HookPreStart, func(ctx context.Context, p *Process) error {
+		return errors.New("vetoed")
+	}, HookOptions{})
+
+	result, err := p.RunWithRetry(context.Background(), RetryPolicy{MaxAttempts: 3})
+	if err == nil {
+		t.Fatal("RunWithRetry succeeded")
+	}
+	if n := len(result.Attempts); n != 1 {
+		t.Errorf("%d attempts, want the start error not to be retried", n)
+	}
+	if result.Last().Retryable {
+		t.Error("the start error is retryable")
+	}
+}
+
+func TestRetryCancel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	p := newShell(t, "exec sleep 10")
+	result, err := p.RunWithRetry(ctx, RetryPolicy{MaxAttempts: 3, Timeout: 5 * time.Second})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("RunWithRetry = %v, want the deadline of the context", err)
+	}
+	if a := result.Last(); len(result.Attempts) != 1 || errors.Is(a.Err, ErrAttemptTimeout) {
+		t.Errorf("%d attempts, last = %v, want one cancelled", len(result.Attempts), a.Err)
+	}
+}
@@ -0,0 +1,356 @@
+package process
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// RunAllOptions are the options of RunAll
+type RunAllOptions struct {
+	// Concurrency is the maximum number of processes running at the
+	// same time, the number of CPUs if zero
+	Concurrency int
+	// FailFast cancels the jobs not yet started, and kills the running
+	// ones, as soon as a job fails
+	FailFast bool
+	// Retries is the number of times a failed job is run again
+	Retries int
+	// Timeout is the maximum duration of each attempt of a job,
+	// after which the Process is killed; zero means no limit
+	Timeout time.Duration
+}
+
+// JobState is the outcome of a job of RunAll
+type JobState string
+
+const (
+	JobPassed    JobState = "passed"
+	JobFailed    JobState = "failed"
+	JobTimedOut  JobState = "timed out"
+	JobError     JobState = "error"
+	JobCancelled JobState = "cancelled"
+)
+
+// JobResult is the outcome of a Process run by RunAll, with the
+// output lines and the ExitStatus of its last attempt
+type JobResult struct {
+	Name       string
+	Process    *Process
+	State      JobState
+	Attempts   int
+	ExitStatus ExitStatus
+	Stdout     [][]byte
+	Stderr     [][]byte
+	Started    time.Time
+	Duration   time.Duration
+	// Err is the error of the last attempt
+	Err error
+}
+
+// Report is the result of RunAll, with the jobs in the order
+// the processes were passed
+type Report struct {
+	Jobs     []JobResult
+	Started  time.Time
+	Duration time.Duration
+}
+
+// RunAll runs the processes on a pool of workers and returns a Report
+// of all of them once they are done. The standard input of the processes
+// is the NULL file, so they don't wait for input that can't come.
+// Cancelling ctx cancels the jobs not yet started and kills the running ones
+func RunAll(ctx context.Context, procs []*Process, opts RunAllOptions) *Report {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = runtime.NumCPU()
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	report := &Report{Jobs: make([]JobResult, len(procs)), Started: time.Now()}
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for i := 0; i < min(opts.Concurrency, len(procs)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				result := &report.Jobs[i]
+				runJob(ctx, procs[i], opts, result)
+				if opts.FailFast && result.State != JobPassed && result.State != JobCancelled {
+					cancel()
+				}
+			}
+		}()
+	}
+
+	for i, p := range procs {
+		report.Jobs[i] = JobResult{Name: jobName(p), Process: p, State: JobCancelled}
+		if ctx.Err() != nil {
+			continue
+		}
+
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	report.Duration = time.Since(report.Started)
+	return report
+}
+
+func jobName(p *Process) string {
+	return JoinArgs(append([]string{p.ExecName}, p.args...)...)
+}
+
+// runJob runs every attempt of a job, filling its result
+func runJob(ctx context.Context, p *Process, opts RunAllOptions, result *JobResult) {
+	result.Started = time.Now()
+	defer func() {
+		result.Duration = time.Since(result.Started)
+	}()
+
+	for attempt := 0; attempt <= opts.Retries; attempt++ {
+		if ctx.Err() != nil {
+			if result.Attempts == 0 {
+				result.State = JobCancelled
+			}
+			return
+		}
+
+		result.Attempts++
+		result.State, result.ExitStatus, result.Err = runAttempt(ctx, p, opts.Timeout)
+		if result.State != JobError {
+			result.Stdout, result.Stderr = p.StdoutLines(), p.StderrLines()
+		}
+
+		if result.State == JobPassed || result.State == JobCancelled {
+			return
+		}
+	}
+}
+
+func runAttempt(ctx context.Context, p *Process, timeout time.Duration) (JobState, ExitStatus, error) {
+	// the deadline of ctx cancels the job, only the one of the attempt times it out
+	attemptCtx := ctx
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		attemptCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	if err := p.Start(DevNull(), nil, nil); err != nil {
+		return JobError, ExitStatus{}, err
+	}
+
+	exited := make(chan ExitStatus, 1)
+	go func() {
+		exited <- p.Wait()
+	}()
+
+	select {
+	case exitStatus := <-exited:
+		if err := exitStatus.Error(); err != nil || exitStatus.ExitCode != 0 {
+			if err == nil {
+				err = fmt.Errorf("exit status (code 0x%x)", exitStatus.ExitCode)
+			}
+			return JobFailed, exitStatus, err
+		}
+		return JobPassed, exitStatus, nil
+	case <-attemptCtx.Done():
+		p.Kill()
+		exitStatus := <-exited
+		if ctx.Err() == nil {
+			return JobTimedOut, exitStatus, fmt.Errorf("timed out after %v", timeout)
+		}
+		return JobCancelled, exitStatus, ctx.Err()
+	}
+}
+
+// Count returns the number of jobs in the given state
+func (r *Report) Count(state JobState) int {
+	n := 0
+	for _, job := range r.Jobs {
+		if job.State == state {
+			n++
+		}
+	}
+	return n
+}
+
+// Err returns an error listing the jobs that didn't pass, if any
+func (r *Report) Err() error {
+	var errs []error
+	for _, job := range r.Jobs {
+		if job.State != JobPassed {
+			errs = append(errs, fmt.Errorf("%s: %s", job.Name, job.State))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// WriteTable writes a summary table of the jobs, followed by the totals
+func (r *Report) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "JOB\tSTATE\tEXIT\tATTEMPTS\tDURATION")
+	for _, job := range r.Jobs {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%v\n", job.Name, job.State, job.ExitStatus.ExitCode, job.Attempts, job.Duration.Round(time.Millisecond))
+	}
+	fmt.Fprintf(tw, "\n%d passed, %d failed, %d timed out, %d errors, %d cancelled in %v\n",
+		r.Count(JobPassed), r.Count(JobFailed), r.Count(JobTimedOut),
+		r.Count(JobError), r.Count(JobCancelled), r.Duration.Round(time.Millisecond),
+	)
+	return tw.Flush()
+}
+
+type jsonJob struct {
+	Name     string   `json:"name"`
+	State    JobState `json:"state"`
+	ExitCode int      `json:"exit_code"`
+	Attempts int      `json:"attempts"`
+	Started  string   `json:"started,omitempty"`
+	Duration float64  `json:"duration_seconds"`
+	Error    string   `json:"error,omitempty"`
+	Stdout   []string `json:"stdout"`
+	Stderr   []string `json:"stderr"`
+}
+
+type jsonReport struct {
+	Started  string    `json:"started"`
+	Duration float64   `json:"duration_seconds"`
+	Jobs     []jsonJob `json:"jobs"`
+}
+
+func linesToStrings(lines [][]byte) []string {
+	s := make([]string, 0, len(lines))
+	for _, line := range lines {
+		s = append(s, string(line))
+	}
+	return s
+}
+
+// WriteJSON writes the report as a JSON object
+func (r *Report) WriteJSON(w io.Writer) error {
+	report := jsonReport{
+		Started:  r.Started.Format(time.RFC3339Nano),
+		Duration: r.Duration.Seconds(),
+		Jobs:     make([]jsonJob, 0, len(r.Jobs)),
+	}
+
+	for _, job := range r.Jobs {
+		j := jsonJob{
+			Name:     job.Name,
+			State:    job.State,
+			ExitCode: job.ExitStatus.ExitCode,
+			Attempts: job.Attempts,
+			Duration: job.Duration.Seconds(),
+			Stdout:   linesToStrings(job.Stdout),
+			Stderr:   linesToStrings(job.Stderr),
+		}
+		if !job.Started.IsZero() {
+			j.Started = job.Started.Format(time.RFC3339Nano)
+		}
+		if job.Err != nil {
+			j.Error = job.Err.Error()
+		}
+		report.Jobs = append(report.Jobs, j)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr,omitempty"`
+	Body    string `xml:",chardata"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Error     *junitMessage `xml:"error,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+	SystemErr string        `xml:"system-err,omitempty"`
+}
+
+type junitSuite struct {
+	XMLName   xml.Name    `xml:"testsuite"`
+	Name      string      `xml:"name,attr"`
+	Tests     int         `xml:"tests,attr"`
+	Failures  int         `xml:"failures,attr"`
+	Errors    int         `xml:"errors,attr"`
+	Skipped   int         `xml:"skipped,attr"`
+	Time      string      `xml:"time,attr"`
+	Timestamp string      `xml:"timestamp,attr"`
+	Cases     []junitCase `xml:"testcase"`
+}
+
+func junitTime(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+// WriteJUnit writes the report as a JUnit XML test suite with the given
+// name: failed and timed out jobs are failures, jobs that couldn't start
+// are errors and cancelled jobs are skipped
+func (r *Report) WriteJUnit(w io.Writer, suite string) error {
+	s := junitSuite{
+		Name:      suite,
+		Tests:     len(r.Jobs),
+		Failures:  r.Count(JobFailed) + r.Count(JobTimedOut),
+		Errors:    r.Count(JobError),
+		Skipped:   r.Count(JobCancelled),
+		Time:      junitTime(r.Duration),
+		Timestamp: r.Started.Format("2006-01-02T15:04:05"),
+	}
+
+	for _, job := range r.Jobs {
+		c := junitCase{
+			Name:      job.Name,
+			Classname: suite,
+			Time:      junitTime(job.Duration),
+			SystemOut: string(joinLines(job.Stdout)),
+			SystemErr: string(joinLines(job.Stderr)),
+		}
+
+		var msg string
+		if job.Err != nil {
+			msg = job.Err.Error()
+		}
+		switch job.State {
+		case JobFailed, JobTimedOut:
+			c.Failure = &junitMessage{Message: msg, Body: c.SystemErr}
+		case JobError:
+			c.Error = &junitMessage{Message: msg}
+		case JobCancelled:
+			c.Skipped = &junitMessage{Message: "cancelled"}
+		}
+		s.Cases = append(s.Cases, c)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(s); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,121 @@
+package process
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testReport() *Report {
+	started := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
+	return &Report{
+		Started:  started,
+		Duration: 1500 * time.Millisecond,
+		Jobs: []JobResult{
+			{Name: "ok", State: JobPassed, Attempts: 1, Started: started, Duration: 250 * time.Millisecond,
+				Stdout: [][]byte{[]byte("hello"), []byte("world")}},
+			{Name: "bad", State: JobFailed, Attempts: 2, Started: started, ExitStatus: ExitStatus{ExitCode: 1},
+				Err: errors.New("exit status (code 0x1)"), Stderr: [][]byte{[]byte("boom")}},
+			{Name: "slow", State: JobTimedOut, Attempts: 1, Started: started, Err: errors.New("timed out after 1s")},
+			{Name: "missing", State: JobError, Attempts: 1, Started: started, Err: errors.New("not found")},
+			{Name: "later", State: JobCancelled},
+		},
+	}
+}
+
+func TestReportCounts(t *testing.T) {
+	r := testReport()
+
+	for state, want := range map[JobState]int{JobPassed: 1, JobFailed: 1, JobTimedOut: 1, JobError: 1, JobCancelled: 1} {
+		if got := r.Count(state); got != want {
+			t.Errorf("Count(%s) = %d, want %d", state, got, want)
+		}
+	}
+
+	err := r.Err()
+	if err == nil {
+		t.Fatal("Err = nil with failed jobs")
+	}
+	for _, want := range []string{"bad: failed", "slow: timed out", "missing: error", "later: cancelled"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Err = %q, missing %q", err, want)
+		}
+	}
+	if strings.Contains(err.Error(), "ok") {
+		t.Errorf("Err = %q lists the passed job", err)
+	}
+
+	var table strings.Builder
+	if err := r.WriteTable(&table); err != nil {
+		t.Fatal(err)
+	}
+	if want := "1 passed, 1 failed, 1 timed out, 1 errors, 1 cancelled in 1.5s"; !strings.Contains(table.String(), want) {
+		t.Errorf("table = %q, missing the totals %q", table.String(), want)
+	}
+}
+
+func TestReportJSON(t *testing.T) {
+	var b strings.Builder
+	if err := testReport().WriteJSON(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	var report jsonReport
+	if err := json.Unmarshal([]byte(b.String()), &report); err != nil {
+		t.Fatal(err)
+	}
+	if report.Started != "2024-06-01T10:00:00Z" || report.Duration != 1.5 || len(report.Jobs) != 5 {
+		t.Fatalf("report = %+v", report)
+	}
+
+	ok, bad, later := report.Jobs[0], report.Jobs[1], report.Jobs[4]
+	if ok.State != JobPassed || ok.Duration != 0.25 || strings.Join(ok.Stdout, ",") != "hello,world" || ok.Error != "" {
+		t.Errorf("passed job = %+v", ok)
+	}
+	if bad.ExitCode != 1 || bad.Attempts != 2 || bad.Error != "exit status (code 0x1)" || strings.Join(bad.Stderr, ",") != "boom" {
+		t.Errorf("failed job = %+v", bad)
+	}
+	// a job never started has no start time, but empty outputs
+	if later.Started != "" || later.Stdout == nil || later.Stderr == nil {
+		t.Errorf("cancelled job = %+v", later)
+	}
+}
+
+func TestReportJUnit(t *testing.T) {
+	var b strings.Builder
+	if err := testReport().WriteJUnit(&b, "jobs"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(b.String(), xml.Header) {
+		t.Error("missing the XML header")
+	}
+
+	var suite junitSuite
+	if err := xml.Unmarshal([]byte(b.String()), &suite); err != nil {
+		t.Fatal(err)
+	}
+	if suite.Name != "jobs" || suite.Tests != 5 || suite.Failures != 2 || suite.Errors != 1 || suite.Skipped != 1 ||
+		suite.Time != "1.500" || suite.Timestamp != "2024-06-01T10:00:00" {
+		t.Errorf("suite = %+v", suite)
+	}
+
+	ok, bad, slow, missing, later := suite.Cases[0], suite.Cases[1], suite.Cases[2], suite.Cases[3], suite.Cases[4]
+	if ok.Failure != nil || ok.Error != nil || ok.Skipped != nil || ok.SystemOut != "hello\nworld\n" || ok.Time != "0.250" {
+		t.Errorf("passed case = %+v", ok)
+	}
+	if bad.Failure == nil || bad.Failure.Message != "exit status (code 0x1)" || bad.Failure.Body != "boom\n" {
+		t.Errorf("failed case = %+v", bad)
+	}
+	if slow.Failure == nil {
+		t.Errorf("timed out case = %+v, want a failure", slow)
+	}
+	if missing.Error == nil || missing.Error.Message != "not found" {
+		t.Errorf("error case = %+v", missing)
+	}
+	if later.Skipped == nil || later.Classname != "jobs" {
+		t.Errorf("cancelled case = %+v", later)
+	}
+}
@@ -0,0 +1,116 @@
+//go:build !windows
+
+package process
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// flakyScript fails until it has run n times, counting the runs in a file
+func flakyScript(t *testing.T, n int) string {
+	count := filepath.Join(t.TempDir(), "count")
+	return fmt.Sprintf(`n=$(cat '%[1]s' 2>/dev/null || echo 0); n=$((n+1)); echo $n > '%[1]s'; [ $n -ge %[2]d ]`, count, n)
+}
+
+func TestRunAllStates(t *testing.T) {
+	failing := newShell(t, "true")
+	failing.AddHook(HookPreStart, func(ctx context.Context, p *Process) error {
+		return errors.New("vetoed")
+	}, HookOptions{})
+
+	procs := []*Process{
+		newShell(t, "echo out; echo err >&2"),
+		newShell(t, "exit 2"),
+		// the standard input is closed, so cat exits
+		newShell(t, "cat"),
+		newShell(t, "exec sleep 10"),
+		failing,
+	}
+	report := RunAll(context.Background(), procs, RunAllOptions{Timeout: 300 * time.Millisecond})
+
+	want := []JobState{JobPassed, JobFailed, JobPassed, JobTimedOut, JobError}
+	for i, job := range report.Jobs {
+		if job.State != want[i] {
+			t.Errorf("job %d (%s) = %s, want %s: %v", i, job.Name, job.State, want[i], job.Err)
+		}
+		if job.Process != procs[i] || job.Attempts != 1 {
+			t.Errorf("job %d: process %p, %d attempts", i, job.Process, job.Attempts)
+		}
+	}
+
+	if out := report.Jobs[0]; string(joinLines(out.Stdout)) != "out\n" || string(joinLines(out.Stderr)) != "err\n" {
+		t.Errorf("output = %q, %q", out.Stdout, out.Stderr)
+	}
+	if code := report.Jobs[1].ExitStatus.ExitCode; code != 2 {
+		t.Errorf("exit code = %d, want 2", code)
+	}
+	if name := report.Jobs[1].Name; name != "sh -c 'exit 2'" {
+		t.Errorf("name = %q", name)
+	}
+	if d := report.Jobs[3].Duration; d > 2*time.Second {
+		t.Errorf("the timed out job lasted %v", d)
+	}
+}
+
+func TestRunAllRetries(t *testing.T) {
+	flaky, failing := newShell(t, flakyScript(t, 2)), newShell(t, "exit 1")
+
+	report := RunAll(context.Background(), []*Process{flaky, failing}, RunAllOptions{Retries: 2})
+
+	if job := report.Jobs[0]; job.State != JobPassed || job.Attempts != 2 {
+		t.Errorf("flaky job = %s after %d attempts, want passed after 2", job.State, job.Attempts)
+	}
+	if job := report.Jobs[1]; job.State != JobFailed || job.Attempts != 3 {
+		t.Errorf("failing job = %s after %d attempts, want failed after 3", job.State, job.Attempts)
+	}
+}
+
+func TestRunAllFailFast(t *testing.T) {
+	// the running jobs are killed and the next ones are not started
+	procs := []*Process{
+		newShell(t, "sleep 0.1; exit 1"),
+		newShell(t, "exec sleep 10"),
+		newShell(t, "true"),
+		newShell(t, "true"),
+	}
+	start := time.Now()
+	report := RunAll(context.Background(), procs, RunAllOptions{Concurrency: 2, FailFast: true})
+
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("RunAll took %v", elapsed)
+	}
+	if job := report.Jobs[0]; job.State != JobFailed {
+		t.Errorf("first job = %s, want failed", job.State)
+	}
+	if job := report.Jobs[1]; job.State != JobCancelled || job.Attempts != 1 {
+		t.Errorf("running job = %s after %d attempts, want cancelled after 1", job.State, job.Attempts)
+	}
+	for _, job := range report.Jobs[2:] {
+		if job.State != JobCancelled || job.Attempts != 0 {
+			t.Errorf("next job = %s after %d attempts, want cancelled before starting", job.State, job.Attempts)
+		}
+	}
+	if n := report.Count(JobCancelled); n != 3 {
+		t.Errorf("%d cancelled jobs, want 3", n)
+	}
+}
+
+func TestRunAllCancel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	procs := []*Process{newShell(t, "exec sleep 10"), newShell(t, "exec sleep 10")}
+	report := RunAll(ctx, procs, RunAllOptions{Concurrency: 1, Retries: 3})
+
+	if job := report.Jobs[0]; job.State != JobCancelled || job.Attempts != 1 {
+		t.Errorf("running job = %s after %d attempts, want cancelled after 1", job.State, job.Attempts)
+	}
+	if job := report.Jobs[1]; job.State != JobCancelled || job.Attempts != 0 {
+		t.Errorf("queued job = %s after %d attempts, want cancelled before starting", job.State, job.Attempts)
+	}
+}
@@ -0,0 +1,432 @@
+package process
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+)
+
+// OverlapPolicy decides what happens when a job of a Scheduler
+// is due while its previous run is still going
+type OverlapPolicy int
+
+const (
+	// OverlapSkip skips the new run
+	OverlapSkip OverlapPolicy = iota
+	// OverlapQueue starts the new run after the previous one
+	OverlapQueue
+	// OverlapReplace stops the previous run gracefully, with the
+	// StopTimeout of the job, and then starts the new one
+	OverlapReplace
+)
+
+var (
+	// ErrRunSkipped is the error of a run skipped by OverlapSkip
+	ErrRunSkipped = errors.New("run skipped, the previous one is still running")
+	// ErrRunReplaced is the error of a run stopped by OverlapReplace
+	ErrRunReplaced = errors.New("run replaced by a new one")
+	// ErrMaxRuntime is the error of a run stopped for exceeding the max runtime
+	ErrMaxRuntime = errors.New("run exceeded the max runtime")
+)
+
+// DefaultRunHistory is the number of runs kept for each job
+const DefaultRunHistory = 20
+
+// JobOptions are the options of a job of a Scheduler
+type JobOptions struct {
+	Overlap OverlapPolicy
+	// Jitter delays each activation by a random duration up to Jitter
+	Jitter time.Duration
+	// MaxRuntime stops a run, gracefully, after this duration;
+	// zero means no limit
+	MaxRuntime time.Duration
+	// StopTimeout is the time given to a run to exit after the CTRL-C
+	// event before being killed
+	StopTimeout time.Duration
+	// CatchUp is the number of missed activations that are run when the
+	// Scheduler wakes up late, for example after the system was suspended.
+	// With zero, the missed activations are merged into a single run
+	CatchUp int
+	// LastRun, if set, is the time of the last activation before the
+	// Scheduler started, so that the activations missed since then
+	// are handled like in CatchUp
+	LastRun time.Time
+	// History is the number of runs kept, DefaultRunHistory if zero
+	History int
+}
+
+// Run is the record of an activation of a job of a Scheduler
+type Run struct {
+	Scheduled  time.Time
+	Started    time.Time
+	Finished   time.Time
+	ExitStatus ExitStatus
+	Stdout     []byte
+	Stderr     []byte
+	// Err is set if the run could not start, was skipped or was stopped
+	// by the Scheduler
+	Err error
+}
+
+// Scheduler runs clones of processes on cron expressions or fixed
+// intervals, see ParseCron and Every. Each activation runs a fresh
+// Process.Clone of the job Process, whose output is captured and kept in
+// the history of the job together with its ExitStatus
+type Scheduler struct {
+	mu      sync.Mutex
+	jobs    map[string]*schedJob
+	names   []string
+	started bool
+	stopped bool
+	wg      sync.WaitGroup
+}
+
+type schedJob struct {
+	name       string
+	sched      Schedule
+	p          *Process
+	opts       JobOptions
+	current    *Process
+	currentRun *Run
+	queue      []time.Time
+	history    []Run
+	stop       chan struct{}
+}
+
+// NewScheduler creates a Scheduler without jobs
+func NewScheduler() *Scheduler {
+	return &Scheduler{jobs: make(map[string]*schedJob)}
+}
+
+// Add adds a job with a unique name that runs clones of p following
+// the schedule. If the Scheduler is already started, the job is
+// scheduled immediately
+func (s *Scheduler) Add(name string, sched Schedule, p *Process, opts JobOptions) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopped {
+		return errors.New("scheduler stopped")
+	}
+	if _, ok := s.jobs[name]; ok {
+		return fmt.Errorf("job \"%s\" already defined", name)
+	}
+	if opts.History <= 0 {
+		opts.History = DefaultRunHistory
+	}
+
+	j := &schedJob{name: name, sched: sched, p: p, opts: opts, stop: make(chan struct{})}
+	s.jobs[name] = j
+	s.names = append(s.names, name)
+
+	if s.started {
+		s.wg.Add(1)
+		go s.loop(j)
+	}
+	return nil
+}
+
+// Remove removes the job, stopping its current run, if any,
+// with the StopTimeout of the job
+func (s *Scheduler) Remove(name string) error {
+	s.mu.Lock()
+	j, ok := s.jobs[name]
+	if !ok {
+		s.mu.Unlock()
+		return fmt.Errorf("job \"%s\" not defined", name)
+	}
+
+	delete(s.jobs, name)
+	for i, n := range s.names {
+		if n == name {
+			s.names = append(s.names[:i], s.names[i+1:]...)
+			break
+		}
+	}
+	current := s.stopJobLocked(j)
+	s.mu.Unlock()
+
+	if current != nil {
+		current.StopTimeout(j.opts.StopTimeout)
+	}
+	return nil
+}
+
+// stopJobLocked stops the scheduling of the job and
+// returns its current run, if any
+func (s *Scheduler) stopJobLocked(j *schedJob) *Process {
+	select {
+	case <-j.stop:
+	default:
+		close(j.stop)
+	}
+	j.queue = nil
+	return j.current
+}
+
+// Jobs returns the names of the jobs in the order they were added
+func (s *Scheduler) Jobs() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.names...)
+}
+
+// History returns the most recent runs of the job, the oldest first
+func (s *Scheduler) History(name string) ([]Run, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	j, ok := s.jobs[name]
+	if !ok {
+		return nil, fmt.Errorf("job \"%s\" not defined", name)
+	}
+	return append([]Run(nil), j.history...), nil
+}
+
+// RunNow activates the job immediately, following its overlap policy
+func (s *Scheduler) RunNow(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stopped {
+		return errors.New("scheduler stopped")
+	}
+
+	j, ok := s.jobs[name]
+	if !ok {
+		return fmt.Errorf("job \"%s\" not defined", name)
+	}
+	s.triggerLocked(j, time.Now())
+	return nil
+}
+
+// Start starts scheduling the jobs
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.started || s.stopped {
+		return
+	}
+	s.started = true
+
+	for _, name := range s.names {
+		s.wg.Add(1)
+		go s.loop(s.jobs[name])
+	}
+}
+
+// Stop stops scheduling the jobs and stops the current runs,
+// killing the ones still running after the grace period. It
+// returns when every run has exited
+func (s *Scheduler) Stop(grace time.Duration) {
+	s.mu.Lock()
+	s.stopped = true
+
+	var current []*Process
+	for _, j := range s.jobs {
+		if p := s.stopJobLocked(j); p != nil {
+			current = append(current, p)
+		}
+	}
+	s.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, p := range current {
+		wg.Add(1)
+		go func(p *Process) {
+			defer wg.Done()
+			p.StopTimeout(grace)
+		}(p)
+	}
+	wg.Wait()
+	s.wg.Wait()
+}
+
+// loop waits for the activations of the job
+func (s *Scheduler) loop(j *schedJob) {
+	defer s.wg.Done()
+
+	now := time.Now()
+	next := j.sched.Next(now)
+	if !j.opts.LastRun.IsZero() && j.opts.LastRun.Before(now) {
+		next = j.sched.Next(j.opts.LastRun)
+	}
+
+	for !next.IsZero() {
+		delay := time.Until(next)
+		if j.opts.Jitter > 0 {
+			delay += rand.N(j.opts.Jitter)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-j.stop:
+			timer.Stop()
+			return
+		}
+
+		// collect the activations missed while sleeping, keeping
+		// only the last ones allowed by CatchUp
+		now := time.Now()
+		due := []time.Time{next}
+		for n := j.sched.Next(next); !n.IsZero() && !n.After(now); n = j.sched.Next(n) {
+			due = append(due, n)
+			if len(due) > j.opts.CatchUp+1 {
+				due = due[1:]
+			}
+		}
+
+		s.mu.Lock()
+		select {
+		case <-j.stop:
+			s.mu.Unlock()
+			return
+		default:
+		}
+		for _, scheduled := range due {
+			s.triggerLocked(j, scheduled)
+		}
+		s.mu.Unlock()
+
+		next = j.sched.Next(due[len(due)-1])
+	}
+}
+
+// triggerLocked handles an activation of the job
+func (s *Scheduler) triggerLocked(j *schedJob, scheduled time.Time) {
+	if j.current == nil {
+		s.launchLocked(j, scheduled)
+		return
+	}
+
+	switch j.opts.Overlap {
+	case OverlapQueue:
+		j.queue = append(j.queue, scheduled)
+	case OverlapReplace:
+		// only the most recent activation replaces the current run
+		j.queue = []time.Time{scheduled}
+		if j.currentRun.Err == nil {
+			j.currentRun.Err = ErrRunReplaced
+			go j.current.StopTimeout(j.opts.StopTimeout)
+		}
+	default:
+		now := time.Now()
+		j.record(Run{Scheduled: scheduled, Started: now, Finished: now, Err: ErrRunSkipped})
+	}
+}
+
+// launchLocked reserves the job for a new run and starts it in the
+// background, as the start hooks can take long
+func (s *Scheduler) launchLocked(j *schedJob, scheduled time.Time) {
+	p := j.p.Clone()
+	run := &Run{Scheduled: scheduled, Started: time.Now()}
+
+	j.current, j.currentRun = p, run
+	s.wg.Add(1)
+	go s.run(j, p, run)
+}
+
+// run starts a run without the lock of the Scheduler and waits for it
+func (s *Scheduler) run(j *schedJob, p *Process, run *Run) {
+	defer s.wg.Done()
+
+	if err := p.Start(DevNull(), nil, nil); err != nil {
+		p.Close()
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		run.Finished = time.Now()
+		run.Err = err
+		s.finishLocked(j, *run)
+		return
+	}
+
+	// the run could have been replaced or the Scheduler
+	// stopped while starting, when it couldn't be stopped
+	s.mu.Lock()
+	stopped := run.Err != nil
+	select {
+	case <-j.stop:
+		stopped = true
+	default:
+	}
+	s.mu.Unlock()
+
+	if stopped {
+		go p.StopTimeout(j.opts.StopTimeout)
+	}
+	s.wait(j, p, run)
+}
+
+// wait waits for a run to exit, stopping it when it exceeds the max
+// runtime, records it and starts the next queued run
+func (s *Scheduler) wait(j *schedJob, p *Process, run *Run) {
+	exited := make(chan ExitStatus, 1)
+	go func() {
+		exited <- p.Wait()
+	}()
+
+	var timeout <-chan time.Time
+	if j.opts.MaxRuntime > 0 {
+		timer := time.NewTimer(j.opts.MaxRuntime)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	var exitStatus ExitStatus
+	select {
+	case exitStatus = <-exited:
+	case <-timeout:
+		s.mu.Lock()
+		if run.Err == nil {
+			run.Err = ErrMaxRuntime
+		}
+		s.mu.Unlock()
+
+		p.StopTimeout(j.opts.StopTimeout)
+		exitStatus = <-exited
+	}
+
+	stdout, stderr := p.Stdout(), p.Stderr()
+	p.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	run.Finished = time.Now()
+	run.ExitStatus = exitStatus
+	run.Stdout, run.Stderr = stdout, stderr
+	s.finishLocked(j, *run)
+}
+
+// finishLocked records the run that has just finished
+// and starts the next queued one
+func (s *Scheduler) finishLocked(j *schedJob, run Run) {
+	j.record(run)
+	j.current, j.currentRun = nil, nil
+
+	select {
+	case <-j.stop:
+		return
+	default:
+	}
+
+	if len(j.queue) > 0 {
+		scheduled := j.queue[0]
+		j.queue = j.queue[1:]
+		s.launchLocked(j, scheduled)
+	}
+}
+
+func (j *schedJob) record(run Run) {
+	j.history = append(j.history, run)
+	if len(j.history) > j.opts.History {
+		j.history = j.history[len(j.history)-j.opts.History:]
+	}
+}
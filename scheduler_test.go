@@ -0,0 +1,121 @@
+package process
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	at := func(s string) time.Time {
+		t, err := time.Parse("2006-01-02 15:04:05", s)
+		if err != nil {
+			panic(err)
+		}
+		return t
+	}
+
+	tests := []struct {
+		expr string
+		from string
+		want string
+	}{
+		{"*/15 * * * *", "2024-06-01 10:07:30", "2024-06-01 10:15:00"},
+		{"0 * * * *", "2024-06-01 10:00:00", "2024-06-01 11:00:00"},
+		{"@hourly", "2024-06-01 10:59:30", "2024-06-01 11:00:00"},
+		{"@daily", "2024-12-31 23:59:00", "2025-01-01 00:00:00"},
+		{"0 9 * * MON-FRI", "2024-06-01 12:00:00", "2024-06-03 09:00:00"},
+		{"30 2 * * 7", "2024-06-01 12:00:00", "2024-06-02 02:30:00"},
+		{"5 4 * jan,jul *", "2024-06-01 00:00:00", "2024-07-01 04:05:00"},
+		{"0 0 1-10/3 * *", "2024-06-02 00:00:00", "2024-06-04 00:00:00"},
+		// with both day fields restricted, either one matches
+		{"0 12 13 * FRI", "2024-09-01 00:00:00", "2024-09-06 12:00:00"},
+		{"0 12 13 * FRI", "2024-09-07 00:00:00", "2024-09-13 12:00:00"},
+		{"0 0 29 2 *", "2024-03-01 00:00:00", "2028-02-29 00:00:00"},
+		{"@every 90s", "2024-06-01 10:00:10", "2024-06-01 10:01:40"},
+		{"0 0 31 2 *", "2024-01-01 00:00:00", ""},
+	}
+
+	for _, tt := range tests {
+		sched, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Errorf("ParseCron(%q): %v", tt.expr, err)
+			continue
+		}
+
+		got := sched.Next(at(tt.from))
+		if tt.want == "" {
+			if !got.IsZero() {
+				t.Errorf("%q after %s = %v, want never", tt.expr, tt.from, got)
+			}
+		} else if !got.Equal(at(tt.want)) {
+			t.Errorf("%q after %s = %v, want %s", tt.expr, tt.from, got, tt.want)
+		}
+	}
+
+	for _, expr := range []string{
+		"* * * *", "60 * * * *", "*/0 * * * *", "5-1 * * * *",
+		"* * * FOO *", "* * 0 * *", "@every -1s", "@every soon",
+	} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("ParseCron(%q) succeeded", expr)
+		}
+	}
+}
+
+func TestSchedulerStartOutsideLock(t *testing.T) {
+	p, err := NewProcess("", os.Args[0], "-test.run=^TestHelperStdin$")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	entered, release := make(chan struct{}), make(chan struct{})
+	p.AddHook(HookPreStart, func(ctx context.Context, p *Process) error {
+		close(entered)
+		<-release
+		return nil
+	}, HookOptions{})
+
+	// the child reads its standard input until EOF
+	t.Setenv("PROCESS_HELPER_STDIN", "1")
+
+	s := NewScheduler()
+	if err := s.Add("job", Every(time.Hour), p, JobOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	s.Start()
+	defer s.Stop(time.Second)
+
+	if err := s.RunNow("job"); err != nil {
+		t.Fatal(err)
+	}
+	<-entered
+
+	// the Scheduler must stay usable while a run is starting
+	done := make(chan struct{})
+	go func() {
+		s.History("job")
+		s.RunNow("job")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the Scheduler is locked by a starting run")
+	}
+	close(release)
+
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		history, _ := s.History("job")
+		for _, run := range history {
+			if run.Err == nil && run.ExitStatus.Error() == nil && !run.Finished.IsZero() {
+				return
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatal("the run never finished")
+}
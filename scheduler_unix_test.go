@@ -0,0 +1,115 @@
+//go:build !windows
+
+package process
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// schedule adds a single job running the script and starts the Scheduler
+func schedule(t *testing.T, sched Schedule, script string, opts JobOptions) *Scheduler {
+	t.Helper()
+
+	s := NewScheduler()
+	if err := s.Add("job", sched, newShell(t, script), opts); err != nil {
+		t.Fatal(err)
+	}
+	s.Start()
+	t.Cleanup(func() { s.Stop(time.Second) })
+	return s
+}
+
+// waitRuns waits for the job to have n runs in its history and returns them
+func waitRuns(t *testing.T, s *Scheduler, n int) []Run {
+	t.Helper()
+
+	var history []Run
+	waitFor(t, "the runs of the job", func() bool {
+		history, _ = s.History("job")
+		return len(history) >= n
+	})
+	return history
+}
+
+func TestSchedulerInterval(t *testing.T) {
+	s := schedule(t, Every(50*time.Millisecond), "echo out; echo err >&2", JobOptions{})
+
+	for _, run := range waitRuns(t, s, 2)[:2] {
+		if run.Err != nil || run.ExitStatus.Error() != nil {
+			t.Errorf("run failed: %v, %v", run.Err, run.ExitStatus.Error())
+		}
+		if string(run.Stdout) != "out\n" || string(run.Stderr) != "err\n" {
+			t.Errorf("output = %q, %q", run.Stdout, run.Stderr)
+		}
+		if run.Started.Before(run.Scheduled) || run.Finished.Before(run.Started) {
+			t.Errorf("run times = %v, %v, %v", run.Scheduled, run.Started, run.Finished)
+		}
+	}
+}
+
+func TestSchedulerOverlapSkip(t *testing.T) {
+	s := schedule(t, Every(time.Hour), "sleep 0.3", JobOptions{Overlap: OverlapSkip})
+
+	s.RunNow("job")
+	s.RunNow("job")
+	history := waitRuns(t, s, 2)
+
+	if !errors.Is(history[0].Err, ErrRunSkipped) {
+		t.Errorf("first recorded run = %v, want the skipped one", history[0].Err)
+	}
+	if history[1].Err != nil {
+		t.Errorf("second recorded run = %v, want the first run finished", history[1].Err)
+	}
+}
+
+func TestSchedulerOverlapQueue(t *testing.T) {
+	s := schedule(t, Every(time.Hour), "sleep 0.1", JobOptions{Overlap: OverlapQueue})
+
+	for i := 0; i < 3; i++ {
+		s.RunNow("job")
+	}
+	history := waitRuns(t, s, 3)
+
+	for i, run := range history {
+		if run.Err != nil {
+			t.Errorf("run %d: %v", i, run.Err)
+		}
+		if i > 0 && run.Started.Before(history[i-1].Finished) {
+			t.Errorf("run %d started before the previous one finished", i)
+		}
+	}
+}
+
+func TestSchedulerOverlapReplace(t *testing.T) {
+	s := schedule(t, Every(time.Hour), "exec sleep 10", JobOptions{Overlap: OverlapReplace, StopTimeout: time.Second})
+
+	s.RunNow("job")
+	s.RunNow("job")
+	history := waitRuns(t, s, 1)
+
+	if !errors.Is(history[0].Err, ErrRunReplaced) {
+		t.Errorf("replaced run = %v, want %v", history[0].Err, ErrRunReplaced)
+	}
+
+	s.mu.Lock()
+	running := s.jobs["job"].current != nil
+	s.mu.Unlock()
+	if !running {
+		t.Error("the new run was not started")
+	}
+}
+
+func TestSchedulerMaxRuntime(t *testing.T) {
+	s := schedule(t, Every(time.Hour), "exec sleep 10", JobOptions{MaxRuntime: 100 * time.Millisecond, StopTimeout: time.Second})
+
+	s.RunNow("job")
+	run := waitRuns(t, s, 1)[0]
+	if !errors.Is(run.Err, ErrMaxRuntime) {
+		t.Errorf("run = %v, want %v", run.Err, ErrMaxRuntime)
+	}
+	if d := run.Finished.Sub(run.Started); d > 2*time.Second {
+		t.Errorf("the run lasted %v", d)
+	}
+}
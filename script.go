@@ -0,0 +1,607 @@
+package process
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ScriptOp is the operator that links a Pipeline to the previous one
+type ScriptOp int
+
+const (
+	// OpSeq always runs the pipeline (<;> or the first pipeline)
+	OpSeq ScriptOp = iota
+	// OpAnd runs the pipeline only if the previous one succeeded (<&&>)
+	OpAnd
+	// OpOr runs the pipeline only if the previous one failed (<||>)
+	OpOr
+)
+
+// RedirectMode tells how a Redirect changes a file descriptor
+type RedirectMode int
+
+const (
+	// RedirectIn reads the file descriptor from a file (<<>)
+	RedirectIn RedirectMode = iota
+	// RedirectOut truncates a file and writes into it (<>>)
+	RedirectOut
+	// RedirectAppend appends to a file (<>>>)
+	RedirectAppend
+	// RedirectDup duplicates another file descriptor (<2>&1>)
+	RedirectDup
+)
+
+// Redirect is a single redirection of a ScriptCommand
+type Redirect struct {
+	FD     int
+	Mode   RedirectMode
+	Target string
+	DupFD  int
+}
+
+// ScriptCommand is a simple command of a Pipeline: a list of
+// variable assignments, the command words and its redirections.
+// Assignments, words and redirect targets are kept as written and
+// are expanded only when the command is executed
+type ScriptCommand struct {
+	Assign    []string
+	Words     []string
+	Redirects []Redirect
+}
+
+// Pipeline is a list of commands whose standard output is connected to
+// the standard input of the next one
+type Pipeline struct {
+	Op       ScriptOp
+	Commands []*ScriptCommand
+}
+
+// Script is a command line parsed by ParseScript. It is executed natively,
+// without invoking a shell, so the same command strings can be used on
+// every operating system.
+//
+// Supported syntax:
+//   - the quoting and $VAR expansion rules of SplitCommand
+//   - VAR=value prefixes, which only apply to that command, or standalone
+//     assignments, which apply to every following command
+//   - the builtin cd, which changes the working directory of the following commands
+//   - the redirections <, >, >>, 2>, 2>>, 2>&1 and 1>&2
+//   - pipelines with |
+//   - lists with &&, || and ;
+//
+// Expansions result in a single word, no field splitting or globbing is done
+type Script struct {
+	// Dir is the initial working directory, the parent one if empty
+	Dir string
+	// Env is the initial environment, the parent one if nil
+	Env       []string
+	Pipelines []*Pipeline
+}
+
+type scriptToken struct {
+	op  string
+	raw string
+}
+
+var scriptOperators = []string{
+	"2>&1", "1>&2", "2>>", "1>>", "2>", "1>", ">>", "&&", "||", ">", "<", "|", ";",
+}
+
+// ParseScript parses a command line written in the mini command
+// language described by Script
+func ParseScript(line string) (*Script, error) {
+	tokens, err := scanScript(line)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Script{}
+	pl := &Pipeline{Op: OpSeq}
+	cmd := &ScriptCommand{}
+
+	endCommand := func(op string) error {
+		if len(cmd.Assign) == 0 && len(cmd.Words) == 0 {
+			if len(cmd.Redirects) > 0 || op == "|" || len(pl.Commands) > 0 {
+				return scriptSyntaxError(op)
+			}
+			return nil
+		}
+		pl.Commands = append(pl.Commands, cmd)
+		cmd = &ScriptCommand{}
+		return nil
+	}
+
+	endPipeline := func(op string) error {
+		if err := endCommand(op); err != nil {
+			return err
+		}
+		if len(pl.Commands) == 0 {
+			if op == "&&" || op == "||" || pl.Op != OpSeq {
+				return scriptSyntaxError(op)
+			}
+			return nil
+		}
+		s.Pipelines = append(s.Pipelines, pl)
+		pl = &Pipeline{}
+		return nil
+	}
+
+	for i := 0; i < len(tokens); i++ {
+		tk := tokens[i]
+		switch tk.op {
+		case "":
+			if len(cmd.Words) == 0 && isAssignment(tk.raw) {
+				cmd.Assign = append(cmd.Assign, tk.raw)
+			} else {
+				cmd.Words = append(cmd.Words, tk.raw)
+			}
+		case "2>&1":
+			cmd.Redirects = append(cmd.Redirects, Redirect{FD: 2, Mode: RedirectDup, DupFD: 1})
+		case "1>&2":
+			cmd.Redirects = append(cmd.Redirects, Redirect{FD: 1, Mode: RedirectDup, DupFD: 2})
+		case "<", ">", ">>", "1>", "1>>", "2>", "2>>":
+			if i+1 >= len(tokens) || tokens[i+1].op != "" {
+				return nil, fmt.Errorf("syntax error: missing file name after <%s>", tk.op)
+			}
+			i++
+			cmd.Redirects = append(cmd.Redirects, newRedirect(tk.op, tokens[i].raw))
+		case "|":
+			if err := endCommand(tk.op); err != nil {
+				return nil, err
+			}
+		case "&&", "||", ";":
+			if err := endPipeline(tk.op); err != nil {
+				return nil, err
+			}
+			switch tk.op {
+			case "&&":
+				pl.Op = OpAnd
+			case "||":
+				pl.Op = OpOr
+			}
+		}
+	}
+
+	if err := endPipeline(""); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func scriptSyntaxError(op string) error {
+	if op == "" {
+		return errors.New("syntax error: unexpected end of command")
+	}
+	return fmt.Errorf("syntax error near <%s>", op)
+}
+
+func scanScript(line string) ([]scriptToken, error) {
+	lx := &lexer{input: line, operators: true}
+	tokens := make([]scriptToken, 0)
+
+	for {
+		lx.skipBlanks()
+		if lx.eof() {
+			return tokens, nil
+		}
+
+		rest := lx.input[lx.pos:]
+		op := ""
+		for _, o := range scriptOperators {
+			if strings.HasPrefix(rest, o) {
+				op = o
+				break
+			}
+		}
+
+		if op != "" {
+			tokens = append(tokens, scriptToken{op: op})
+			lx.pos += len(op)
+			continue
+		}
+
+		if isOperatorChar(rest[0]) {
+			return nil, fmt.Errorf("unsupported operator <%c> at offset %d", rest[0], lx.pos)
+		}
+
+		start := lx.pos
+		_, err := lx.word()
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, scriptToken{raw: lx.input[start:lx.pos]})
+	}
+}
+
+// isAssignment reports whether the raw word has the form NAME=...
+// with an unquoted name
+func isAssignment(raw string) bool {
+	name, _, ok := strings.Cut(raw, "=")
+	if !ok || name == "" {
+		return false
+	}
+
+	for i := 0; i < len(name); i++ {
+		if !isNameChar(name[i], i == 0) {
+			return false
+		}
+	}
+	return true
+}
+
+func newRedirect(op string, target string) Redirect {
+	r := Redirect{FD: 1, Target: target}
+	if strings.HasPrefix(op, "2") {
+		r.FD = 2
+	}
+
+	switch strings.TrimLeft(op, "12") {
+	case "<":
+		r.FD = 0
+		r.Mode = RedirectIn
+	case ">":
+		r.Mode = RedirectOut
+	case ">>":
+		r.Mode = RedirectAppend
+	}
+	return r
+}
+
+// expandWord expands a raw word with the given environment
+func expandWord(raw string, env []string) (string, error) {
+	lx := &lexer{input: raw, lookup: envLookup(env)}
+	return lx.word()
+}
+
+// scriptState is the working directory and environment that
+// evolve while a Script is running
+type scriptState struct {
+	wd  string
+	env []string
+}
+
+// Process builds the Process for the command, expanding its words with
+// the given environment. The returned Process inherits env plus the
+// command assignments, and its executable is looked up in the PATH of
+// that environment. The cd builtin and standalone assignments do
+// not produce a Process and are handled by Script.Run
+func (c *ScriptCommand) Process(wd string, env []string) (*Process, error) {
+	if len(c.Words) == 0 {
+		return nil, errors.New("command without executable")
+	}
+
+	words := make([]string, 0, len(c.Words))
+	for _, raw := range c.Words {
+		w, err := expandWord(raw, env)
+		if err != nil {
+			return nil, err
+		}
+		words = append(words, w)
+	}
+
+	procEnv := append([]string{}, env...)
+	for _, raw := range c.Assign {
+		a, err := expandWord(raw, env)
+		if err != nil {
+			return nil, err
+		}
+		procEnv = append(procEnv, a)
+	}
+
+	execPath := words[0]
+	if filepath.Base(execPath) != execPath && !filepath.IsAbs(execPath) {
+		execPath = filepath.Join(wd, execPath)
+	} else if filepath.Base(execPath) == execPath {
+		lp, err := lookPathEnv(execPath, wd, procEnv)
+		if err != nil {
+			return nil, err
+		}
+		execPath = lp
+	}
+
+	p, err := NewProcess(wd, execPath, words[1:]...)
+	if err != nil {
+		return nil, err
+	}
+	p.ExecName = words[0]
+	p.Env = procEnv
+	p.InheritConsole(true)
+
+	return p, nil
+}
+
+// lookPathEnv searches the executable in the directories of the PATH
+// defined in env, relative ones being relative to wd. Without a PATH
+// in env, the one of the parent is used
+func lookPathEnv(file string, wd string, env []string) (string, error) {
+	path, ok := envLookup(env)("PATH")
+	if !ok {
+		return exec.LookPath(file)
+	}
+
+	for _, dir := range filepath.SplitList(path) {
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(wd, dir)
+		}
+		if lp, err := exec.LookPath(filepath.Join(dir, file)); err == nil {
+			return lp, nil
+		}
+	}
+	return "", &exec.Error{Name: file, Err: exec.ErrNotFound}
+}
+
+// Run executes the Script and returns the ExitStatus of the last
+// executed pipeline, which is the one of its last command. Commands that
+// can't be started report the exit code 127, like a shell does.
+// If stdin is nil, the commands read from the null device
+func (s *Script) Run(stdin io.Reader, stdout, stderr io.Writer) (exitStatus ExitStatus, err error) {
+	state := &scriptState{wd: s.Dir, env: s.Env}
+	if state.wd == "" {
+		state.wd, err = os.Getwd()
+		if err != nil {
+			return
+		}
+	}
+	if state.env == nil {
+		state.env = os.Environ()
+	}
+	if stdin == nil {
+		stdin = DevNull()
+	}
+
+	for i, pl := range s.Pipelines {
+		if i > 0 {
+			ok := exitStatus.ExitCode == 0
+			if (pl.Op == OpAnd && !ok) || (pl.Op == OpOr && ok) {
+				continue
+			}
+		}
+
+		exitStatus = s.runPipeline(state, pl, stdin, stdout, stderr)
+	}
+
+	err = exitStatus.Error()
+	return
+}
+
+// RunScript parses and runs a command line in the given working directory
+// with the parent environment. See Script for the supported syntax
+func RunScript(wd string, line string, stdin io.Reader, stdout, stderr io.Writer) (ExitStatus, error) {
+	s, err := ParseScript(line)
+	if err != nil {
+		return ExitStatus{}, err
+	}
+
+	s.Dir = wd
+	return s.Run(stdin, stdout, stderr)
+}
+
+func builtinStatus(err error) ExitStatus {
+	if err == nil {
+		return ExitStatus{PID: -1}
+	}
+	return ExitStatus{PID: -1, ExitCode: 1, ExitError: err}
+}
+
+func startErrorStatus(err error) ExitStatus {
+	return ExitStatus{PID: -1, ExitCode: 127, ExitError: err}
+}
+
+// runBuiltin handles the commands that change the Script state
+// instead of spawning a Process
+func (state *scriptState) runBuiltin(cmd *ScriptCommand) (ExitStatus, bool) {
+	if len(cmd.Words) == 0 {
+		for _, raw := range cmd.Assign {
+			a, err := expandWord(raw, state.env)
+			if err != nil {
+				return builtinStatus(err), true
+			}
+			state.env = append(state.env, a)
+		}
+		return builtinStatus(nil), true
+	}
+
+	if cmd.Words[0] != "cd" {
+		return ExitStatus{}, false
+	}
+
+	if len(cmd.Words) != 2 {
+		return builtinStatus(errors.New("cd: expected exactly one directory")), true
+	}
+
+	dir, err := expandWord(cmd.Words[1], state.env)
+	if err != nil {
+		return builtinStatus(err), true
+	}
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(state.wd, dir)
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return builtinStatus(fmt.Errorf("cd: %w", err)), true
+	}
+	if !info.IsDir() {
+		return builtinStatus(fmt.Errorf("cd: \"%s\" is not a directory", dir)), true
+	}
+
+	state.wd = dir
+	return builtinStatus(nil), true
+}
+
+// brokenPipeWriter writes into the pipe connected to the next command
+// of a pipeline and kills the producer once the consumer has gone away,
+// emulating the SIGPIPE behaviour of a shell
+type brokenPipeWriter struct {
+	w    *io.PipeWriter
+	p    *Process
+	once sync.Once
+}
+
+func (bw *brokenPipeWriter) Write(b []byte) (int, error) {
+	n, err := bw.w.Write(b)
+	if err != nil {
+		bw.once.Do(func() { bw.p.Kill() })
+	}
+	return n, err
+}
+
+type scriptStdio struct {
+	in     io.Reader
+	out    io.Writer
+	err    io.Writer
+	closer []io.Closer
+}
+
+func (stdio *scriptStdio) close() {
+	for _, c := range stdio.closer {
+		c.Close()
+	}
+}
+
+// applyRedirects changes the standard streams following the command
+// redirections, in the order they were written
+func (stdio *scriptStdio) applyRedirects(state *scriptState, redirects []Redirect) error {
+	for _, r := range redirects {
+		if r.Mode == RedirectDup {
+			var w io.Writer
+			switch r.DupFD {
+			case 1:
+				w = stdio.out
+			case 2:
+				w = stdio.err
+			}
+			if r.FD == 1 {
+				stdio.out = w
+			} else {
+				stdio.err = w
+			}
+			continue
+		}
+
+		name, err := expandWord(r.Target, state.env)
+		if err != nil {
+			return err
+		}
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(state.wd, name)
+		}
+
+		var f *os.File
+		switch r.Mode {
+		case RedirectIn:
+			f, err = os.Open(name)
+		case RedirectOut:
+			f, err = os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+		case RedirectAppend:
+			f, err = os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+		}
+		if err != nil {
+			return err
+		}
+		stdio.closer = append(stdio.closer, f)
+
+		switch r.FD {
+		case 0:
+			stdio.in = f
+		case 1:
+			stdio.out = f
+		case 2:
+			stdio.err = f
+		}
+	}
+
+	return nil
+}
+
+func (s *Script) runPipeline(state *scriptState, pl *Pipeline, stdin io.Reader, stdout, stderr io.Writer) ExitStatus {
+	if len(pl.Commands) == 1 {
+		if exitStatus, ok := state.runBuiltin(pl.Commands[0]); ok {
+			return exitStatus
+		}
+	}
+
+	type stage struct {
+		p      *Process
+		stdio  *scriptStdio
+		pipeR  *io.PipeReader
+		pipeW  *io.PipeWriter
+		status ExitStatus
+		err    error
+	}
+
+	stages := make([]*stage, len(pl.Commands))
+	var prevR *io.PipeReader
+
+	for i, cmd := range pl.Commands {
+		st := &stage{stdio: &scriptStdio{in: stdin, out: stdout, err: stderr}}
+		stages[i] = st
+
+		if prevR != nil {
+			st.stdio.in = prevR
+			st.pipeR = prevR
+			prevR = nil
+		}
+
+		st.p, st.err = cmd.Process(state.wd, state.env)
+
+		if i < len(pl.Commands)-1 {
+			prevR, st.pipeW = io.Pipe()
+			if st.p != nil {
+				st.stdio.out = &brokenPipeWriter{w: st.pipeW, p: st.p}
+			} else {
+				st.stdio.out = st.pipeW
+			}
+		}
+
+		if st.err == nil {
+			st.err = st.stdio.applyRedirects(state, cmd.Redirects)
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, st := range stages {
+		if st.err == nil {
+			st.err = st.p.Start(st.stdio.in, st.stdio.out, st.stdio.err)
+		}
+
+		if st.err != nil {
+			st.status = startErrorStatus(st.err)
+			if st.stdio.err != nil {
+				fmt.Fprintln(st.stdio.err, st.err)
+			}
+			st.stdio.close()
+			if st.pipeW != nil {
+				st.pipeW.Close()
+			}
+			if st.pipeR != nil {
+				st.pipeR.Close()
+			}
+			continue
+		}
+
+		wg.Add(1)
+		go func(st *stage) {
+			defer wg.Done()
+
+			st.status = st.p.Wait()
+			st.stdio.close()
+			if st.pipeW != nil {
+				st.pipeW.Close()
+			}
+			if st.pipeR != nil {
+				st.pipeR.CloseWithError(io.ErrClosedPipe)
+			}
+		}(st)
+	}
+
+	wg.Wait()
+	return stages[len(stages)-1].status
+}
@@ -0,0 +1,78 @@
+package process
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseScript(t *testing.T) {
+	s, err := ParseScript(`A=1 cmd "x y" <in 2>&1 | grep -v z >> out; cd dir && B=2 || last 2>err`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(s.Pipelines) != 4 {
+		t.Fatalf("pipelines = %d, want 4", len(s.Pipelines))
+	}
+	for i, op := range []ScriptOp{OpSeq, OpSeq, OpAnd, OpOr} {
+		if s.Pipelines[i].Op != op {
+			t.Errorf("pipeline %d op = %d, want %d", i, s.Pipelines[i].Op, op)
+		}
+	}
+
+	first := s.Pipelines[0].Commands
+	if len(first) != 2 {
+		t.Fatalf("commands of the first pipeline = %d, want 2", len(first))
+	}
+	if !slices.Equal(first[0].Assign, []string{"A=1"}) || !slices.Equal(first[0].Words, []string{"cmd", `"x y"`}) {
+		t.Errorf("first command = %q %q", first[0].Assign, first[0].Words)
+	}
+	wantRedirects := []Redirect{
+		{FD: 0, Mode: RedirectIn, Target: "in"},
+		{FD: 2, Mode: RedirectDup, DupFD: 1},
+	}
+	if !slices.Equal(first[0].Redirects, wantRedirects) {
+		t.Errorf("first command redirects = %+v, want %+v", first[0].Redirects, wantRedirects)
+	}
+	if r := first[1].Redirects; len(r) != 1 || r[0] != (Redirect{FD: 1, Mode: RedirectAppend, Target: "out"}) {
+		t.Errorf("second command redirects = %+v", r)
+	}
+
+	if c := s.Pipelines[2].Commands[0]; len(c.Words) != 0 || !slices.Equal(c.Assign, []string{"B=2"}) {
+		t.Errorf("standalone assignment = %q %q", c.Assign, c.Words)
+	}
+	if r := s.Pipelines[3].Commands[0].Redirects; len(r) != 1 || r[0] != (Redirect{FD: 2, Mode: RedirectOut, Target: "err"}) {
+		t.Errorf("last command redirects = %+v", r)
+	}
+}
+
+func TestParseScriptErrors(t *testing.T) {
+	for _, line := range []string{
+		"| a", "a |", "a &&", "&& a", "a >", "a > | b", "a & b", `a "open`,
+	} {
+		if _, err := ParseScript(line); err == nil {
+			t.Errorf("ParseScript(%q): expected an error", line)
+		}
+	}
+
+	// an empty line and a trailing separator are accepted
+	for _, line := range []string{"", "  ", "a ;"} {
+		if _, err := ParseScript(line); err != nil {
+			t.Errorf("ParseScript(%q): %v", line, err)
+		}
+	}
+}
+
+func TestScriptCommandPath(t *testing.T) {
+	s, err := ParseScript(`cmd`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := s.Pipelines[0].Commands[0]
+
+	env := []string{"PATH=" + t.TempDir()}
+	if _, err := cmd.Process(t.TempDir(), env); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("Process without cmd in PATH = %v, want a not found error", err)
+	}
+}
@@ -0,0 +1,84 @@
+//go:build !windows
+
+package process
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func runScript(t *testing.T, s *Script) string {
+	t.Helper()
+
+	var out, errOut bytes.Buffer
+	if _, err := s.Run(nil, &out, &errOut); err != nil {
+		t.Fatalf("Run: %v\n%s", err, errOut.String())
+	}
+	return out.String()
+}
+
+func TestScriptEnv(t *testing.T) {
+	s, err := ParseScript(`A=global; A=local B=$A sh -c 'echo $A $B'; sh -c 'echo $A'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Env = append(os.Environ(), "A=initial")
+
+	if got, want := runScript(t, s), "local global\nglobal\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+}
+
+func TestScriptPathLookup(t *testing.T) {
+	bin := t.TempDir()
+	exe := filepath.Join(bin, "script-hello")
+	if err := os.WriteFile(exe, []byte("#!/bin/sh\necho hello from $0\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// the PATH of the script is used, not the one of the parent
+	for _, line := range []string{
+		"PATH=" + bin + " script-hello",
+		"PATH=" + bin + "; script-hello",
+	} {
+		s, err := ParseScript(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := runScript(t, s), "hello from "+exe+"\n"; got != want {
+			t.Errorf("%s: output = %q, want %q", line, got, want)
+		}
+	}
+
+	s, err := ParseScript("script-hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exitStatus, err := s.Run(nil, nil, nil)
+	if err == nil || exitStatus.ExitCode != 127 {
+		t.Errorf("Run without the PATH = %v, code %d, want a start error with code 127", err, exitStatus.ExitCode)
+	}
+}
+
+func TestScriptWorkingDirectory(t *testing.T) {
+	root := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := ParseScript(`echo one > first; cd sub && pwd > second && ./../sub/../first-missing || cat ../first`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Dir = root
+
+	sub := filepath.Join(root, "sub")
+	if got, want := runScript(t, s), "one\n"; got != want {
+		t.Errorf("output = %q, want %q", got, want)
+	}
+	if data, err := os.ReadFile(filepath.Join(sub, "second")); err != nil || string(data) != sub+"\n" {
+		t.Errorf("second = %q, %v, want %q", data, err, sub+"\n")
+	}
+}
@@ -0,0 +1,290 @@
+package process
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrUnterminatedQuote is returned by SplitCommand when a single or double
+// quote is opened but never closed
+var ErrUnterminatedQuote = errors.New("unterminated quote")
+
+// ErrTrailingBackslash is returned by SplitCommand when the command ends
+// with an escape character with nothing to escape
+var ErrTrailingBackslash = errors.New("trailing backslash")
+
+// SplitCommand splits a command line into words following the POSIX shell
+// quoting rules:
+//   - words are separated by unquoted spaces, tabs and newlines
+//   - quotes can be adjacent to other text, so --name="foo bar" is a single word
+//   - inside single quotes every character is literal
+//   - inside double quotes a backslash only escapes <$>, <">, <\>, <`> and newlines
+//   - outside quotes a backslash escapes any character
+//   - $VAR and ${VAR} are expanded outside single quotes
+//
+// Variables are looked up in env, which has the same "KEY=value" form
+// of Process.Env; undefined variables expand to an empty string. If env is
+// nil, no expansion is made and the $ character is kept as is
+func SplitCommand(s string, env []string) ([]string, error) {
+	var lookup func(string) (string, bool)
+	if env != nil {
+		lookup = envLookup(env)
+	}
+
+	lx := &lexer{input: s, lookup: lookup}
+	return lx.words()
+}
+
+// envLookup returns a function that looks up a variable in env,
+// with the last definition winning like os/exec does
+func envLookup(env []string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		for i := len(env) - 1; i >= 0; i-- {
+			key, value, ok := strings.Cut(env[i], "=")
+			if ok && key == name {
+				return value, true
+			}
+		}
+		return "", false
+	}
+}
+
+// lexer is the scanner behind SplitCommand and the command parsers of the
+// package. When lenient is set, unterminated quotes and trailing
+// backslashes are accepted and closed at the end of the input. When
+// operators is set, the unquoted characters <|>, <&>, <;>, <<> and <>>
+// end the current word
+type lexer struct {
+	input     string
+	pos       int
+	lookup    func(string) (string, bool)
+	lenient   bool
+	operators bool
+}
+
+func (lx *lexer) eof() bool {
+	return lx.pos >= len(lx.input)
+}
+
+func (lx *lexer) peek() byte {
+	return lx.input[lx.pos]
+}
+
+func isBlank(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+func (lx *lexer) skipBlanks() {
+	for !lx.eof() && isBlank(lx.peek()) {
+		lx.pos++
+	}
+}
+
+func (lx *lexer) words() ([]string, error) {
+	words := make([]string, 0)
+	for {
+		lx.skipBlanks()
+		if lx.eof() {
+			return words, nil
+		}
+
+		word, err := lx.word()
+		if err != nil {
+			return words, err
+		}
+		words = append(words, word)
+	}
+}
+
+// word scans a single word starting at the current position, which must
+// not be a blank character
+func (lx *lexer) word() (string, error) {
+	var sb strings.Builder
+
+	for !lx.eof() {
+		c := lx.peek()
+		switch {
+		case isBlank(c), lx.operators && isOperatorChar(c):
+			return sb.String(), nil
+		case c == '\\':
+			lx.pos++
+			if lx.eof() {
+				if lx.lenient {
+					return sb.String(), nil
+				}
+				return sb.String(), ErrTrailingBackslash
+			}
+			if lx.peek() != '\n' {
+				sb.WriteByte(lx.peek())
+			}
+			lx.pos++
+		case c == '\'':
+			if err := lx.singleQuoted(&sb); err != nil {
+				return sb.String(), err
+			}
+		case c == '"':
+			if err := lx.doubleQuoted(&sb); err != nil {
+				return sb.String(), err
+			}
+		case c == '$' && lx.lookup != nil:
+			lx.variable(&sb)
+		default:
+			sb.WriteByte(c)
+			lx.pos++
+		}
+	}
+
+	return sb.String(), nil
+}
+
+func (lx *lexer) singleQuoted(sb *strings.Builder) error {
+	start := lx.pos
+	lx.pos++
+
+	end := strings.IndexByte(lx.input[lx.pos:], '\'')
+	if end < 0 {
+		if !lx.lenient {
+			return fmt.Errorf("%w: <'> at offset %d", ErrUnterminatedQuote, start)
+		}
+		end = len(lx.input) - lx.pos
+		sb.WriteString(lx.input[lx.pos:])
+		lx.pos += end
+		return nil
+	}
+
+	sb.WriteString(lx.input[lx.pos : lx.pos+end])
+	lx.pos += end + 1
+	return nil
+}
+
+func (lx *lexer) doubleQuoted(sb *strings.Builder) error {
+	start := lx.pos
+	lx.pos++
+
+	for !lx.eof() {
+		c := lx.peek()
+		switch {
+		case c == '"':
+			lx.pos++
+			return nil
+		case c == '\\' && lx.pos+1 < len(lx.input):
+			next := lx.input[lx.pos+1]
+			switch next {
+			case '$', '"', '\\', '`':
+				sb.WriteByte(next)
+			case '\n':
+			default:
+				sb.WriteByte(c)
+				sb.WriteByte(next)
+			}
+			lx.pos += 2
+		case c == '$' && lx.lookup != nil:
+			lx.variable(sb)
+		default:
+			sb.WriteByte(c)
+			lx.pos++
+		}
+	}
+
+	if lx.lenient {
+		return nil
+	}
+	return fmt.Errorf("%w: <\"> at offset %d", ErrUnterminatedQuote, start)
+}
+
+// variable expands a $VAR or ${VAR} reference. A $ not followed by a
+// valid name is kept literally
+func (lx *lexer) variable(sb *strings.Builder) {
+	lx.pos++
+
+	if !lx.eof() && lx.peek() == '{' {
+		end := strings.IndexByte(lx.input[lx.pos:], '}')
+		if end < 0 {
+			sb.WriteString("${")
+			lx.pos++
+			return
+		}
+
+		name := lx.input[lx.pos+1 : lx.pos+end]
+		value, _ := lx.lookup(name)
+		sb.WriteString(value)
+		lx.pos += end + 1
+		return
+	}
+
+	start := lx.pos
+	for !lx.eof() && isNameChar(lx.peek(), lx.pos == start) {
+		lx.pos++
+	}
+
+	if lx.pos == start {
+		sb.WriteByte('$')
+		return
+	}
+
+	value, _ := lx.lookup(lx.input[start:lx.pos])
+	sb.WriteString(value)
+}
+
+func isOperatorChar(c byte) bool {
+	return strings.IndexByte("|&;<>", c) >= 0
+}
+
+func isNameChar(c byte, first bool) bool {
+	switch {
+	case c == '_', c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z':
+		return true
+	case c >= '0' && c <= '9':
+		return !first
+	default:
+		return false
+	}
+}
+
+// QuoteArg quotes a single argument so that SplitCommand returns it
+// unchanged, regardless of the environment provided. Arguments made only
+// of safe characters are returned as they are
+func QuoteArg(arg string) string {
+	if arg == "" {
+		return "''"
+	}
+
+	safe := true
+	for i := 0; i < len(arg); i++ {
+		if !isSafeChar(arg[i]) {
+			safe = false
+			break
+		}
+	}
+	if safe {
+		return arg
+	}
+
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
+
+func isSafeChar(c byte) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		return true
+	default:
+		return strings.IndexByte("-_./:,+=@%", c) >= 0
+	}
+}
+
+// QuoteArgs quotes every argument with QuoteArg
+func QuoteArgs(args ...string) []string {
+	quoted := make([]string, 0, len(args))
+	for _, arg := range args {
+		quoted = append(quoted, QuoteArg(arg))
+	}
+	return quoted
+}
+
+// JoinArgs builds a single command line from the arguments, quoting them
+// when needed. The result can be split back into the same arguments with
+// SplitCommand
+func JoinArgs(args ...string) string {
+	return strings.Join(QuoteArgs(args...), " ")
+}
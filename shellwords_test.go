@@ -0,0 +1,154 @@
+package process
+
+import (
+	"errors"
+	"os"
+	"slices"
+	"testing"
+)
+
+func TestSplitCommand(t *testing.T) {
+	env := []string{"NAME=world", "EMPTY="}
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{`echo hello`, []string{"echo", "hello"}},
+		{`  a   b  `, []string{"a", "b"}},
+		{`--name="foo bar"`, []string{"--name=foo bar"}},
+		{`'a $NAME' "b $NAME"`, []string{"a $NAME", "b world"}},
+		{`a\ b \$NAME`, []string{"a b", "$NAME"}},
+		{`"a \"q\" \\ \x"`, []string{`a "q" \ \x`}},
+		{`${NAME}s $EMPTY. $UNDEFINED`, []string{"worlds", ".", ""}},
+		{`'' ""`, []string{"", ""}},
+	}
+
+	for _, tt := range tests {
+		got, err := SplitCommand(tt.in, env)
+		if err != nil {
+			t.Errorf("SplitCommand(%q): %v", tt.in, err)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("SplitCommand(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestSplitCommandErrors(t *testing.T) {
+	for in, want := range map[string]error{
+		`echo 'open`: ErrUnterminatedQuote,
+		`echo "open`: ErrUnterminatedQuote,
+		`echo \`:     ErrTrailingBackslash,
+	} {
+		if _, err := SplitCommand(in, nil); !errors.Is(err, want) {
+			t.Errorf("SplitCommand(%q) error = %v, want %v", in, err, want)
+		}
+	}
+}
+
+func TestQuoteArgRoundTrip(t *testing.T) {
+	args := []string{
+		"", "plain", "with space", "it's", `"double"`, `back\slash`,
+		"$HOME", "${HOME}", "tab\there", "new\nline", "*?[]", "a;b|c&d",
+		`C:\Program Files\x.exe`, "-flag=value", "ünïcödé",
+	}
+	env := []string{"HOME=/home/user"}
+
+	for _, arg := range args {
+		got, err := SplitCommand(QuoteArg(arg), env)
+		if err != nil {
+			t.Errorf("SplitCommand(QuoteArg(%q)): %v", arg, err)
+			continue
+		}
+		if len(got) != 1 || got[0] != arg {
+			t.Errorf("SplitCommand(QuoteArg(%q)) = %q", arg, got)
+		}
+	}
+
+	got, err := SplitCommand(JoinArgs(args...), env)
+	if err != nil {
+		t.Fatalf("SplitCommand(JoinArgs(...)): %v", err)
+	}
+	if !slices.Equal(got, args) {
+		t.Errorf("SplitCommand(JoinArgs(...)) = %q, want %q", got, args)
+	}
+}
+
+func TestParseCommandArgs(t *testing.T) {
+	tests := []struct {
+		in   []string
+		want []string
+	}{
+		{[]string{`a\ b \"q\" \$HOME`}, []string{"a b", `"q"`, "$HOME"}},
+		{[]string{`'C:\tools\x.exe' "C:\Program Files\app"`}, []string{`C:\tools\x.exe`, `C:\Program Files\app`}},
+		{[]string{`--name="foo bar`, `end\`}, []string{"--name=foo bar", "end"}},
+		{[]string{"", "  "}, []string{}},
+	}
+
+	for _, tt := range tests {
+		if got := ParseCommandArgs(tt.in...); !slices.Equal(got, tt.want) {
+			t.Errorf("ParseCommandArgs(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestFastCommandParse(t *testing.T) {
+	t.Setenv("FAST_DIR", "/srv")
+
+	tests := []struct {
+		in       []string
+		wd, exec string
+		args     []string
+	}{
+		{[]string{`cd $FAST_DIR && ls "-l`}, "/srv", "ls", []string{"-l"}},
+		{[]string{`echo a\ b`, "'c d'"}, "", "echo", []string{"a b", "c d"}},
+		{[]string{}, "", "", nil},
+		{[]string{"  "}, "", "", nil},
+		{[]string{`\`}, "", "", nil},
+	}
+
+	for _, tt := range tests {
+		wd, exec, args := FastCommandParse(tt.in...)
+		if wd != tt.wd || exec != tt.exec || !slices.Equal(args, tt.args) {
+			t.Errorf("FastCommandParse(%q) = %q, %q, %q, want %q, %q, %q",
+				tt.in, wd, exec, args, tt.wd, tt.exec, tt.args)
+		}
+	}
+}
+
+func TestParseCommandCdPrefix(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		in       string
+		wd, exec string
+		args     []string
+	}{
+		{`cd /tmp && ls -l`, "/tmp", "ls", []string{"-l"}},
+		{`cd "/my dir"&& ls`, "/my dir", "ls", []string{}},
+		{`cd /tmp "&&" ls`, cwd, "cd", []string{"/tmp", "&&", "ls"}},
+		{`"cd" /tmp && ls`, cwd, "cd", []string{"/tmp", "&&", "ls"}},
+		{`cd /tmp &&& ls`, cwd, "cd", []string{"/tmp", "&&&", "ls"}},
+		{`ls cd`, cwd, "ls", []string{"cd"}},
+	}
+
+	for _, tt := range tests {
+		wd, exec, args, err := ParseCommand(tt.in)
+		if err != nil {
+			t.Errorf("ParseCommand(%q): %v", tt.in, err)
+			continue
+		}
+		if wd != tt.wd || exec != tt.exec || !slices.Equal(args, tt.args) {
+			t.Errorf("ParseCommand(%q) = %q, %q, %q, want %q, %q, %q",
+				tt.in, wd, exec, args, tt.wd, tt.exec, tt.args)
+		}
+	}
+
+	if _, _, _, err := ParseCommand("  "); err == nil {
+		t.Error("ParseCommand of an empty command: expected an error")
+	}
+}
@@ -0,0 +1,245 @@
+package process
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+type sinkMode int
+
+const (
+	sinkBlock sinkMode = iota
+	sinkDrop
+	sinkBuffer
+)
+
+// SinkPolicy decides what happens to the output of a Process when
+// a writer attached with AddStdoutWriter or AddStderrWriter is slower
+// than the child
+type SinkPolicy struct {
+	mode sinkMode
+	size int
+}
+
+var (
+	// BlockSink writes synchronously: a slow writer slows down the
+	// output pipe and therefore the child
+	BlockSink = SinkPolicy{mode: sinkBlock}
+	// DropSink writes asynchronously and discards any chunk produced
+	// while the writer is still busy with the previous one
+	DropSink = SinkPolicy{mode: sinkDrop}
+)
+
+// BufferSink writes asynchronously, queueing up to size bytes while
+// the writer is busy; chunks that don't fit in the queue are discarded
+func BufferSink(size int) SinkPolicy {
+	return SinkPolicy{mode: sinkBuffer, size: size}
+}
+
+// sink is a writer attached at runtime to an output stream
+type sink struct {
+	w      io.Writer
+	policy SinkPolicy
+
+	// removed is read without holding mu, so that a writer stuck in
+	// Write can be removed without waiting for it
+	removed atomic.Bool
+	// wmu serializes the synchronous writes of BlockSink
+	wmu    sync.Mutex
+	mu     sync.Mutex
+	queue  [][]byte
+	queued int
+	busy   bool
+	wake   chan struct{}
+	// idle is signaled when the writing goroutine runs out of chunks
+	idle *sync.Cond
+}
+
+func newSink(w io.Writer, policy SinkPolicy) *sink {
+	s := &sink{w: w, policy: policy}
+	if policy.mode != sinkBlock {
+		s.wake = make(chan struct{}, 1)
+		s.idle = sync.NewCond(&s.mu)
+		go s.loop()
+	}
+	return s
+}
+
+func (s *sink) write(b []byte) {
+	if s.removed.Load() {
+		return
+	}
+
+	if s.policy.mode == sinkBlock {
+		s.wmu.Lock()
+		defer s.wmu.Unlock()
+
+		if !s.removed.Load() {
+			s.w.Write(b)
+		}
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.removed.Load() {
+		return
+	}
+
+	idle := !s.busy && len(s.queue) == 0
+	switch s.policy.mode {
+	case sinkDrop:
+		if !idle {
+			return
+		}
+	case sinkBuffer:
+		if !idle && s.queued+len(b) > s.policy.size {
+			return
+		}
+	}
+
+	s.queue = append(s.queue, append([]byte(nil), b...))
+	s.queued += len(b)
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// loop is the writing goroutine of the asynchronous policies
+func (s *sink) loop() {
+	for range s.wake {
+		for {
+			s.mu.Lock()
+			if s.removed.Load() || len(s.queue) == 0 {
+				s.busy = false
+				s.idle.Broadcast()
+				s.mu.Unlock()
+				break
+			}
+
+			queue := s.queue
+			s.queue, s.queued = nil, 0
+			s.busy = true
+			s.mu.Unlock()
+
+			for _, b := range queue {
+				s.w.Write(b)
+			}
+		}
+	}
+}
+
+// remove detaches the sink without waiting for a write in progress
+func (s *sink) remove() {
+	if s.removed.Swap(true) {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.queue, s.queued = nil, 0
+
+	if s.wake != nil {
+		close(s.wake)
+		s.idle.Broadcast()
+	}
+}
+
+// flush waits until every chunk queued by the asynchronous
+// policies is written, or the sink is removed
+func (s *sink) flush() {
+	if s.wake == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for !s.removed.Load() && (s.busy || len(s.queue) > 0) {
+		s.idle.Wait()
+	}
+}
+
+// sinkSet holds the writers attached to a stream
+type sinkSet struct {
+	mu    sync.RWMutex
+	sinks []*sink
+
+	// feedMu is held by the output goroutine while a chunk is written
+	// to the sinks and split into lines, so that a sink can be added
+	// at a known point of the captured output
+	feedMu sync.Mutex
+	// partial is the incomplete line at the end of the captured output
+	partial []byte
+}
+
+func newSinkSet() *sinkSet {
+	return new(sinkSet)
+}
+
+func (ss *sinkSet) add(w io.Writer, policy SinkPolicy) (remove func()) {
+	_, remove = ss.addSink(w, policy)
+	return remove
+}
+
+func (ss *sinkSet) addSink(w io.Writer, policy SinkPolicy) (*sink, func()) {
+	s := newSink(w, policy)
+
+	ss.mu.Lock()
+	ss.sinks = append(ss.sinks, s)
+	ss.mu.Unlock()
+
+	var once sync.Once
+	return s, func() {
+		once.Do(func() {
+			ss.mu.Lock()
+			sinks := make([]*sink, 0, len(ss.sinks))
+			for _, x := range ss.sinks {
+				if x != s {
+					sinks = append(sinks, x)
+				}
+			}
+			ss.sinks = sinks
+			ss.mu.Unlock()
+
+			s.remove()
+		})
+	}
+}
+
+func (ss *sinkSet) write(b []byte) {
+	ss.mu.RLock()
+	sinks := ss.sinks
+	ss.mu.RUnlock()
+
+	for _, s := range sinks {
+		s.write(b)
+	}
+}
+
+// AddStdoutWriter attaches w to the standard output of the Process,
+// even while it is running, until the returned function is called.
+// The writer stays attached across restarts. The policy decides how a slow
+// writer is handled, so that it can't stall the child if not wanted.
+//
+// Writers are only fed if the output is captured, see the package documentation
+func (p *Process) AddStdoutWriter(w io.Writer, policy SinkPolicy) (remove func()) {
+	return p.outSinks.add(w, policy)
+}
+
+// AddStderrWriter is like AddStdoutWriter, but for the standard error
+func (p *Process) AddStderrWriter(w io.Writer, policy SinkPolicy) (remove func()) {
+	return p.errSinks.add(w, policy)
+}
+
+// AddStdinWriter attaches w to the standard input pipe of the Process:
+// every piece of data written to the child with SendInput and the other
+// input methods is also written to w
+func (p *Process) AddStdinWriter(w io.Writer, policy SinkPolicy) (remove func()) {
+	return p.inSinks.add(w, policy)
+}
@@ -0,0 +1,56 @@
+package process
+
+import (
+	"testing"
+	"time"
+)
+
+// stuckWriter blocks every Write until release is closed
+type stuckWriter struct {
+	entered chan struct{}
+	release chan struct{}
+}
+
+func (w *stuckWriter) Write(b []byte) (int, error) {
+	select {
+	case w.entered <- struct{}{}:
+	default:
+	}
+	<-w.release
+	return len(b), nil
+}
+
+func TestSinkRemoveDuringBlockedWrite(t *testing.T) {
+	for name, policy := range map[string]SinkPolicy{
+		"block":  BlockSink,
+		"drop":   DropSink,
+		"buffer": BufferSink(1024),
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := &stuckWriter{entered: make(chan struct{}, 1), release: make(chan struct{})}
+			defer close(w.release)
+
+			ss := newSinkSet()
+			remove := ss.add(w, policy)
+
+			go ss.write([]byte("data"))
+			select {
+			case <-w.entered:
+			case <-time.After(time.Second):
+				t.Fatal("the writer was never called")
+			}
+
+			removed := make(chan struct{})
+			go func() {
+				remove()
+				close(removed)
+			}()
+
+			select {
+			case <-removed:
+			case <-time.After(time.Second):
+				t.Fatal("remove waited for the blocked write")
+			}
+		})
+	}
+}
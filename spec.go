@@ -0,0 +1,328 @@
+package process
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Spec is the serializable description of a Process. It can be encoded
+// to and decoded from JSON and TOML, and loaded from files with LoadSpecs
+type Spec struct {
+	// Name identifies the Spec, when loaded from files it's the key
+	// of the process table
+	Name string `json:"name,omitempty" toml:"name,omitempty"`
+	// Exec is the executable path, see NewProcess
+	Exec string   `json:"exec" toml:"exec"`
+	Args []string `json:"args,omitempty" toml:"args,omitempty"`
+	// Dir is the working directory, relative paths are calculated from
+	// the parent working directory
+	Dir string `json:"wd,omitempty" toml:"wd,omitempty"`
+	// Env holds the variables added to the parent environment
+	Env            map[string]string `json:"env,omitempty" toml:"env,omitempty"`
+	InheritConsole bool              `json:"inherit_console,omitempty" toml:"inherit_console,omitempty"`
+
+	Stdin  StdioMode `json:"stdin,omitempty" toml:"stdin,omitempty"`
+	Stdout StdioMode `json:"stdout,omitempty" toml:"stdout,omitempty"`
+	Stderr StdioMode `json:"stderr,omitempty" toml:"stderr,omitempty"`
+
+	Restart   *RestartPolicy `json:"restart,omitempty" toml:"restart,omitempty"`
+	Readiness *ReadinessSpec `json:"readiness,omitempty" toml:"readiness,omitempty"`
+	Limits    *Limits        `json:"limits,omitempty" toml:"limits,omitempty"`
+}
+
+// StdioMode tells where the standard streams of a Spec are connected.
+// The output is always captured by the Process, the mode only selects
+// where it's copied too
+type StdioMode string
+
+const (
+	// StdioPipe keeps the standard input open to be written with SendInput,
+	// it's the default for the standard input
+	StdioPipe StdioMode = "pipe"
+	// StdioCapture only captures the output, it's the default
+	// for the standard output and error
+	StdioCapture StdioMode = "capture"
+	// StdioNull connects the standard input to the null device and
+	// doesn't copy the output anywhere
+	StdioNull StdioMode = "null"
+	// StdioInherit connects the stream to the one of the parent process
+	StdioInherit StdioMode = "inherit"
+)
+
+// RestartMode tells when a Process is restarted after exiting
+type RestartMode string
+
+const (
+	RestartNever     RestartMode = "no"
+	RestartOnFailure RestartMode = "on-failure"
+	RestartAlways    RestartMode = "always"
+)
+
+// RestartPolicy describes how a supervisor restarts a Process
+// when it exits
+type RestartPolicy struct {
+	Mode RestartMode `json:"mode" toml:"mode"`
+	// MaxRestarts is the maximum number of consecutive restarts,
+	// zero means no limit
+	MaxRestarts int `json:"max_restarts,omitempty" toml:"max_restarts,omitempty"`
+	// Delay is the time waited before each restart
+	Delay Duration `json:"delay,omitempty" toml:"delay,omitempty"`
+}
+
+// ShouldRestart reports whether a Process that exited with the
+// given status after the given number of restarts must be restarted.
+// With RestartOnFailure, a death by any signal, like a segmentation fault
+// or the kill of the OOM killer, is a failure: the supervisor must not
+// ask about the processes it stopped on purpose
+func (r *RestartPolicy) ShouldRestart(exitStatus ExitStatus, restarts int) bool {
+	if r == nil || (r.MaxRestarts > 0 && restarts >= r.MaxRestarts) {
+		return false
+	}
+
+	switch r.Mode {
+	case RestartAlways:
+		return true
+	case RestartOnFailure:
+		_, signaled := exitStatus.Signal()
+		return signaled || exitStatus.Error() != nil
+	default:
+		return false
+	}
+}
+
+// ReadinessSpec describes a ReadinessCheck. Exactly one of
+// Output, TCP and After must be set
+type ReadinessSpec struct {
+	// Output is a regular expression matched against the
+	// standard output, see ReadyOnOutput
+	Output string `json:"output,omitempty" toml:"output,omitempty"`
+	// TCP is the address dialed by ReadyOnTCP every Interval
+	TCP      string   `json:"tcp,omitempty" toml:"tcp,omitempty"`
+	Interval Duration `json:"interval,omitempty" toml:"interval,omitempty"`
+	// After is the running time after which the Process is ready,
+	// see ReadyAfter
+	After Duration `json:"after,omitempty" toml:"after,omitempty"`
+}
+
+// defaultTCPInterval is used by a ReadinessSpec without interval
+const defaultTCPInterval = 250 * time.Millisecond
+
+// Check returns the ReadinessCheck described
+func (r *ReadinessSpec) Check() (ReadinessCheck, error) {
+	switch {
+	case r.Output != "":
+		re, err := regexp.Compile(r.Output)
+		if err != nil {
+			return nil, err
+		}
+		return ReadyOnOutput(re), nil
+	case r.TCP != "":
+		interval := time.Duration(r.Interval)
+		if interval <= 0 {
+			interval = defaultTCPInterval
+		}
+		return ReadyOnTCP(r.TCP, interval), nil
+	case r.After > 0:
+		return ReadyAfter(time.Duration(r.After)), nil
+	default:
+		return nil, errors.New("no check defined")
+	}
+}
+
+// Duration is a time.Duration encoded as a string like "1m30s"
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(v)
+	return nil
+}
+
+// FieldError is the error of a single field of a Spec
+type FieldError struct {
+	// Field is the path of the field, like "restart.mode"
+	Field string
+	Err   error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Field, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// SpecError is returned by Validate with every invalid field of a Spec
+type SpecError struct {
+	Name   string
+	Fields []*FieldError
+}
+
+func (e *SpecError) Error() string {
+	msgs := make([]string, 0, len(e.Fields))
+	for _, f := range e.Fields {
+		msgs = append(msgs, f.Error())
+	}
+	return fmt.Sprintf("spec \"%s\": %s", e.Name, strings.Join(msgs, "; "))
+}
+
+func (e *SpecError) add(field string, format string, a ...any) {
+	e.Fields = append(e.Fields, &FieldError{Field: field, Err: fmt.Errorf(format, a...)})
+}
+
+// Validate checks every field of the Spec, returning a *SpecError
+// that lists the invalid ones
+func (s *Spec) Validate() error {
+	e := &SpecError{Name: s.Name}
+
+	if s.Exec == "" {
+		e.add("exec", "required")
+	}
+
+	for _, key := range sortedKeys(s.Env) {
+		if key == "" || strings.ContainsAny(key, "=\x00") {
+			e.add("env", "invalid variable name \"%s\"", key)
+		}
+	}
+
+	switch s.Stdin {
+	case "", StdioPipe, StdioNull, StdioInherit:
+	default:
+		e.add("stdin", "unknown mode \"%s\"", s.Stdin)
+	}
+	for field, mode := range map[string]StdioMode{"stdout": s.Stdout, "stderr": s.Stderr} {
+		switch mode {
+		case "", StdioCapture, StdioNull, StdioInherit:
+		default:
+			e.add(field, "unknown mode \"%s\"", mode)
+		}
+	}
+
+	if r := s.Restart; r != nil {
+		switch r.Mode {
+		case RestartNever, RestartOnFailure, RestartAlways:
+		default:
+			e.add("restart.mode", "unknown mode \"%s\"", r.Mode)
+		}
+		if r.MaxRestarts < 0 {
+			e.add("restart.max_restarts", "must not be negative")
+		}
+		if r.Delay < 0 {
+			e.add("restart.delay", "must not be negative")
+		}
+	}
+
+	if r := s.Readiness; r != nil {
+		defined := 0
+		if r.Output != "" {
+			defined++
+			if _, err := regexp.Compile(r.Output); err != nil {
+				e.add("readiness.output", "%v", err)
+			}
+		}
+		if r.TCP != "" {
+			defined++
+			if _, _, err := net.SplitHostPort(r.TCP); err != nil {
+				e.add("readiness.tcp", "%v", err)
+			}
+		}
+		if r.After != 0 {
+			defined++
+			if r.After < 0 {
+				e.add("readiness.after", "must not be negative")
+			}
+		}
+		if r.Interval < 0 {
+			e.add("readiness.interval", "must not be negative")
+		}
+		if defined != 1 {
+			e.add("readiness", "exactly one of output, tcp and after must be set")
+		}
+	}
+
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	sort.SliceStable(e.Fields, func(i, j int) bool {
+		return e.Fields[i].Field < e.Fields[j].Field
+	})
+	return e
+}
+
+// NewProcess validates the Spec and creates the Process it describes
+func (s *Spec) NewProcess() (*Process, error) {
+	if err := s.Validate(); err != nil {
+		return nil, err
+	}
+	wd := s.Dir
+	if wd == "" {
+		wd = "."
+	}
+
+	p, err := NewProcess(wd, s.Exec, s.Args...)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(s.Env) > 0 {
+		p.Env = os.Environ()
+		for _, key := range sortedKeys(s.Env) {
+			p.Env = append(p.Env, key+"="+s.Env[key])
+		}
+	}
+	p.InheritConsole(s.InheritConsole)
+	p.Limits = s.Limits
+
+	if s.Readiness != nil {
+		check, err := s.Readiness.Check()
+		if err != nil {
+			return nil, err
+		}
+		p.SetReadiness(check)
+	}
+
+	return p, nil
+}
+
+// Stdio returns the standard input, output and error to pass to
+// Start according to the stdio modes of the Spec
+func (s *Spec) Stdio() (stdin io.Reader, stdout, stderr io.Writer) {
+	switch s.Stdin {
+	case StdioNull:
+		stdin = DevNull()
+	case StdioInherit:
+		stdin = os.Stdin
+	}
+	if s.Stdout == StdioInherit {
+		stdout = os.Stdout
+	}
+	if s.Stderr == StdioInherit {
+		stderr = os.Stderr
+	}
+	return
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
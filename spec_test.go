@@ -0,0 +1,134 @@
+package process
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+func testSpec() *Spec {
+	size := uint64(1 << 20)
+	return &Spec{
+		Name:   "web",
+		Exec:   "server",
+		Args:   []string{"--port", "8080"},
+		Dir:    "srv",
+		Env:    map[string]string{"MODE": "prod"},
+		Stdin:  StdioNull,
+		Stdout: StdioInherit,
+		Restart: &RestartPolicy{
+			Mode:        RestartOnFailure,
+			MaxRestarts: 3,
+			Delay:       Duration(1500 * time.Millisecond),
+		},
+		Readiness: &ReadinessSpec{TCP: "localhost:8080", Interval: Duration(time.Second)},
+		Limits:    &Limits{FileSize: &size},
+	}
+}
+
+func TestSpecRoundTrip(t *testing.T) {
+	spec := testSpec()
+
+	data, err := json.Marshal(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(data, []byte(`"delay":"1.5s"`)) {
+		t.Errorf("JSON = %s, want the delay as a string", data)
+	}
+	var fromJSON Spec
+	if err := json.Unmarshal(data, &fromJSON); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&fromJSON, spec) {
+		t.Errorf("JSON round trip = %+v, want %+v", fromJSON, *spec)
+	}
+
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(spec); err != nil {
+		t.Fatal(err)
+	}
+	var fromTOML Spec
+	if _, err := toml.Decode(buf.String(), &fromTOML); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&fromTOML, spec) {
+		t.Errorf("TOML round trip = %+v, want %+v", fromTOML, *spec)
+	}
+
+	var bad Spec
+	if err := json.Unmarshal([]byte(`{"exec":"a","restart":{"mode":"always","delay":"soon"}}`), &bad); err == nil {
+		t.Error("an invalid duration was decoded")
+	}
+}
+
+func TestSpecValidate(t *testing.T) {
+	if err := testSpec().Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	spec := &Spec{
+		Name:    "bad",
+		Env:     map[string]string{"A=B": "x"},
+		Stdin:   StdioCapture,
+		Stderr:  "file",
+		Restart: &RestartPolicy{Mode: "sometimes", MaxRestarts: -1, Delay: -1},
+		Readiness: &ReadinessSpec{
+			Output: "(",
+			TCP:    "no-port",
+		},
+	}
+
+	err := spec.Validate()
+	var specErr *SpecError
+	if !errors.As(err, &specErr) {
+		t.Fatalf("Validate = %v, want a *SpecError", err)
+	}
+	var fields []string
+	for _, f := range specErr.Fields {
+		fields = append(fields, f.Field)
+	}
+	want := []string{
+		"env", "exec", "readiness", "readiness.output", "readiness.tcp",
+		"restart.delay", "restart.max_restarts", "restart.mode", "stderr", "stdin",
+	}
+	if !reflect.DeepEqual(fields, want) {
+		t.Errorf("invalid fields = %v, want %v", fields, want)
+	}
+
+	if err := (&Spec{Exec: "a", Readiness: &ReadinessSpec{}}).Validate(); err == nil {
+		t.Error("Validate accepted a readiness without checks")
+	}
+}
+
+func TestRestartPolicy(t *testing.T) {
+	success := ExitStatus{ExitCode: 0}
+	failure := ExitStatus{ExitCode: 1, ExitError: errors.New("exit status 1")}
+
+	tests := []struct {
+		policy   *RestartPolicy
+		status   ExitStatus
+		restarts int
+		want     bool
+	}{
+		{nil, failure, 0, false},
+		{&RestartPolicy{Mode: RestartNever}, failure, 0, false},
+		{&RestartPolicy{Mode: RestartAlways}, success, 0, true},
+		{&RestartPolicy{Mode: RestartOnFailure}, success, 0, false},
+		{&RestartPolicy{Mode: RestartOnFailure}, failure, 0, true},
+		{&RestartPolicy{Mode: RestartOnFailure, MaxRestarts: 2}, failure, 1, true},
+		{&RestartPolicy{Mode: RestartOnFailure, MaxRestarts: 2}, failure, 2, false},
+		{&RestartPolicy{Mode: RestartAlways, MaxRestarts: 2}, success, 5, false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.policy.ShouldRestart(tt.status, tt.restarts); got != tt.want {
+			t.Errorf("%+v.ShouldRestart(code %d, %d) = %v, want %v", tt.policy, tt.status.ExitCode, tt.restarts, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+//go:build !windows
+
+package process
+
+import "testing"
+
+func TestRestartOnSignal(t *testing.T) {
+	policy := &RestartPolicy{Mode: RestartOnFailure}
+
+	for _, script := range []string{"kill -SEGV $$", "kill -KILL $$", "kill -INT $$"} {
+		exitStatus, err := newShell(t, script).Run(DevNull(), nil, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := exitStatus.Signal(); !ok {
+			t.Fatalf("%q didn't die by a signal: %+v", script, exitStatus)
+		}
+		if !policy.ShouldRestart(exitStatus, 0) {
+			t.Errorf("%q is not restarted on failure", script)
+		}
+	}
+}
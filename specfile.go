@@ -0,0 +1,266 @@
+package process
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// LoadSpecs loads the specs defined in the given JSON or TOML files,
+// chosen by the file extension, and returns them by name. A file has
+// the following structure (in TOML):
+//
+//	include = ["base.toml"]
+//
+//	[vars]
+//	root = "/srv/app"
+//
+//	[processes.web]
+//	exec = "${root}/bin/web"
+//	args = ["--port", "${PORT}"]
+//
+// The included files, with paths relative to the including file, are
+// loaded before it. Files are merged in order: tables are merged key by
+// key and any other value is replaced, so a later file can override a
+// single field of a process. Strings can reference the merged vars or,
+// as a fallback, the environment variables with ${name}, while $$ is a
+// literal $. Every spec is named after its key and validated
+func LoadSpecs(paths ...string) (map[string]*Spec, error) {
+	merged := make(map[string]any)
+	for _, path := range paths {
+		if err := loadSpecFile(path, merged, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	vars := make(map[string]string)
+	if raw, ok := merged["vars"].(map[string]any); ok {
+		for name, value := range raw {
+			s, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("vars.%s: expected a string", name)
+			}
+
+			s, err := interpolate(s, nil)
+			if err != nil {
+				return nil, fmt.Errorf("vars.%s: %w", name, err)
+			}
+			vars[name] = s
+		}
+	}
+	delete(merged, "vars")
+
+	value, err := interpolateValue("", merged, vars)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var file struct {
+		Processes map[string]*Spec `json:"processes"`
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&file); err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	for _, name := range sortedKeys(file.Processes) {
+		spec := file.Processes[name]
+		if spec == nil {
+			spec = &Spec{}
+			file.Processes[name] = spec
+		}
+
+		spec.Name = name
+		if err := spec.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	return file.Processes, nil
+}
+
+// loadSpecFile merges the file at path, after its includes, into merged.
+// The stack holds the files being loaded to detect include cycles
+func loadSpecFile(path string, merged map[string]any, stack []string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	for _, loading := range stack {
+		if loading == abs {
+			return fmt.Errorf("include cycle: %s -> %s", strings.Join(stack, " -> "), abs)
+		}
+	}
+	stack = append(stack, abs)
+
+	content, err := decodeSpecFile(abs)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	if raw, ok := content["include"]; ok {
+		includes, ok := raw.([]any)
+		if !ok {
+			return fmt.Errorf("%s: include: expected a list of paths", path)
+		}
+
+		for _, include := range includes {
+			s, ok := include.(string)
+			if !ok {
+				return fmt.Errorf("%s: include: expected a list of paths", path)
+			}
+			if !filepath.IsAbs(s) {
+				s = filepath.Join(filepath.Dir(abs), s)
+			}
+
+			if err := loadSpecFile(s, merged, stack); err != nil {
+				return err
+			}
+		}
+		delete(content, "include")
+	}
+
+	mergeTables(merged, content)
+	return nil
+}
+
+func decodeSpecFile(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	content := make(map[string]any)
+	switch ext := filepath.Ext(path); ext {
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		err = dec.Decode(&content)
+	case ".toml":
+		_, err = toml.Decode(string(data), &content)
+	default:
+		err = fmt.Errorf("unknown file format \"%s\"", ext)
+	}
+
+	return content, err
+}
+
+// mergeTables merges src into dst: nested tables are merged
+// recursively while other values are replaced
+func mergeTables(dst map[string]any, src map[string]any) {
+	for key, value := range src {
+		srcTable, srcOk := value.(map[string]any)
+		dstTable, dstOk := dst[key].(map[string]any)
+		if srcOk && dstOk {
+			mergeTables(dstTable, srcTable)
+			continue
+		}
+		dst[key] = value
+	}
+}
+
+// interpolateValue expands the variables of every string found in value,
+// using field as the path of value in the errors
+func interpolateValue(field string, value any, vars map[string]string) (any, error) {
+	switch v := value.(type) {
+	case string:
+		s, err := interpolate(v, vars)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", field, err)
+		}
+		return s, nil
+	case map[string]any:
+		for key, item := range v {
+			expanded, err := interpolateValue(joinField(field, key), item, vars)
+			if err != nil {
+				return nil, err
+			}
+			v[key] = expanded
+		}
+		return v, nil
+	case []any:
+		for i, item := range v {
+			expanded, err := interpolateValue(fmt.Sprintf("%s[%d]", field, i), item, vars)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = expanded
+		}
+		return v, nil
+	case []map[string]any:
+		for i, item := range v {
+			if _, err := interpolateValue(fmt.Sprintf("%s[%d]", field, i), item, vars); err != nil {
+				return nil, err
+			}
+		}
+		return v, nil
+	default:
+		return value, nil
+	}
+}
+
+func joinField(field string, key string) string {
+	if field == "" {
+		return key
+	}
+	return field + "." + key
+}
+
+// interpolate expands ${name} with vars or the environment
+func interpolate(s string, vars map[string]string) (string, error) {
+	if !strings.Contains(s, "$") {
+		return s, nil
+	}
+
+	var b strings.Builder
+	for {
+		i := strings.IndexByte(s, '$')
+		if i < 0 {
+			b.WriteString(s)
+			return b.String(), nil
+		}
+		b.WriteString(s[:i])
+		s = s[i+1:]
+
+		switch {
+		case strings.HasPrefix(s, "$"):
+			b.WriteByte('$')
+			s = s[1:]
+		case strings.HasPrefix(s, "{"):
+			end := strings.IndexByte(s, '}')
+			if end < 0 {
+				return "", errors.New("unterminated variable reference")
+			}
+
+			name := s[1:end]
+			value, ok := vars[name]
+			if !ok {
+				value, ok = os.LookupEnv(name)
+			}
+			if !ok {
+				return "", fmt.Errorf("undefined variable \"%s\"", name)
+			}
+
+			b.WriteString(value)
+			s = s[end+1:]
+		default:
+			b.WriteByte('$')
+		}
+	}
+}
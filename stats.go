@@ -0,0 +1,172 @@
+package process
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/nixpare/broadcaster"
+)
+
+// StatsScope selects the processes aggregated by Process.Stats
+type StatsScope int
+
+const (
+	// StatsProcess covers only the child itself
+	StatsProcess StatsScope = iota
+	// StatsGroup covers every process in the process group of the child
+	StatsGroup
+	// StatsTree covers the child and all its descendants
+	StatsTree
+)
+
+// ErrStatsUnsupported is returned by Process.Stats on the
+// platforms where it's not implemented
+var ErrStatsUnsupported = errors.New("process stats are not supported")
+
+// Stats is a snapshot of the resource usage of a running Process,
+// summed over the processes of the StatsScope
+type Stats struct {
+	Time time.Time
+	// PIDs is the number of processes aggregated
+	PIDs int
+	// CPUTime is the user and system CPU time consumed
+	CPUTime time.Duration
+	// CPUPercent is the CPU usage, where 100 is a whole core: for Stats
+	// it's the average since the child started, for the samples of a
+	// StatsSampler it's the usage since the previous sample
+	CPUPercent float64
+	// RSS and VirtualMemory are in bytes
+	RSS           uint64
+	VirtualMemory uint64
+	Threads       int
+	OpenFiles     int
+	// ReadBytes and WriteBytes are the bytes read from and
+	// written to the storage layer
+	ReadBytes  uint64
+	WriteBytes uint64
+}
+
+// Stats returns the resource usage of the running Process, aggregated
+// over the given scope. It's supported only on Linux, where it reads the
+// /proc file system
+func (p *Process) Stats(scope StatsScope) (Stats, error) {
+	if !p.IsRunning() {
+		return Stats{}, fmt.Errorf("program \"%s\" is not running", p.ExecName)
+	}
+	return readStats(p.PID(), scope)
+}
+
+// StatsSampler publishes the Stats of a Process at a fixed interval
+// until the Process exits or the sampler is stopped
+type StatsSampler struct {
+	bc   *broadcaster.Broadcaster[Stats]
+	mu   sync.Mutex
+	last Stats
+	err  error
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// SampleStats starts a StatsSampler for the running Process. Subscribers
+// that don't keep up with the interval slow down the sampling
+func (p *Process) SampleStats(interval time.Duration, scope StatsScope) *StatsSampler {
+	s := &StatsSampler{
+		bc:   broadcaster.NewBroadcaster[Stats](),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go s.run(p, interval, scope)
+	return s
+}
+
+func (s *StatsSampler) run(p *Process, interval time.Duration, scope StatsScope) {
+	defer close(s.done)
+	defer s.bc.Close()
+
+	exited := p.stateChanged()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var prev Stats
+	for {
+		stats, err := p.Stats(scope)
+		if err != nil {
+			// errors caused by the Process exiting are not reported
+			if p.IsRunning() {
+				s.mu.Lock()
+				s.err = err
+				s.mu.Unlock()
+			}
+			return
+		}
+
+		if !prev.Time.IsZero() {
+			stats.CPUPercent = cpuPercent(prev, stats)
+		}
+		prev = stats
+
+		s.mu.Lock()
+		s.last = stats
+		s.mu.Unlock()
+		s.bc.Send(stats)
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-exited:
+				exited = p.stateChanged()
+				if p.IsRunning() {
+					continue
+				}
+				return
+			case <-s.stop:
+				return
+			}
+			break
+		}
+	}
+}
+
+// cpuPercent returns the CPU usage between two samples
+func cpuPercent(prev, cur Stats) float64 {
+	elapsed := cur.Time.Sub(prev.Time)
+	delta := cur.CPUTime - prev.CPUTime
+	if elapsed <= 0 || delta <= 0 {
+		return 0
+	}
+	return 100 * float64(delta) / float64(elapsed)
+}
+
+// Subscribe returns a channel receiving every sample and a function
+// to stop the subscription. The channel is closed when the sampler stops
+func (s *StatsSampler) Subscribe(bufSize int) (<-chan Stats, func()) {
+	ch := s.bc.Register(bufSize)
+	return ch.Ch(), ch.Unregister
+}
+
+// Last returns the most recent sample
+func (s *StatsSampler) Last() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.last
+}
+
+// Err returns the error that stopped the sampler, if any
+func (s *StatsSampler) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.err
+}
+
+// Stop stops the sampler and waits for it to return
+func (s *StatsSampler) Stop() {
+	s.once.Do(func() {
+		close(s.stop)
+	})
+	<-s.done
+}
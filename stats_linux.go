@@ -0,0 +1,194 @@
+package process
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clockTicks is the unit of the times in /proc/<pid>/stat (USER_HZ),
+// which is fixed to 100 on every architecture supported by Go
+const clockTicks = 100
+
+// procStat holds the fields of /proc/<pid>/stat used by Stats
+type procStat struct {
+	pid, ppid, pgrp int
+	cpu             time.Duration
+	start           time.Duration
+}
+
+func readProcStat(pid int) (procStat, error) {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return procStat{}, err
+	}
+
+	// the command name can contain spaces and parentheses
+	i := bytes.LastIndexByte(data, ')')
+	if i < 0 {
+		return procStat{}, fmt.Errorf("/proc/%d/stat: malformed", pid)
+	}
+	fields := strings.Fields(string(data[i+1:]))
+	if len(fields) < 20 {
+		return procStat{}, fmt.Errorf("/proc/%d/stat: malformed", pid)
+	}
+
+	var values [20]int64
+	for _, n := range []int{1, 2, 11, 12, 19} {
+		if values[n], err = strconv.ParseInt(fields[n], 10, 64); err != nil {
+			return procStat{}, fmt.Errorf("/proc/%d/stat: %w", pid, err)
+		}
+	}
+
+	return procStat{
+		pid:   pid,
+		ppid:  int(values[1]),
+		pgrp:  int(values[2]),
+		cpu:   time.Duration(values[11]+values[12]) * time.Second / clockTicks,
+		start: time.Duration(values[19]) * time.Second / clockTicks,
+	}, nil
+}
+
+// readProcFields reads the "key: value" lines of the given /proc file,
+// keeping only the values of the given keys
+func readProcFields(path string, keys ...string) (map[string]uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	values := make(map[string]uint64, len(keys))
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		key, value, ok := strings.Cut(sc.Text(), ":")
+		if !ok {
+			continue
+		}
+		for _, k := range keys {
+			if k != key {
+				continue
+			}
+			// the sizes in /proc/<pid>/status are in kB
+			value, unit, _ := strings.Cut(strings.TrimSpace(value), " ")
+			n, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s: %w", path, key, err)
+			}
+			if unit == "kB" {
+				n *= 1024
+			}
+			values[key] = n
+		}
+	}
+	return values, sc.Err()
+}
+
+func uptime() (time.Duration, error) {
+	data, err := os.ReadFile("/proc/uptime")
+	if err != nil {
+		return 0, err
+	}
+
+	secs, _, _ := strings.Cut(string(data), " ")
+	f, err := strconv.ParseFloat(secs, 64)
+	if err != nil {
+		return 0, fmt.Errorf("/proc/uptime: %w", err)
+	}
+	return time.Duration(f * float64(time.Second)), nil
+}
+
+// scopePIDs returns the stat of the processes in the scope
+// of root, the root first
+func scopePIDs(root procStat, scope StatsScope) ([]procStat, error) {
+	if scope == StatsProcess {
+		return []procStat{root}, nil
+	}
+
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+
+	children := make(map[int][]procStat)
+	procs := []procStat{root}
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil || pid == root.pid {
+			continue
+		}
+
+		// processes can exit while scanning
+		st, err := readProcStat(pid)
+		if err != nil {
+			continue
+		}
+
+		switch scope {
+		case StatsGroup:
+			if st.pgrp == root.pgrp {
+				procs = append(procs, st)
+			}
+		case StatsTree:
+			children[st.ppid] = append(children[st.ppid], st)
+		}
+	}
+
+	if scope == StatsTree {
+		for i := 0; i < len(procs); i++ {
+			procs = append(procs, children[procs[i].pid]...)
+		}
+	}
+	return procs, nil
+}
+
+func readStats(pid int, scope StatsScope) (Stats, error) {
+	root, err := readProcStat(pid)
+	if err != nil {
+		return Stats{}, err
+	}
+
+	procs, err := scopePIDs(root, scope)
+	if err != nil {
+		return Stats{}, err
+	}
+
+	stats := Stats{Time: time.Now()}
+	for _, st := range procs {
+		status, err := readProcFields(fmt.Sprintf("/proc/%d/status", st.pid), "VmRSS", "VmSize", "Threads")
+		if err != nil {
+			if st.pid == pid {
+				return Stats{}, err
+			}
+			continue
+		}
+
+		stats.PIDs++
+		stats.CPUTime += st.cpu
+		stats.RSS += status["VmRSS"]
+		stats.VirtualMemory += status["VmSize"]
+		stats.Threads += int(status["Threads"])
+
+		// io is not readable for the processes of other users
+		if io, err := readProcFields(fmt.Sprintf("/proc/%d/io", st.pid), "read_bytes", "write_bytes"); err == nil {
+			stats.ReadBytes += io["read_bytes"]
+			stats.WriteBytes += io["write_bytes"]
+		}
+		if fds, err := os.ReadDir(fmt.Sprintf("/proc/%d/fd", st.pid)); err == nil {
+			stats.OpenFiles += len(fds)
+		}
+	}
+
+	up, err := uptime()
+	if err != nil {
+		return Stats{}, err
+	}
+	if elapsed := up - root.start; elapsed > 0 {
+		stats.CPUPercent = 100 * float64(stats.CPUTime) / float64(elapsed)
+	}
+	return stats, nil
+}
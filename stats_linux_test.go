@@ -0,0 +1,85 @@
+package process
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestReadStatsSelf(t *testing.T) {
+	// burn some CPU time to have something to measure
+	for start := time.Now(); time.Since(start) < 50*time.Millisecond; {
+	}
+
+	stats, err := readStats(os.Getpid(), StatsProcess)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.PIDs != 1 {
+		t.Errorf("PIDs = %d, want 1", stats.PIDs)
+	}
+	if stats.RSS < 1<<20 || stats.VirtualMemory < stats.RSS {
+		t.Errorf("RSS = %d, VirtualMemory = %d", stats.RSS, stats.VirtualMemory)
+	}
+	if stats.CPUTime < 10*time.Millisecond || stats.CPUPercent <= 0 {
+		t.Errorf("CPUTime = %v, CPUPercent = %v", stats.CPUTime, stats.CPUPercent)
+	}
+	if stats.Threads < 1 || stats.OpenFiles < 3 {
+		t.Errorf("Threads = %d, OpenFiles = %d", stats.Threads, stats.OpenFiles)
+	}
+
+	if _, err := readStats(-1, StatsProcess); err == nil {
+		t.Error("readStats succeeded on a missing process")
+	}
+}
+
+func TestStatsScope(t *testing.T) {
+	p := newShell(t, "sleep 2 >/dev/null & sleep 2 >/dev/null & echo started; wait")
+	p.InheritConsole(false)
+
+	lines := make(chan string, 1)
+	if err := p.Start(DevNull(), &lineWriter{lines: lines}, nil); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		p.Kill()
+		p.Wait()
+	})
+	<-lines
+
+	// the children are found by the tree and by the process group
+	for scope, want := range map[StatsScope]int{StatsProcess: 1, StatsGroup: 3, StatsTree: 3} {
+		stats, err := p.Stats(scope)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stats.PIDs != want {
+			t.Errorf("PIDs with scope %d = %d, want %d", scope, stats.PIDs, want)
+		}
+	}
+}
+
+func TestSampleStats(t *testing.T) {
+	p := newShell(t, "exec sleep 0.5")
+	if err := p.Start(DevNull(), nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	s := p.SampleStats(50*time.Millisecond, StatsProcess)
+	samples, _ := s.Subscribe(16)
+	var n int
+	for stats := range samples {
+		// the last sample can find the Process already a zombie
+		if stats.PIDs != 1 || (n == 0 && stats.RSS == 0) {
+			t.Errorf("sample %d = %+v", n, stats)
+		}
+		n++
+	}
+
+	// the sampler stops by itself when the Process exits
+	s.Stop()
+	p.Wait()
+	if n < 2 || s.Err() != nil {
+		t.Errorf("%d samples, error %v", n, s.Err())
+	}
+}
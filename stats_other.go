@@ -0,0 +1,7 @@
+//go:build !linux
+
+package process
+
+func readStats(pid int, scope StatsScope) (Stats, error) {
+	return Stats{}, ErrStatsUnsupported
+}
@@ -1,6 +1,11 @@
 package process
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"syscall"
+)
 
 // ExitStatus holds the status information of a Process
 // after it has exited
@@ -8,9 +13,38 @@ type ExitStatus struct {
 	PID       int
 	ExitCode  int
 	ExitError error
+	// HookError holds the errors of the hooks run during
+	// the execution, see AddHook
+	HookError error
+	// Cgroup holds the counters of the cgroup of the Process,
+	// if it had one, see Process.Cgroup
+	Cgroup *CgroupStats
+	// WatchdogReason is set when the Process was terminated by the
+	// signal of, restarted or killed by a Watchdog, see NewWatchdog
+	WatchdogReason string
 }
 
 func (exitStatus ExitStatus) Error() error {
+	err := exitStatus.exitError()
+	if exitStatus.HookError != nil {
+		return errors.Join(err, exitStatus.HookError)
+	}
+
+	return err
+}
+
+func (exitStatus ExitStatus) exitError() error {
+	if exitStatus.WatchdogReason != "" {
+		return fmt.Errorf("stopped by the watchdog: %s", exitStatus.WatchdogReason)
+	}
+	if limit, ok := exitStatus.LimitExceeded(); ok {
+		return fmt.Errorf("%s limit exceeded: %v", limit, exitStatus.ExitError)
+	}
+	if sig, ok := exitStatus.Signal(); ok && sig == syscall.SIGKILL &&
+		exitStatus.Cgroup != nil && exitStatus.Cgroup.OOMKills > 0 {
+		return fmt.Errorf("killed by the OOM killer: %v", exitStatus.ExitError)
+	}
+
 	if exitStatus.ExitCode == 0 || exitStatus.ExitCode == interrupt_errno {
 		return nil
 	}
@@ -22,6 +56,21 @@ func (exitStatus ExitStatus) Error() error {
 	return fmt.Errorf("exit status (code 0x%x): %v", exitStatus.ExitCode, exitStatus.ExitError)
 }
 
+// Signal returns the signal that terminated the Process, if it was
+// terminated by a signal. It's never the case on Windows
+func (exitStatus ExitStatus) Signal() (syscall.Signal, bool) {
+	var exitErr *exec.ExitError
+	if !errors.As(exitStatus.ExitError, &exitErr) {
+		return 0, false
+	}
+
+	ws, ok := exitErr.Sys().(syscall.WaitStatus)
+	if !ok || !ws.Signaled() {
+		return 0, false
+	}
+	return ws.Signal(), true
+}
+
 func (exitStatus ExitStatus) Unwrap() error {
 	return exitStatus.ExitError
 }
@@ -1,4 +1,23 @@
 //go:build !windows
 package process
 
+import "syscall"
+
 const interrupt_errno = -1
+
+// LimitExceeded reports whether the Process was terminated for exceeding
+// its CPU time or file size limit, see Limits, returning the name of the
+// limit, "cpu_time" or "file_size"
+func (exitStatus ExitStatus) LimitExceeded() (string, bool) {
+	sig, ok := exitStatus.Signal()
+	switch {
+	case !ok:
+		return "", false
+	case sig == syscall.SIGXCPU:
+		return "cpu_time", true
+	case sig == syscall.SIGXFSZ:
+		return "file_size", true
+	default:
+		return "", false
+	}
+}
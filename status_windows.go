@@ -1,3 +1,9 @@
 package process
 
 const interrupt_errno = 0xc000013a
+
+// LimitExceeded always reports false on Windows, where Limits
+// are not supported
+func (exitStatus ExitStatus) LimitExceeded() (string, bool) {
+	return "", false
+}
@@ -0,0 +1,234 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+var (
+	// ErrStdinNotPipe is returned when sending data to a Process whose
+	// standard input is not a pipe, see the package documentation
+	ErrStdinNotPipe = errors.New("can't pipe input to the process, see package documentation for more details")
+	// ErrInputQueueFull is returned by SendInput when the child is not
+	// reading its standard input and the queue of pending data is full
+	ErrInputQueueFull = errors.New("input queue is full")
+	// ErrInputClosed is returned when sending data after the input pipe
+	// was closed or the Process has exited
+	ErrInputClosed = errors.New("input pipe is closed")
+)
+
+// inputQueueSize is the number of writes that can be pending
+// on the standard input of a Process
+const inputQueueSize = 64
+
+type inputRequest struct {
+	ctx  context.Context
+	data []byte
+	done chan error
+}
+
+// stdinWriter owns the standard input pipe of a running Process: every
+// write is queued and performed by a single goroutine, so that producers
+// are never interleaved and never blocked by a child that stops reading
+type stdinWriter struct {
+	w     io.WriteCloser
+	sinks *sinkSet
+	queue chan inputRequest
+	exit  chan struct{}
+	once  sync.Once
+
+	mu     sync.Mutex
+	closed bool
+	// err is the last error of a write, reported to the
+	// callers of SendInput that don't wait for their data
+	err error
+}
+
+func newStdinWriter(w io.WriteCloser, sinks *sinkSet) *stdinWriter {
+	return &stdinWriter{
+		w:     w,
+		sinks: sinks,
+		queue: make(chan inputRequest, inputQueueSize),
+		exit:  make(chan struct{}),
+	}
+}
+
+func (sw *stdinWriter) start() {
+	go sw.loop()
+}
+
+// stop is called when the Process exits: pending and future
+// requests fail with ErrInputClosed
+func (sw *stdinWriter) stop() {
+	sw.once.Do(func() { close(sw.exit) })
+}
+
+func (sw *stdinWriter) loop() {
+	for {
+		select {
+		case <-sw.exit:
+			sw.drain()
+			return
+		case req := <-sw.queue:
+			if err := sw.lastErr(); err != nil {
+				req.done <- err
+				continue
+			}
+			if req.ctx != nil && req.ctx.Err() != nil {
+				req.done <- req.ctx.Err()
+				continue
+			}
+
+			n, err := sw.w.Write(req.data)
+			if n > 0 {
+				sw.sinks.write(req.data[:n])
+			}
+			req.done <- sw.failed(err)
+		}
+	}
+}
+
+// lastErr returns the error that new requests must fail with
+func (sw *stdinWriter) lastErr() error {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	if sw.closed {
+		return ErrInputClosed
+	}
+	return sw.err
+}
+
+// failed records the error of a write, unless it was
+// caused by the pipe being closed with close
+func (sw *stdinWriter) failed(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	if sw.closed {
+		return ErrInputClosed
+	}
+	sw.err = err
+	return err
+}
+
+// close closes the pipe without waiting for the queue, unblocking the
+// write in progress, and returns the last write error, if any
+func (sw *stdinWriter) close() error {
+	sw.mu.Lock()
+	if sw.closed {
+		sw.mu.Unlock()
+		return ErrInputClosed
+	}
+	sw.closed = true
+	err := sw.err
+	sw.mu.Unlock()
+
+	if cerr := sw.w.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (sw *stdinWriter) drain() {
+	for {
+		select {
+		case req := <-sw.queue:
+			req.done <- ErrInputClosed
+		default:
+			return
+		}
+	}
+}
+
+func (sw *stdinWriter) enqueue(ctx context.Context, req inputRequest) error {
+	req.done = make(chan error, 1)
+
+	select {
+	case <-sw.exit:
+		return ErrInputClosed
+	default:
+	}
+
+	if err := sw.lastErr(); err != nil {
+		return err
+	}
+
+	if ctx == nil {
+		select {
+		case sw.queue <- req:
+			return nil
+		default:
+			return ErrInputQueueFull
+		}
+	}
+
+	req.ctx = ctx
+	select {
+	case sw.queue <- req:
+	case <-sw.exit:
+		return ErrInputClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case err := <-req.done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *Process) stdin() (*stdinWriter, error) {
+	if !p.IsRunning() {
+		return nil, fmt.Errorf("program \"%s\" is not running", p.ExecName)
+	}
+
+	if p.in == nil {
+		return nil, ErrStdinNotPipe
+	}
+
+	return p.in, nil
+}
+
+// SendInput queues data to be sent to the Process via a pipe, if the Process
+// is running and can pipe data, and returns without waiting for the child
+// to read it. Data sent by concurrent callers is never interleaved.
+// If the child is not reading and the queue is full, ErrInputQueueFull is returned.
+// As the data is written later, a write error (like a broken pipe when the child
+// has closed its standard input) is returned by the following calls to
+// SendInput and by CloseInput
+//
+// The Process might take any input until a newline or an EOF: for the first
+// one you can use the SendText method, for the second case, you can close
+// the pipe via the CloseInput method
+//
+// For more details, see the package documentation
+func (p *Process) SendInput(data []byte) error {
+	in, err := p.stdin()
+	if err != nil {
+		return err
+	}
+
+	return in.enqueue(nil, inputRequest{data: append([]byte(nil), data...)})
+}
+
+// SendInputContext is like SendInput, but waits for the data to be written
+// to the pipe, or for ctx to be done. Data still in the queue when ctx is
+// done is discarded
+func (p *Process) SendInputContext(ctx context.Context, data []byte) error {
+	in, err := p.stdin()
+	if err != nil {
+		return err
+	}
+
+	return in.enqueue(ctx, inputRequest{data: append([]byte(nil), data...)})
+}
@@ -0,0 +1,72 @@
+//go:build !windows
+
+package process
+
+import (
+	"errors"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func startShell(t *testing.T, script string) *Process {
+	t.Helper()
+
+	p, err := NewProcess("", "sh", "-c", script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Start(nil, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		p.Kill()
+		p.Wait()
+		p.Close()
+	})
+	return p
+}
+
+func TestCloseInputUnblocksWrite(t *testing.T) {
+	// the child never reads, so the write fills the pipe and blocks
+	p := startShell(t, "exec sleep 10")
+
+	if err := p.SendInput(make([]byte, 1<<20)); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- p.CloseInput() }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("CloseInput: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("CloseInput blocked on the pending write")
+	}
+
+	if err := p.SendInput([]byte("x")); !errors.Is(err, ErrInputClosed) {
+		t.Errorf("SendInput after CloseInput = %v, want %v", err, ErrInputClosed)
+	}
+}
+
+func TestSendInputReportsWriteError(t *testing.T) {
+	// the child closes its standard input and keeps running
+	p := startShell(t, "exec sleep 10 0<&-")
+
+	deadline := time.Now().Add(5 * time.Second)
+	var err error
+	for err == nil && time.Now().Before(deadline) {
+		err = p.SendInput([]byte("line\n"))
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !errors.Is(err, syscall.EPIPE) {
+		t.Fatalf("SendInput = %v, want %v", err, syscall.EPIPE)
+	}
+
+	if err := p.CloseInput(); !errors.Is(err, syscall.EPIPE) {
+		t.Errorf("CloseInput = %v, want %v", err, syscall.EPIPE)
+	}
+}
@@ -1,6 +1,7 @@
 package process
 
 import (
+	"errors"
 	"os"
 	"os/signal"
 	"strings"
@@ -29,39 +30,115 @@ func StopListenForCTRLC(exitC chan os.Signal) {
 }
 
 // ParseCommandArgs gets a list of strings and parses their content
-// splitting them into separated strings. The characters used to parse
-// the commands are, in the relevant order, <'>, <"> and < >
+// splitting them into separated strings, following the same quoting
+// and escaping rules of SplitCommand, so Windows paths must be quoted.
+// Unlike SplitCommand, no variable is expanded and unterminated quotes
+// and trailing backslashes are closed at the end of each string
 func ParseCommandArgs(args ...string) []string {
 	a := make([]string, 0)
 	for _, s := range args {
-		for i, s1 := range strings.Split(s, "'") {
-			if i%2 == 1 {
-				a = append(a, s1)
-				continue
-			}
-
-			for j, s2 := range strings.Split(s1, "\"") {
-				if j%2 == 1 {
-					a = append(a, s2)
-					continue
-				}
-
-				for _, s3 := range strings.Split(s2, " ") {
-					if s3 != "" {
-						a = append(a, s3)
-					}
-				}
-			}
-		}
+		lx := &lexer{input: s, lenient: true}
+		words, _ := lx.words()
+		a = append(a, words...)
 	}
 
-	
-
 	return a
 }
 
-// FastCommandParse
+// FastCommandParse parses the arguments like ParseCommand, including
+// the "cd <dir> &&" prefix and the expansion of the variables, but it
+// never fails: unterminated quotes and trailing backslashes are closed
+// at the end of each string. The working directory is empty without
+// the prefix and so is execName for an empty command
 func FastCommandParse(args ...string) (wd string, execName string, argV []string) {
-	a := ParseCommandArgs(args...)
-	return "", a[0], a[1:]
+	env := os.Environ()
+	if len(args) > 0 {
+		if dir, rest, ok, err := cutCdPrefix(args[0], env); err == nil && ok {
+			wd = dir
+			args = append([]string{rest}, args[1:]...)
+		}
+	}
+
+	a := make([]string, 0)
+	for _, s := range args {
+		lx := &lexer{input: s, lookup: envLookup(env), lenient: true}
+		words, _ := lx.words()
+		a = append(a, words...)
+	}
+
+	if len(a) == 0 {
+		return wd, "", nil
+	}
+	return wd, a[0], a[1:]
+}
+
+// ParseCommand parses a command line with SplitCommand, expanding
+// the variables with the parent environment, and returns the components
+// needed by NewProcess. The command can start with an unquoted
+// "cd <dir> &&" prefix to set the working directory, otherwise the
+// current one is returned
+func ParseCommand(args ...string) (wd string, execName string, argV []string, err error) {
+	env := os.Environ()
+	if len(args) > 0 {
+		dir, rest, ok, err := cutCdPrefix(args[0], env)
+		if err != nil {
+			return "", "", nil, err
+		}
+		if ok {
+			wd = dir
+			args = append([]string{rest}, args[1:]...)
+		}
+	}
+
+	a := make([]string, 0)
+	for _, s := range args {
+		words, err := SplitCommand(s, env)
+		if err != nil {
+			return "", "", nil, err
+		}
+		a = append(a, words...)
+	}
+
+	if wd == "" {
+		wd, err = os.Getwd()
+		if err != nil {
+			return "", "", nil, err
+		}
+	}
+
+	if len(a) == 0 {
+		return "", "", nil, errors.New("empty command")
+	}
+
+	return wd, a[0], a[1:], nil
+}
+
+// cutCdPrefix splits a "cd <dir> &&" prefix from the command line,
+// looking at the raw input so that a quoted "cd" or "&&" is not a prefix
+func cutCdPrefix(s string, env []string) (dir string, rest string, ok bool, err error) {
+	lx := &lexer{input: s, lookup: envLookup(env), operators: true}
+
+	lx.skipBlanks()
+	start := lx.pos
+	if _, err := lx.word(); err != nil {
+		return "", "", false, err
+	}
+	if lx.input[start:lx.pos] != "cd" {
+		return "", "", false, nil
+	}
+
+	lx.skipBlanks()
+	if lx.eof() {
+		return "", "", false, nil
+	}
+	if dir, err = lx.word(); err != nil {
+		return "", "", false, err
+	}
+
+	lx.skipBlanks()
+	rest, ok = strings.CutPrefix(lx.input[lx.pos:], "&&")
+	if !ok || (rest != "" && !isBlank(rest[0])) {
+		return "", "", false, nil
+	}
+	return dir, rest, true, nil
 }
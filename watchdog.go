@@ -0,0 +1,313 @@
+package process
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/nixpare/broadcaster"
+)
+
+// WatchdogAction is what a Watchdog does when a threshold is exceeded
+type WatchdogAction int
+
+const (
+	// WatchdogLog only publishes a WatchdogEvent
+	WatchdogLog WatchdogAction = iota
+	// WatchdogSignal sends the Signal of the WatchdogOptions
+	WatchdogSignal
+	// WatchdogRestart stops the Process gracefully, with the StopTimeout
+	// of the WatchdogOptions, and starts a Process.Clone in its place
+	// with the standard input and output given to the last Start, the
+	// NULL file in place of a nil stdin. The old Process is then closed
+	WatchdogRestart
+	// WatchdogKill kills the Process
+	WatchdogKill
+)
+
+func (a WatchdogAction) String() string {
+	switch a {
+	case WatchdogLog:
+		return "log"
+	case WatchdogSignal:
+		return "signal"
+	case WatchdogRestart:
+		return "restart"
+	case WatchdogKill:
+		return "kill"
+	default:
+		return fmt.Sprintf("WatchdogAction(%d)", int(a))
+	}
+}
+
+// WatchdogOptions are the options of a Watchdog
+type WatchdogOptions struct {
+	// Interval is the time between two checks, one second if zero
+	Interval time.Duration
+	// Scope selects the processes whose usage is summed, see Process.Stats
+	Scope StatsScope
+	// MaxRSS is the memory threshold, in bytes; zero means no threshold
+	MaxRSS uint64
+	// MaxCPUPercent is the CPU threshold, where 100 is a whole core;
+	// zero means no threshold
+	MaxCPUPercent float64
+	// Window is how long a threshold must be exceeded, at every check,
+	// before the action runs; with zero it runs at the first check
+	// above the threshold
+	Window time.Duration
+	Action WatchdogAction
+	// Signal is sent by WatchdogSignal, os.Interrupt if nil
+	Signal os.Signal
+	// StopTimeout is the time given to the Process to exit after the
+	// CTRL-C event, before being killed, by WatchdogRestart
+	StopTimeout time.Duration
+}
+
+// WatchdogEvent is published by a Watchdog every time a threshold
+// is exceeded for the whole window
+type WatchdogEvent struct {
+	Time    time.Time
+	Process *Process
+	Action  WatchdogAction
+	Reason  string
+	Stats   Stats
+	// Restarted is the Process started in place of the
+	// previous one by WatchdogRestart
+	Restarted *Process
+	// Err is the error of the action, if it failed
+	Err error
+}
+
+// Watchdog checks the memory and CPU usage of a running Process at a
+// fixed interval and runs an action when they stay above a threshold
+// for a sustained window. When the action stops the Process, the reason
+// is reported in ExitStatus.WatchdogReason: for WatchdogSignal, only if
+// the Process is terminated by the signal. The Watchdog stops when the
+// Process exits, unless it's restarted by the Watchdog itself, which
+// then keeps watching the new one. It's supported only where
+// Process.Stats is
+type Watchdog struct {
+	opts WatchdogOptions
+	bc   *broadcaster.Broadcaster[WatchdogEvent]
+	mu   sync.Mutex
+	p    *Process
+	err  error
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// NewWatchdog starts watching the running Process p
+func NewWatchdog(p *Process, opts WatchdogOptions) *Watchdog {
+	if opts.Interval <= 0 {
+		opts.Interval = time.Second
+	}
+	if opts.Signal == nil {
+		opts.Signal = os.Interrupt
+	}
+
+	w := &Watchdog{
+		opts: opts,
+		bc:   broadcaster.NewBroadcaster[WatchdogEvent](),
+		p:    p,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// Process returns the Process being watched, which changes
+// every time it's restarted by WatchdogRestart
+func (w *Watchdog) Process() *Process {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.p
+}
+
+// Subscribe returns a channel receiving every WatchdogEvent and a
+// function to stop the subscription. The channel is closed when the
+// Watchdog stops. Subscribers that don't keep up delay the checks
+func (w *Watchdog) Subscribe(bufSize int) (<-chan WatchdogEvent, func()) {
+	ch := w.bc.Register(bufSize)
+	return ch.Ch(), ch.Unregister
+}
+
+// Err returns the error that stopped the Watchdog, if any
+func (w *Watchdog) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.err
+}
+
+// Stop stops the Watchdog, leaving the Process running,
+// and waits for it to return
+func (w *Watchdog) Stop() {
+	w.once.Do(func() {
+		close(w.stop)
+	})
+	<-w.done
+}
+
+func (w *Watchdog) run() {
+	defer close(w.done)
+	defer w.bc.Close()
+
+	ticker := time.NewTicker(w.opts.Interval)
+	defer ticker.Stop()
+
+	p := w.Process()
+	exited := p.stateChanged()
+
+	var prev Stats
+	var memSince, cpuSince time.Time
+	for {
+		stats, err := p.Stats(w.opts.Scope)
+		if err != nil {
+			// errors caused by the Process exiting are not reported
+			if p.IsRunning() {
+				w.mu.Lock()
+				w.err = err
+				w.mu.Unlock()
+			}
+			return
+		}
+
+		// the CPU usage is measured since the previous check
+		var cpu float64
+		hasCPU := !prev.Time.IsZero()
+		if hasCPU {
+			cpu = cpuPercent(prev, stats)
+		}
+		prev = stats
+
+		var reason string
+		if r, ok := sustained(&memSince, stats.Time, w.opts.Window,
+			w.opts.MaxRSS > 0 && stats.RSS > w.opts.MaxRSS,
+		); ok {
+			reason = fmt.Sprintf("rss %d bytes above %d for %v", stats.RSS, w.opts.MaxRSS, r)
+		} else if r, ok := sustained(&cpuSince, stats.Time, w.opts.Window,
+			w.opts.MaxCPUPercent > 0 && hasCPU && cpu > w.opts.MaxCPUPercent,
+		); ok {
+			reason = fmt.Sprintf("cpu %.1f%% above %.1f%% for %v", cpu, w.opts.MaxCPUPercent, r)
+		}
+
+		if reason != "" {
+			stats.CPUPercent = cpu
+			next := w.act(p, reason, stats)
+			if next == nil && w.opts.Action != WatchdogLog && w.opts.Action != WatchdogSignal {
+				return
+			}
+			if next != nil {
+				p, prev = next, Stats{}
+				exited = p.stateChanged()
+			}
+			memSince, cpuSince = time.Time{}, time.Time{}
+		}
+
+		for {
+			select {
+			case <-ticker.C:
+			case <-exited:
+				exited = p.stateChanged()
+				if p.IsRunning() {
+					continue
+				}
+				return
+			case <-w.stop:
+				return
+			}
+			break
+		}
+	}
+}
+
+// sustained tracks since when a threshold has been exceeded, reporting
+// for how long once it has been exceeded for the whole window
+func sustained(since *time.Time, now time.Time, window time.Duration, exceeded bool) (time.Duration, bool) {
+	if !exceeded {
+		*since = time.Time{}
+		return 0, false
+	}
+	if since.IsZero() {
+		*since = now
+	}
+
+	d := now.Sub(*since)
+	return d.Round(time.Millisecond), d >= window
+}
+
+// act runs the action and publishes the event, returning the
+// Process started in place of p by WatchdogRestart
+func (w *Watchdog) act(p *Process, reason string, stats Stats) *Process {
+	e := WatchdogEvent{Time: time.Now(), Process: p, Action: w.opts.Action, Reason: reason, Stats: stats}
+
+	switch w.opts.Action {
+	case WatchdogSignal:
+		p.setWatchdogReason(reason, w.opts.Signal)
+		e.Err = p.Exec.Process.Signal(w.opts.Signal)
+	case WatchdogKill:
+		p.setWatchdogReason(reason, nil)
+		e.Err = p.Kill()
+	case WatchdogRestart:
+		p.setWatchdogReason(reason, nil)
+		if _, err := p.StopTimeout(w.opts.StopTimeout); err != nil {
+			e.Err = err
+			break
+		}
+
+		stdin, stdout, stderr := p.startIO()
+		if stdin == nil {
+			// the input pipe of the old Process can't be handed over
+			stdin = DevNull()
+		}
+
+		np := p.Clone()
+		if err := np.Start(stdin, stdout, stderr); err != nil {
+			np.Close()
+			e.Err = err
+			break
+		}
+		e.Restarted = np
+
+		w.mu.Lock()
+		w.p = np
+		w.mu.Unlock()
+	}
+
+	if e.Err != nil && w.opts.Action == WatchdogRestart {
+		w.mu.Lock()
+		w.err = e.Err
+		w.mu.Unlock()
+	}
+
+	w.bc.Send(e)
+	if e.Restarted != nil {
+		p.Close()
+	}
+	return e.Restarted
+}
+
+// setWatchdogReason records the reason of the action, with the signal
+// sent if the action may not stop the Process
+func (p *Process) setWatchdogReason(reason string, sig os.Signal) {
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+
+	if p.running {
+		p.watchdogReason = reason
+		p.watchdogSignal = sig
+	}
+}
+
+// startIO returns the standard input and output given to the last Start
+func (p *Process) startIO() (io.Reader, io.Writer, io.Writer) {
+	p.stateMu.Lock()
+	defer p.stateMu.Unlock()
+
+	return p.startStdin, p.startStdout, p.startStderr
+}
@@ -0,0 +1,130 @@
+package process
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// watchOnce runs the Watchdog on p until the first action, with
+// a threshold exceeded by every Process
+func watchOnce(t *testing.T, p *Process, opts WatchdogOptions) WatchdogEvent {
+	t.Helper()
+
+	opts.MaxRSS = 1
+	w := NewWatchdog(p, opts)
+	ch, unsub := w.Subscribe(1)
+	defer unsub()
+
+	select {
+	case e := <-ch:
+		w.Stop()
+		return e
+	case <-time.After(5 * time.Second):
+		w.Stop()
+		t.Fatal("the watchdog didn't act")
+		return WatchdogEvent{}
+	}
+}
+
+func TestWatchdogSignalStops(t *testing.T) {
+	p := startShell(t, "exec sleep 10")
+
+	e := watchOnce(t, p, WatchdogOptions{Action: WatchdogSignal, Signal: syscall.SIGTERM})
+	if e.Err != nil {
+		t.Fatal(e.Err)
+	}
+
+	exitStatus := p.Wait()
+	if exitStatus.WatchdogReason != e.Reason {
+		t.Errorf("WatchdogReason = %q, want %q", exitStatus.WatchdogReason, e.Reason)
+	}
+	if err := exitStatus.Error(); err == nil || !strings.Contains(err.Error(), "watchdog") {
+		t.Errorf("Error = %v, want the watchdog error", err)
+	}
+}
+
+func TestWatchdogSignalIgnored(t *testing.T) {
+	// the signal is sent once it's ignored
+	p := newShell(t, "trap '' USR1; echo trapped; sleep 0.3")
+	lines := make(chan string, 1)
+	if err := p.Start(DevNull(), &lineWriter{lines: lines}, nil); err != nil {
+		t.Fatal(err)
+	}
+	<-lines
+
+	e := watchOnce(t, p, WatchdogOptions{Action: WatchdogSignal, Signal: syscall.SIGUSR1})
+	if e.Err != nil {
+		t.Fatal(e.Err)
+	}
+
+	exitStatus := p.Wait()
+	if exitStatus.WatchdogReason != "" {
+		t.Errorf("WatchdogReason = %q for a signal that didn't stop the process", exitStatus.WatchdogReason)
+	}
+	if err := exitStatus.Error(); err != nil {
+		t.Errorf("Error = %v, want nil", err)
+	}
+}
+
+func TestWatchdogRestart(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	lines := make(chan string, 10)
+	go func() {
+		sc := bufio.NewScanner(r)
+		for sc.Scan() {
+			lines <- sc.Text()
+		}
+	}()
+
+	// the first run reads from its stdin pipe, which stays open
+	p := newShell(t, "echo start; read -r _ || echo eof; exec sleep 10")
+	if err := p.Start(nil, w, nil); err != nil {
+		t.Fatal(err)
+	}
+	if line := <-lines; line != "start" {
+		t.Fatalf("first line = %q, want start", line)
+	}
+
+	e := watchOnce(t, p, WatchdogOptions{Action: WatchdogRestart, Interval: time.Second, StopTimeout: time.Second})
+	if e.Err != nil {
+		t.Fatal(e.Err)
+	}
+	np := e.Restarted
+	t.Cleanup(func() {
+		np.Kill()
+		np.Wait()
+		np.Close()
+	})
+
+	// the new Process writes to the same stdout and reads the NULL file
+	for _, want := range []string{"start", "eof"} {
+		select {
+		case line := <-lines:
+			if line != want {
+				t.Errorf("line = %q, want %q", line, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no %q line from the restarted process", want)
+		}
+	}
+
+	p.stateMu.Lock()
+	closed := p.closed
+	p.stateMu.Unlock()
+	if !closed {
+		t.Error("the old process was not closed")
+	}
+	if got := p.Wait().WatchdogReason; got != e.Reason {
+		t.Errorf("WatchdogReason = %q, want %q", got, e.Reason)
+	}
+}